@@ -18,13 +18,16 @@ limitations under the License.
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"mogilefs"
 	"os"
 	"sort"
+	"strconv"
 	"strings"
+	"time"
 )
 
 var flagDomain = flag.String("domain", "", "The domain to use for this request")
@@ -37,16 +40,28 @@ var flagDeleteKey = flag.String("delete", "", "The key to delete")
 var flagDebugKey = flag.String("debug_key", "", "The key to debug")
 var flagFetchKey = flag.String("fetch_key", "", "Download given key from mogilefs - output is written to STDOUT")
 var flagCreateKey = flag.String("create_key", "", "The new key to create, input will be read from STDIN")
+var flagClientId = flag.String("client_id", "", "Identity to send along with each tracker command")
+var flagDeletePrefix = flag.String("delete_prefix", "", "Delete all keys starting with this prefix (requires -older_than)")
+var flagOlderThan = flag.String("older_than", "", "DELETE_PREFIX: only delete keys older than this age, eg. '90d' or '12h'")
+var flagDryRun = flag.Bool("dry_run", false, "DELETE_PREFIX: only print the keys which would be deleted")
+var flagCtimePrefix = flag.String("ctime_prefix", "_ctime:", "Prefix of the keys holding the creation time of keys, written by -create_key and read by -delete_prefix")
 
 func main() {
 	flag.Parse()
 
 	trackerList := strings.Split(*flagTrackers, ",")
 
+	if len(*flagDeletePrefix) != 0 && len(*flagOlderThan) == 0 {
+		fmt.Fprintf(os.Stderr, "error = -delete_prefix requires -older_than\n")
+		os.Exit(1)
+	}
+
 	if len(*flagInfoKey) != 0 {
 		printKeyInfo(trackerList, *flagDomain, *flagInfoKey)
 	} else if len(*flagDeleteKey) != 0 {
 		deleteFile(trackerList, *flagDomain, *flagDeleteKey)
+	} else if len(*flagDeletePrefix) != 0 {
+		deleteOlderThan(trackerList, *flagDomain, *flagDeletePrefix, *flagOlderThan, *flagDryRun)
 	} else if len(*flagDebugKey) != 0 {
 		debugKey(trackerList, *flagDomain, *flagDebugKey)
 	} else if len(*flagRenameFrom) != 0 && len(*flagRenameTo) != 0 {
@@ -61,9 +76,15 @@ func main() {
 
 }
 
+func newClient(trackers []string, domain string) *mogilefs.MogileFsClient {
+	mc := mogilefs.New(domain, trackers)
+	mc.SetClientId(*flagClientId)
+	return mc
+}
+
 func printKeyInfo(trackers []string, domain string, key string) {
 
-	mc := mogilefs.New(domain, trackers)
+	mc := newClient(trackers, domain)
 	p, e := mc.GetPaths(key, &mogilefs.GetPathsOpts{NoVerify: true, Pathcount: 64})
 
 	fmt.Printf("# details about '%s' on domain '%s' using %d tracker(s)\n", key, domain, len(trackers))
@@ -79,7 +100,7 @@ func printKeyInfo(trackers []string, domain string, key string) {
 }
 
 func renameFile(trackers []string, domain string, from string, to string) {
-	mc := mogilefs.New(domain, trackers)
+	mc := newClient(trackers, domain)
 	e := mc.Rename(from, to)
 
 	if e == nil {
@@ -90,7 +111,7 @@ func renameFile(trackers []string, domain string, from string, to string) {
 }
 
 func deleteFile(trackers []string, domain string, key string) {
-	mc := mogilefs.New(domain, trackers)
+	mc := newClient(trackers, domain)
 	e := mc.Delete(key)
 
 	if e == nil {
@@ -100,8 +121,74 @@ func deleteFile(trackers []string, domain string, key string) {
 	}
 }
 
+// Deletes all keys starting with prefix which were created before the given age.
+// The creation time of a key is read from its -ctime_prefix key, keys without one are skipped.
+func deleteOlderThan(trackers []string, domain string, prefix string, age string, dryRun bool) {
+	maxAge, err := parseAge(age)
+	if err != nil {
+		fmt.Printf("error = %s\n", err)
+		return
+	}
+	cutoff := time.Now().Add(-maxAge)
+
+	mc := newClient(trackers, domain)
+	it := mc.NewKeyIterator(prefix, "")
+	for it.Next() {
+		key := it.Key()
+		if strings.HasPrefix(key, *flagCtimePrefix) {
+			continue
+		}
+		ctime, err := keyCreationTime(mc, key)
+		if err != nil {
+			fmt.Printf("skip %s: %s\n", key, err)
+			continue
+		}
+		if ctime.After(cutoff) {
+			continue
+		}
+		if dryRun {
+			fmt.Printf("would delete %s (%s)\n", key, ctime.Format(time.RFC3339))
+		} else if err = mc.Delete(key); err != nil {
+			fmt.Printf("error deleting %s: %s\n", key, err)
+		} else {
+			mc.Delete(*flagCtimePrefix + key)
+			fmt.Printf("deleted %s (%s)\n", key, ctime.Format(time.RFC3339))
+		}
+	}
+
+	if it.Err() != nil {
+		fmt.Printf("error = %s\n", it.Err())
+	}
+}
+
+// Returns the creation time of key recorded by createFile().
+// mogilefsd does not keep it: file_debug only reports the creation time of uploads in
+// progress, and the Last-Modified header of a replica changes when it is replicated again.
+func keyCreationTime(mc *mogilefs.MogileFsClient, key string) (ctime time.Time, err error) {
+	data, err := mc.FetchBytes(*flagCtimePrefix + key)
+	if errors.Is(err, mogilefs.ErrUnknownKey) {
+		err = fmt.Errorf("no creation time recorded")
+	}
+	if err == nil {
+		var unix int64
+		if unix, err = strconv.ParseInt(string(data), 10, 64); err == nil {
+			ctime = time.Unix(unix, 0)
+		}
+	}
+	return
+}
+
+// Parses durations like '90d', '36h' or '15m'
+func parseAge(age string) (time.Duration, error) {
+	if strings.HasSuffix(age, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(age, "d"))
+		return time.Duration(days) * 24 * time.Hour, err
+	}
+	return time.ParseDuration(age)
+}
+
 func debugKey(trackers []string, domain string, key string) {
-	mc := mogilefs.New(domain, trackers)
+	mc := newClient(trackers, domain)
 	values, err := mc.Debug(key)
 
 	if err == nil {
@@ -120,7 +207,7 @@ func debugKey(trackers []string, domain string, key string) {
 }
 
 func fetchFile(trackers []string, domain string, key string) {
-	mc := mogilefs.New(domain, trackers)
+	mc := newClient(trackers, domain)
 	f, err := mc.Fetch(key)
 
 	if err != nil {
@@ -144,8 +231,11 @@ func fetchFile(trackers []string, domain string, key string) {
 }
 
 func createFile(trackers []string, domain string, key string, class string) {
-	mc := mogilefs.New(domain, trackers)
+	mc := newClient(trackers, domain)
 	_, err := mc.Create(key, class, os.Stdin)
+	if err == nil {
+		err = mc.StoreBytes(*flagCtimePrefix+key, "", []byte(strconv.FormatInt(time.Now().Unix(), 10)))
+	}
 
 	if err != nil {
 		fmt.Printf("error = %s\n", err)
@@ -0,0 +1,205 @@
+/*
+
+Copyright 2015 Adrian Ulrich
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+// mogbackfill records checksums of keys which were stored without one.
+//
+// Each key of the domain (or of -prefix) is fetched and hashed. The checksum is either
+// stored in a sidecar key ('-mode sidecar', the default) or recorded by the trackers by
+// uploading the key once more with a checksum ('-mode tracker'). Keys which already have
+// a checksum are skipped.
+//
+// The last processed key is written to the -checkpoint file: restarting mogbackfill with
+// the same checkpoint continues where the previous run stopped.
+package main
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"hash"
+	"io"
+	"mogilefs"
+	"os"
+	"strings"
+	"time"
+)
+
+var flagDomain = flag.String("domain", "", "The domain to backfill")
+var flagTrackers = flag.String("trackers", "localhost:7001", "A list of trackers to use")
+var flagPrefix = flag.String("prefix", "", "Only backfill keys starting with this prefix")
+var flagMode = flag.String("mode", "sidecar", "Where to record checksums: 'sidecar' or 'tracker'")
+var flagHashtype = flag.String("hashtype", "MD5", "The checksum to compute: only 'MD5' is supported by mogilefsd")
+var flagSidecarPrefix = flag.String("sidecar_prefix", "_checksum:", "SIDECAR: prefix of the keys holding checksums")
+var flagSidecarClass = flag.String("sidecar_class", "", "SIDECAR: class of the keys holding checksums")
+var flagCheckpoint = flag.String("checkpoint", "", "File to remember the last processed key in")
+var flagRate = flag.Float64("rate", 10, "Maximum number of keys processed per second (0 for no limit)")
+var flagDryRun = flag.Bool("dry_run", false, "Only print the checksums, do not store them")
+
+func main() {
+	flag.Parse()
+
+	if len(*flagDomain) == 0 || (*flagMode != "sidecar" && *flagMode != "tracker") {
+		flag.PrintDefaults()
+		os.Exit(1)
+	}
+	if _, err := newHash(*flagHashtype); err != nil {
+		fmt.Fprintf(os.Stderr, "error = %s\n", err)
+		os.Exit(1)
+	}
+
+	mc := mogilefs.New(*flagDomain, strings.Split(*flagTrackers, ","))
+	mc.SetClientId("mogbackfill")
+
+	cursor, err := readCheckpoint(*flagCheckpoint)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error = %s\n", err)
+		os.Exit(1)
+	}
+
+	var throttle <-chan time.Time
+	if *flagRate > 0 {
+		throttle = time.Tick(time.Duration(float64(time.Second) / *flagRate))
+	}
+
+	done, failed := 0, 0
+	it := mc.NewKeyIterator(*flagPrefix, cursor)
+	for it.Next() {
+		key := it.Key()
+		if strings.HasPrefix(key, *flagSidecarPrefix) {
+			continue
+		}
+		if throttle != nil {
+			<-throttle
+		}
+
+		if err = backfillKey(mc, key); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: error = %s\n", key, err)
+			failed++
+		} else {
+			done++
+		}
+		if err = writeCheckpoint(*flagCheckpoint, it.Cursor()); err != nil {
+			fmt.Fprintf(os.Stderr, "error = %s\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if err = it.Err(); err != nil {
+		fmt.Fprintf(os.Stderr, "error = %s\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("processed = %d\nfailed = %d\n", done, failed)
+}
+
+// Records the checksum of key unless it already has one
+func backfillKey(mc *mogilefs.MogileFsClient, key string) (err error) {
+	info, err := mc.FileInfo(key)
+	if err != nil || len(info.Checksum) > 0 {
+		return
+	}
+
+	if *flagMode == "tracker" {
+		if *flagDryRun {
+			fmt.Printf("%s: would upload again with %s checksum\n", key, *flagHashtype)
+			return
+		}
+		// uploading the key once more makes the tracker record (and verify) the checksum
+		r, ferr := mc.Fetch(key)
+		if err = ferr; err == nil {
+			_, err = mc.CreateWithOpts(key, info.Class, r, &mogilefs.CreateOpts{Checksum: *flagHashtype, Size: info.Length})
+			r.Close()
+		}
+		if err == nil {
+			fmt.Printf("%s: recorded by tracker\n", key)
+		}
+		return
+	}
+
+	sidecar := *flagSidecarPrefix + key
+	if _, err = mc.GetPaths(sidecar, nil); err == nil {
+		return
+	} else if !errors.Is(err, mogilefs.ErrUnknownKey) {
+		return
+	}
+
+	checksum, err := fetchChecksum(mc, key)
+	if err == nil {
+		if *flagDryRun {
+			fmt.Printf("%s: %s\n", key, checksum)
+			return
+		}
+		err = mc.StoreBytes(sidecar, *flagSidecarClass, []byte(checksum))
+	}
+	if err == nil {
+		fmt.Printf("%s: %s\n", key, checksum)
+	}
+	return
+}
+
+// Returns the checksum of key, formatted like the checksums of the trackers ('MD5:<hex digest>')
+func fetchChecksum(mc *mogilefs.MogileFsClient, key string) (checksum string, err error) {
+	h, err := newHash(*flagHashtype)
+	if err != nil {
+		return
+	}
+	r, err := mc.Fetch(key)
+	if err != nil {
+		return
+	}
+	defer r.Close()
+
+	if _, err = io.Copy(h, r); err == nil {
+		checksum = *flagHashtype + ":" + hex.EncodeToString(h.Sum(nil))
+	}
+	return
+}
+
+func newHash(hashtype string) (h hash.Hash, err error) {
+	switch hashtype {
+	case "MD5":
+		h = md5.New()
+	default:
+		err = fmt.Errorf("unsupported hashtype '%s'", hashtype)
+	}
+	return
+}
+
+// Returns the key stored in the checkpoint file, an empty string if there is none
+func readCheckpoint(path string) (cursor string, err error) {
+	if len(path) == 0 {
+		return
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		err = nil
+	}
+	cursor = strings.TrimRight(string(data), "\n")
+	return
+}
+
+// Atomically replaces the checkpoint file
+func writeCheckpoint(path string, cursor string) (err error) {
+	if len(path) == 0 {
+		return
+	}
+	tmp := path + ".tmp"
+	if err = os.WriteFile(tmp, []byte(cursor+"\n"), 0644); err == nil {
+		err = os.Rename(tmp, path)
+	}
+	return
+}
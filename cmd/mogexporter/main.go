@@ -0,0 +1,176 @@
+/*
+
+Copyright 2015 Adrian Ulrich
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+// mogexporter exports the state of a MogileFS cluster as Prometheus metrics.
+//
+// The metrics are collected on each scrape of /metrics:
+//
+//	mogilefs_tracker_up{tracker}                  1 if the tracker answered a noop command
+//	mogilefs_host_status{hostid,host,status}      1 for the status of each host
+//	mogilefs_device_status{devid,hostid,status}   1 for the status of each device
+//	mogilefs_device_observed_state{devid,state}   1 for the observed state of each device
+//	mogilefs_device_total_bytes{devid,hostid}     size of each device
+//	mogilefs_device_used_bytes{devid,hostid}      used space of each device
+//	mogilefs_device_utilization{devid,hostid}     IO utilization of each device in percent
+//	mogilefs_device_weight{devid,hostid}          weight of each device
+//	mogilefs_replication_backlog{domain}          files with fewer copies than required by their class
+//	mogilefs_replication_backlog_seconds{domain}  time it took to compute the replication backlog
+//	mogilefs_scrape_errors                        number of queries which failed during this scrape
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"mogilefs"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var flagTrackers = flag.String("trackers", "localhost:7001", "A list of trackers to use")
+var flagListen = flag.String("listen", ":9580", "Address to serve the metrics on")
+var flagDomains = flag.String("domains", "", "Domains to export the replication backlog of (default: all domains)")
+var flagBacklog = flag.Bool("backlog", true, "Export the replication backlog (uses the expensive 'stats' command)")
+
+func main() {
+	flag.Parse()
+	trackers := strings.Split(*flagTrackers, ",")
+
+	http.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		w.Write(collect(trackers))
+	})
+	log.Printf("serving metrics of %s on %s/metrics", *flagTrackers, *flagListen)
+	log.Fatal(http.ListenAndServe(*flagListen, nil))
+}
+
+// Accumulates metrics in the Prometheus text format
+type metrics struct {
+	// names of the metrics in the order they were added
+	names []string
+	// the HELP, TYPE and sample lines of each metric
+	lines  map[string]*bytes.Buffer
+	errors int
+}
+
+func (m *metrics) add(name string, help string, value float64, labels ...string) {
+	buf := m.lines[name]
+	if buf == nil {
+		buf = &bytes.Buffer{}
+		m.lines[name] = buf
+		m.names = append(m.names, name)
+		fmt.Fprintf(buf, "# HELP %s %s\n# TYPE %s gauge\n", name, help, name)
+	}
+	buf.WriteString(name)
+	if len(labels) > 0 {
+		pairs := make([]string, 0, len(labels)/2)
+		for i := 0; i+1 < len(labels); i += 2 {
+			pairs = append(pairs, labels[i]+"="+strconv.Quote(labels[i+1]))
+		}
+		buf.WriteString("{" + strings.Join(pairs, ",") + "}")
+	}
+	fmt.Fprintf(buf, " %s\n", strconv.FormatFloat(value, 'g', -1, 64))
+}
+
+// Returns all metrics, samples of the same metric grouped together
+func (m *metrics) bytes() []byte {
+	var out bytes.Buffer
+	for _, name := range m.names {
+		out.Write(m.lines[name].Bytes())
+	}
+	return out.Bytes()
+}
+
+func (m *metrics) failed(what string, err error) {
+	log.Printf("%s: %s", what, err)
+	m.errors++
+}
+
+// Queries the cluster and returns all metrics
+func collect(trackers []string) []byte {
+	m := &metrics{lines: make(map[string]*bytes.Buffer)}
+
+	for _, tracker := range trackers {
+		mc := mogilefs.New("", []string{tracker}, mogilefs.WithRetries(1))
+		err := mc.Ping(context.Background())
+		up := 1.0
+		if err != nil {
+			up = 0
+		}
+		m.add("mogilefs_tracker_up", "1 if the tracker answered a noop command", up, "tracker", tracker)
+	}
+
+	mc := mogilefs.New("", trackers)
+	if hosts, err := mc.GetHosts(); err == nil {
+		for _, host := range hosts {
+			m.add("mogilefs_host_status", "1 for the status of each host", 1, "hostid", strconv.Itoa(host.Hostid), "host", host.Hostname, "status", host.Status)
+		}
+	} else {
+		m.failed("get_hosts", err)
+	}
+
+	if devices, err := mc.GetDevices(); err == nil {
+		for _, dev := range devices {
+			devid, hostid := strconv.Itoa(dev.Devid), strconv.Itoa(dev.Hostid)
+			m.add("mogilefs_device_status", "1 for the status of each device", 1, "devid", devid, "hostid", hostid, "status", dev.Status)
+			m.add("mogilefs_device_observed_state", "1 for the observed state of each device", 1, "devid", devid, "state", dev.ObservedState)
+			m.add("mogilefs_device_total_bytes", "Size of the device", float64(dev.MbTotal)*1024*1024, "devid", devid, "hostid", hostid)
+			m.add("mogilefs_device_used_bytes", "Used space of the device", float64(dev.MbUsed)*1024*1024, "devid", devid, "hostid", hostid)
+			m.add("mogilefs_device_utilization", "IO utilization of the device in percent", dev.Utilization, "devid", devid, "hostid", hostid)
+			m.add("mogilefs_device_weight", "Weight of the device for new uploads", float64(dev.Weight), "devid", devid, "hostid", hostid)
+		}
+	} else {
+		m.failed("get_devices", err)
+	}
+
+	if *flagBacklog {
+		collectBacklog(m, mc, trackers)
+	}
+
+	m.add("mogilefs_scrape_errors", "Number of queries which failed during this scrape", float64(m.errors))
+	return m.bytes()
+}
+
+// Adds the replication backlog of each domain
+func collectBacklog(m *metrics, mc *mogilefs.MogileFsClient, trackers []string) {
+	var domains []string
+	if len(*flagDomains) > 0 {
+		domains = strings.Split(*flagDomains, ",")
+	} else if all, err := mc.GetDomains(); err == nil {
+		for _, domain := range all {
+			domains = append(domains, domain.Name)
+		}
+	} else {
+		m.failed("get_domains", err)
+	}
+	sort.Strings(domains)
+
+	for _, domain := range domains {
+		started := time.Now()
+		backlog, err := mogilefs.New(domain, trackers).ReplicationBacklog()
+		if err != nil {
+			m.failed("stats of "+domain, err)
+			continue
+		}
+		m.add("mogilefs_replication_backlog", "Files with fewer copies than required by their class", float64(backlog), "domain", domain)
+		m.add("mogilefs_replication_backlog_seconds", "Time it took to compute the replication backlog", time.Since(started).Seconds(), "domain", domain)
+	}
+}
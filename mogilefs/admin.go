@@ -0,0 +1,366 @@
+/*
+
+Copyright 2015 Adrian Ulrich
+Copyright 2015 Fixxpunkt AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package mogilefs
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+)
+
+// A storage class of a domain, as returned by GetDomains()
+type Class struct {
+	// Name of the class
+	Name string
+	// The minimum number of copies the tracker keeps of each file
+	Mindevcount int
+	// The replication policy, eg. 'MultipleHosts()'
+	Replpolicy string
+	// The checksum algorithm used by this class, 'NONE' if checksums are disabled
+	Hashtype string
+}
+
+// A domain, as returned by GetDomains()
+type Domain struct {
+	// Name of the domain
+	Name string
+	// All classes known to this domain (including the 'default' class)
+	Classes []Class
+}
+
+// A storage host, as returned by GetHosts()
+type Host struct {
+	// Numeric id of the host, assigned by the tracker
+	Hostid int
+	// Name of the host
+	Hostname string
+	// Status of the host: 'alive', 'dead' or 'down'
+	Status string
+	// IP of the storage daemon
+	Ip string
+	// HTTP port of the storage daemon
+	Port int
+	// Optional port used for GET requests, 0 if Port is used for all requests
+	GetPort int
+	// Optional alternative IP and netmask, used by get_paths for clients within AltMask
+	AltIp   string
+	AltMask string
+}
+
+// A storage device, as returned by GetDevices()
+type Device struct {
+	// Numeric id of the device
+	Devid int
+	// The host this device is attached to
+	Hostid int
+	// Administrative status: 'alive', 'dead', 'down', 'drain' or 'readonly'
+	Status string
+	// Status as observed by the monitor: 'writeable', 'readable' or 'unreachable'
+	ObservedState string
+	// Weight of the device for new uploads
+	Weight int
+	// Total and used space of the device in megabytes
+	MbTotal int
+	MbUsed  int
+	// IO utilization of the device in percent
+	Utilization float64
+}
+
+// Returns all domains (and their classes) known to the tracker.
+//
+// Note: unlike most other functions, this ignores the domain of the client.
+func (m *MogileFsClient) GetDomains() (domains []Domain, err error) {
+	values, err := m.DoRequest(cmd_get_domains, make(url.Values))
+
+	if err == nil {
+		for i := 1; i <= intValue(values, "domains"); i++ {
+			prefix := fmt.Sprintf("domain%d", i)
+			domain := Domain{Name: stringValue(values, prefix)}
+
+			for j := 1; j <= intValue(values, prefix+"classes"); j++ {
+				cprefix := fmt.Sprintf("%sclass%d", prefix, j)
+				domain.Classes = append(domain.Classes, Class{
+					Name:        stringValue(values, cprefix+"name"),
+					Mindevcount: intValue(values, cprefix+"mindevcount"),
+					Replpolicy:  stringValue(values, cprefix+"replpolicy"),
+					Hashtype:    stringValue(values, cprefix+"hashtype"),
+				})
+			}
+			domains = append(domains, domain)
+		}
+	}
+	return
+}
+
+// Creates a new domain
+func (m *MogileFsClient) CreateDomain(domain string) (err error) {
+	args := make(url.Values)
+	args.Add("domain", domain)
+
+	_, err = m.DoRequest(cmd_create_domain, args)
+	return
+}
+
+// Deletes an existing (and empty) domain
+func (m *MogileFsClient) DeleteDomain(domain string) (err error) {
+	args := make(url.Values)
+	args.Add("domain", domain)
+
+	_, err = m.DoRequest(cmd_delete_domain, args)
+	return
+}
+
+// Creates a new class in domain.
+//
+// Mindevcount, Replpolicy and Hashtype are optional: the tracker uses its defaults for
+// unset (zero) values.
+func (m *MogileFsClient) CreateClass(domain string, class Class) (created Class, err error) {
+	return m.doClassRequest(cmd_create_class, domain, class)
+}
+
+// Modifies an existing class of domain.
+//
+// Only fields with non-zero values are changed.
+func (m *MogileFsClient) ModifyClass(domain string, class Class) (modified Class, err error) {
+	return m.doClassRequest(cmd_update_class, domain, class)
+}
+
+// Deletes an existing (and unused) class of domain
+func (m *MogileFsClient) DeleteClass(domain string, class string) (err error) {
+	args := make(url.Values)
+	args.Add("domain", domain)
+	args.Add("class", class)
+
+	_, err = m.DoRequest(cmd_delete_class, args)
+	return
+}
+
+// doClassRequest runs a create or update command and returns the class as confirmed by the tracker
+func (m *MogileFsClient) doClassRequest(command string, domain string, class Class) (rv Class, err error) {
+	args := make(url.Values)
+	args.Add("domain", domain)
+	args.Add("class", class.Name)
+	if class.Mindevcount > 0 {
+		args.Add("mindevcount", fmt.Sprintf("%d", class.Mindevcount))
+	}
+	if len(class.Replpolicy) > 0 {
+		args.Add("replpolicy", class.Replpolicy)
+	}
+	if len(class.Hashtype) > 0 {
+		args.Add("hashtype", class.Hashtype)
+	}
+
+	values, err := m.DoRequest(command, args)
+	if err == nil {
+		// the tracker only echoes some of the fields: keep ours for everything else
+		rv = class
+		if len(stringValue(values, "class")) > 0 {
+			rv.Name = stringValue(values, "class")
+		}
+		if n := intValue(values, "mindevcount"); n > 0 {
+			rv.Mindevcount = n
+		}
+		if len(stringValue(values, "replpolicy")) > 0 {
+			rv.Replpolicy = stringValue(values, "replpolicy")
+		}
+		if len(stringValue(values, "hashtype")) > 0 {
+			rv.Hashtype = stringValue(values, "hashtype")
+		}
+	}
+	return
+}
+
+// Returns all storage hosts known to the tracker
+func (m *MogileFsClient) GetHosts() (hosts []Host, err error) {
+	values, err := m.DoRequest(cmd_get_hosts, make(url.Values))
+
+	if err == nil {
+		for i := 1; i <= intValue(values, "hosts"); i++ {
+			prefix := fmt.Sprintf("host%d_", i)
+			hosts = append(hosts, Host{
+				Hostid:   intValue(values, prefix+"hostid"),
+				Hostname: stringValue(values, prefix+"hostname"),
+				Status:   stringValue(values, prefix+"status"),
+				Ip:       stringValue(values, prefix+"hostip"),
+				Port:     intValue(values, prefix+"http_port"),
+				GetPort:  intValue(values, prefix+"http_get_port"),
+				AltIp:    stringValue(values, prefix+"altip"),
+				AltMask:  stringValue(values, prefix+"altmask"),
+			})
+		}
+	}
+	return
+}
+
+// Adds a new storage host.
+//
+// Hostname, Ip and Port are required, Hostid is assigned by the tracker and returned in created.
+func (m *MogileFsClient) CreateHost(host Host) (created Host, err error) {
+	return m.doHostRequest(cmd_create_host, host)
+}
+
+// Updates an existing storage host, identified by its Hostname.
+//
+// Only fields with non-zero values are changed.
+func (m *MogileFsClient) UpdateHost(host Host) (updated Host, err error) {
+	return m.doHostRequest(cmd_update_host, host)
+}
+
+// Removes a storage host (which must not have any devices left)
+func (m *MogileFsClient) DeleteHost(hostname string) (err error) {
+	args := make(url.Values)
+	args.Add("host", hostname)
+
+	_, err = m.DoRequest(cmd_delete_host, args)
+	return
+}
+
+// Returns all storage devices known to the tracker
+func (m *MogileFsClient) GetDevices() (devices []Device, err error) {
+	values, err := m.DoRequest(cmd_get_devices, make(url.Values))
+
+	if err == nil {
+		for i := 1; i <= intValue(values, "devices"); i++ {
+			prefix := fmt.Sprintf("dev%d_", i)
+			utilization, _ := strconv.ParseFloat(stringValue(values, prefix+"utilization"), 64)
+			devices = append(devices, Device{
+				Devid:         intValue(values, prefix+"devid"),
+				Hostid:        intValue(values, prefix+"hostid"),
+				Status:        stringValue(values, prefix+"status"),
+				ObservedState: stringValue(values, prefix+"observed_state"),
+				Weight:        intValue(values, prefix+"weight"),
+				MbTotal:       intValue(values, prefix+"mb_total"),
+				MbUsed:        intValue(values, prefix+"mb_used"),
+				Utilization:   utilization,
+			})
+		}
+	}
+	return
+}
+
+// Adds device devid to the storage host hostname.
+//
+// Set state to an empty string to use the default state of the tracker ('alive').
+func (m *MogileFsClient) CreateDevice(hostname string, devid int, state string) (err error) {
+	args := make(url.Values)
+	args.Add("hostname", hostname)
+	args.Add("devid", fmt.Sprintf("%d", devid))
+	if len(state) > 0 {
+		args.Add("state", state)
+	}
+
+	_, err = m.DoRequest(cmd_create_device, args)
+	return
+}
+
+// Changes the state of a device, eg. to 'drain' or 'dead'
+func (m *MogileFsClient) SetDeviceState(hostname string, devid int, state string) (err error) {
+	args := make(url.Values)
+	args.Add("host", hostname)
+	args.Add("device", fmt.Sprintf("%d", devid))
+	args.Add("state", state)
+
+	_, err = m.DoRequest(cmd_set_state, args)
+	return
+}
+
+// Changes the weight of a device
+func (m *MogileFsClient) SetDeviceWeight(hostname string, devid int, weight int) (err error) {
+	args := make(url.Values)
+	args.Add("host", hostname)
+	args.Add("device", fmt.Sprintf("%d", devid))
+	args.Add("weight", fmt.Sprintf("%d", weight))
+
+	_, err = m.DoRequest(cmd_set_weight, args)
+	return
+}
+
+// doHostRequest runs a create or update command and returns the host as confirmed by the tracker
+func (m *MogileFsClient) doHostRequest(command string, host Host) (rv Host, err error) {
+	args := make(url.Values)
+	args.Add("host", host.Hostname)
+	for k, v := range map[string]string{"ip": host.Ip, "status": host.Status, "altip": host.AltIp, "altmask": host.AltMask} {
+		if len(v) > 0 {
+			args.Add(k, v)
+		}
+	}
+	if host.Port > 0 {
+		args.Add("port", fmt.Sprintf("%d", host.Port))
+	}
+	if host.GetPort > 0 {
+		args.Add("getport", fmt.Sprintf("%d", host.GetPort))
+	}
+
+	values, err := m.DoRequest(command, args)
+	if err == nil {
+		rv = host
+		if n := intValue(values, "hostid"); n > 0 {
+			rv.Hostid = n
+		}
+	}
+	return
+}
+
+// Creates domain and class unless they already exist.
+//
+// Pass a Class with an empty Name to only create the domain. The Mindevcount,
+// Replpolicy and Hashtype of class are only used if the class has to be created.
+// This is intended for development environments and integration tests, see also WithAutoProvision().
+func (m *MogileFsClient) EnsureDomainAndClass(domain string, class Class) (err error) {
+	err = m.CreateDomain(domain)
+	if errors.Is(err, ErrDomainExists) {
+		err = nil
+	}
+
+	if err == nil && len(class.Name) > 0 && class.Name != "default" {
+		_, err = m.CreateClass(domain, class)
+		if errors.Is(err, ErrClassExists) {
+			err = nil
+		}
+	}
+	return
+}
+
+// Makes Create provision missing domains and classes using EnsureDomainAndClass().
+//
+// Classes are created using the Mindevcount, Replpolicy and Hashtype of defaults.
+// Never enable this in production: a typo in a class name creates a new class.
+func WithAutoProvision(defaults Class) Option {
+	return func(m *MogileFsClient) {
+		m.auto_provision = &defaults
+	}
+}
+
+/**
+ * @desc Creates the domain of the client and class if err says they are missing and auto provisioning is enabled
+ * @param class string the class which was used
+ * @param err error the error returned by the tracker
+ * @return provisioned bool true if the domain and class were created
+ */
+func (m *MogileFsClient) autoProvision(class string, err error) (provisioned bool) {
+	if m.auto_provision == nil {
+		return
+	}
+	if errors.Is(err, ErrUnregDomain) || errors.Is(err, ErrDomainNotFound) || errors.Is(err, ErrUnregClass) {
+		defaults := *m.auto_provision
+		defaults.Name = class
+		provisioned = m.EnsureDomainAndClass(m.domain, defaults) == nil
+	}
+	return
+}
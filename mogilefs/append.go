@@ -0,0 +1,63 @@
+/*
+
+Copyright 2015 Adrian Ulrich
+Copyright 2015 Fixxpunkt AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package mogilefs
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"time"
+)
+
+// Appends the contents of r to key, creating key if it does not exist.
+//
+// MogileFS files are immutable: the existing contents are streamed from a storage node
+// and uploaded together with r as a new file, which replaces key atomically once complete
+// (readers see either the old or the new contents). The class of key is kept. Appending
+// costs a full copy of the file, so this suits small log-like files, not large ones.
+//
+// Appends are serialized using an advisory lock (see AcquireKeyLock), which protects key
+// from concurrent appends of all clients using Append. Returns the new size of key.
+func (m *MogileFsClient) Append(key string, r io.Reader) (size int64, err error) {
+	lock, err := m.AcquireKeyLock(key, time.Duration(5)*time.Minute)
+	if err != nil {
+		return
+	}
+	defer lock.Release()
+
+	class := ""
+	info, err := m.FileInfo(key)
+	if err == nil {
+		class = info.Class
+	} else if !errors.Is(err, ErrUnknownKey) && !errors.Is(err, ErrUnknownCommand) {
+		return
+	}
+
+	existing, err := m.Fetch(key)
+	if errors.Is(err, ErrUnknownKey) {
+		existing, err = io.NopCloser(strings.NewReader("")), nil
+	}
+	if err != nil {
+		return
+	}
+	defer existing.Close()
+
+	result, err := m.CreateWithResult(key, class, io.MultiReader(existing, r), nil)
+	size = result.Size
+	return
+}
@@ -0,0 +1,73 @@
+/*
+
+Copyright 2015 Adrian Ulrich
+Copyright 2015 Fixxpunkt AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package mogilefs
+
+import (
+	"context"
+	"net/url"
+	"time"
+)
+
+// Commands which do not modify anything: all other commands are audited
+var readonly_commands = map[string]bool{
+	cmd_getpaths:    true,
+	cmd_debug:       true,
+	cmd_list_keys:   true,
+	cmd_get_domains: true,
+	cmd_get_hosts:   true,
+	cmd_get_devices: true,
+	cmd_file_info:   true,
+	cmd_stats:       true,
+	cmd_noop:        true,
+}
+
+// A modifying tracker command, passed to the audit hook
+type AuditEvent struct {
+	// When the command was issued
+	Time time.Time
+	// The tracker command, eg. 'delete'
+	Command string
+	// The arguments of the command
+	Args url.Values
+	// Time it took to execute the command (including retries)
+	Duration time.Duration
+	// The error returned by the command - nil on success
+	Err error
+}
+
+// Calls hook after each command which modifies the filesystem (uploads, deletes, renames and all admin commands).
+//
+// hook is called with the context of the request: use the *Context variants of the
+// client functions (eg. DeleteContext) or DoRequestContext to pass values such as user
+// or request ids to the hook. Functions without a context pass context.Background().
+// Custom commands sent with DoRequest are audited unless they are known to be read-only.
+// hook is called synchronously and must be safe for concurrent use.
+func WithAuditHook(hook func(ctx context.Context, event AuditEvent)) Option {
+	return func(m *MogileFsClient) {
+		m.audit_hook = hook
+	}
+}
+
+/**
+ * @desc Passes a finished command to the audit hook if it modified the filesystem
+ */
+func (m *MogileFsClient) audit(ctx context.Context, command string, args url.Values, started time.Time, err error) {
+	if m.audit_hook != nil && !readonly_commands[command] {
+		m.audit_hook(ctx, AuditEvent{Time: started, Command: command, Args: args, Duration: time.Since(started), Err: err})
+	}
+}
@@ -0,0 +1,379 @@
+/*
+
+Copyright 2015 Adrian Ulrich
+Copyright 2015 Fixxpunkt AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+/*
+Package bigfile reads and writes files using the chunk format of 'mogtool --bigfile'.
+
+mogtool splits big files into chunks stored as 'key,1', 'key,2', ... and
+describes them in a plain text info file stored as '_big_info:key'.
+
+Example:
+
+	mc := mogilefs.New(domain, trackers)
+	r, err := bigfile.Fetch(mc, "backup.tar")
+*/
+package bigfile
+
+import (
+	"bufio"
+	"compress/gzip"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/adrian-bl/golang-mogilefs-client/mogilefs"
+)
+
+const (
+	// The chunk size used by mogtool if none was specified
+	DefaultChunkSize = 64 * 1024 * 1024
+)
+
+// Describes a big file, as stored in its info file
+type Info struct {
+	// Free text description
+	Description string
+	// Type of the stored data: 'file', 'tarball' or 'partition'
+	Type string
+	// True if the chunks contain a gzip compressed stream
+	Compressed bool
+	// Original filename of the stored data
+	Filename string
+	// Total size of all chunks
+	Size int64
+	// All chunks of the file, in order
+	Parts []Part
+}
+
+// A single chunk of a big file
+type Part struct {
+	// Number of this chunk, starting at 1
+	Number int
+	// Size of this chunk
+	Bytes int64
+	// Hex encoded md5 sum of this chunk
+	Md5 string
+	// Paths of this chunk at the time it was stored
+	Paths []string
+}
+
+// Optional argument to the Store function
+type StoreOpts struct {
+	// Size of each chunk, defaults to the ChunkSize of the class (see mogilefs.WithClassDefaults) or DefaultChunkSize
+	ChunkSize int64
+	// Description to record in the info file
+	Description string
+	// Filename to record in the info file
+	Filename string
+	// Gzip compress the data before splitting it into chunks
+	Compress bool
+}
+
+var reInfoPart = regexp.MustCompile("^part (\\d+) bytes=(\\d+) md5=(\\S+) paths: (.*)$")
+
+// Returns the key of the info file of key
+func InfoKey(key string) string {
+	return "_big_info:" + key
+}
+
+// Returns the key of the n'th chunk of key
+func ChunkKey(key string, n int) string {
+	return fmt.Sprintf("%s,%d", key, n)
+}
+
+// Returns the key of the marker written while an upload is in progress
+func PreKey(key string) string {
+	return "_big_pre:" + key
+}
+
+// Parses an info file as written by mogtool
+func ParseInfo(r io.Reader) (info *Info, err error) {
+	info = &Info{}
+	chunks := -1
+	scanner := bufio.NewScanner(r)
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		if match := reInfoPart.FindStringSubmatch(line); match != nil {
+			part := Part{Md5: match[3]}
+			part.Number, _ = strconv.Atoi(match[1])
+			part.Bytes, _ = strconv.ParseInt(match[2], 10, 64)
+			for _, path := range strings.Split(match[4], ",") {
+				if path = strings.TrimSpace(path); len(path) > 0 {
+					part.Paths = append(part.Paths, path)
+				}
+			}
+			info.Parts = append(info.Parts, part)
+			continue
+		}
+
+		field := strings.SplitN(line, " ", 2)
+		if len(field) != 2 {
+			continue
+		}
+		switch field[0] {
+		case "des":
+			info.Description = field[1]
+		case "type":
+			info.Type = field[1]
+		case "compressed":
+			info.Compressed = field[1] == "1"
+		case "filename":
+			info.Filename = field[1]
+		case "chunks":
+			chunks, _ = strconv.Atoi(field[1])
+		case "size":
+			info.Size, _ = strconv.ParseInt(field[1], 10, 64)
+		}
+	}
+
+	err = scanner.Err()
+	if err == nil && chunks != len(info.Parts) {
+		err = fmt.Errorf("bigfile:info file lists %d of %d chunks", len(info.Parts), chunks)
+	}
+	for i := 0; err == nil && i < len(info.Parts); i++ {
+		if info.Parts[i].Number != i+1 {
+			err = fmt.Errorf("bigfile:unexpected chunk number %d at position %d", info.Parts[i].Number, i+1)
+		}
+	}
+	return
+}
+
+// Returns the info file in the format written by mogtool
+func (info *Info) String() string {
+	s := fmt.Sprintf("des %s\ntype %s\ncompressed %d\nfilename %s\nchunks %d\nsize %d\n\n",
+		info.Description, info.Type, boolToInt(info.Compressed), info.Filename, len(info.Parts), info.Size)
+	for _, part := range info.Parts {
+		s += fmt.Sprintf("part %d bytes=%d md5=%s paths: %s\n", part.Number, part.Bytes, part.Md5, strings.Join(part.Paths, ", "))
+	}
+	return s
+}
+
+// Downloads and parses the info file of key
+func GetInfo(mc *mogilefs.MogileFsClient, key string) (info *Info, err error) {
+	r, err := mc.Fetch(InfoKey(key))
+	if err == nil {
+		info, err = ParseInfo(r)
+		r.Close()
+	}
+	return
+}
+
+// Returns an io.ReadCloser with the contents of a big file.
+//
+// The md5 sum of each chunk is verified while reading and compressed files are
+// decompressed transparently.
+func Fetch(mc *mogilefs.MogileFsClient, key string) (r io.ReadCloser, err error) {
+	info, err := GetInfo(mc, key)
+	if err == nil {
+		r = &chunkReader{mc: mc, key: key, info: info}
+		if info.Compressed {
+			var gz *gzip.Reader
+			gz, err = gzip.NewReader(r)
+			if err == nil {
+				r = &gzipReadCloser{Reader: gz, parent: r}
+			} else {
+				r.Close()
+				r = nil
+			}
+		}
+	}
+	return
+}
+
+// Stores the contents of r as big file, readable by mogtool.
+//
+// Note: the data is streamed to the storage nodes: Store does not buffer whole chunks in memory.
+func Store(mc *mogilefs.MogileFsClient, key string, class string, r io.Reader, opts *StoreOpts) (info *Info, err error) {
+	if opts == nil {
+		opts = &StoreOpts{}
+	}
+	if defaults, ok := mc.ClassDefaults(class); ok && opts.ChunkSize <= 0 {
+		opts.ChunkSize = defaults.ChunkSize
+	}
+	if opts.ChunkSize <= 0 {
+		opts.ChunkSize = DefaultChunkSize
+	}
+
+	info = &Info{Description: opts.Description, Type: "file", Compressed: opts.Compress, Filename: opts.Filename}
+	if len(info.Description) == 0 {
+		info.Description = "no description"
+	}
+
+	if opts.Compress {
+		pr, pw := io.Pipe()
+		go func(src io.Reader) {
+			gz := gzip.NewWriter(pw)
+			_, cerr := io.Copy(gz, src)
+			if cerr == nil {
+				cerr = gz.Close()
+			}
+			pw.CloseWithError(cerr)
+		}(r)
+		defer pr.Close()
+		r = pr
+	}
+
+	_, err = mc.Create(PreKey(key), class, strings.NewReader(fmt.Sprintf("starttime:%d", time.Now().Unix())))
+	br := bufio.NewReader(r)
+
+	for n := 1; err == nil; n++ {
+		if n > 1 {
+			if _, perr := br.Peek(1); perr == io.EOF {
+				break
+			}
+		}
+
+		hasher := md5.New()
+		cr := &countingReader{r: io.TeeReader(io.LimitReader(br, opts.ChunkSize), hasher)}
+		_, err = mc.Create(ChunkKey(key, n), class, cr)
+		if err == nil {
+			part := Part{Number: n, Bytes: cr.nbytes, Md5: hex.EncodeToString(hasher.Sum(nil))}
+			part.Paths, err = mc.GetPaths(ChunkKey(key, n), nil)
+			info.Parts = append(info.Parts, part)
+			info.Size += part.Bytes
+		}
+	}
+
+	if err == nil {
+		_, err = mc.Create(InfoKey(key), class, strings.NewReader(info.String()))
+	}
+	if err == nil {
+		err = mc.Delete(PreKey(key))
+	}
+	return
+}
+
+// Deletes the info file and all chunks of key
+func Delete(mc *mogilefs.MogileFsClient, key string) (err error) {
+	info, err := GetInfo(mc, key)
+	if err == nil {
+		err = mc.Delete(InfoKey(key))
+		for _, part := range info.Parts {
+			if derr := mc.Delete(ChunkKey(key, part.Number)); err == nil {
+				err = derr
+			}
+		}
+	}
+	return
+}
+
+// chunkReader returns the concatenated contents of all chunks of a big file
+type chunkReader struct {
+	mc      *mogilefs.MogileFsClient
+	key     string
+	info    *Info
+	current int
+	body    io.ReadCloser
+	hasher  hash.Hash
+	nbytes  int64
+}
+
+func (cr *chunkReader) Read(buffer []byte) (nr int, err error) {
+	for nr == 0 && err == nil {
+		if cr.body == nil {
+			if cr.current == len(cr.info.Parts) {
+				return 0, io.EOF
+			}
+			cr.body, err = cr.openPart(cr.info.Parts[cr.current])
+			cr.hasher = md5.New()
+			cr.nbytes = 0
+			continue
+		}
+
+		nr, err = cr.body.Read(buffer)
+		cr.hasher.Write(buffer[:nr])
+		cr.nbytes += int64(nr)
+
+		if err == io.EOF {
+			err = cr.finishPart(cr.info.Parts[cr.current])
+		}
+	}
+	return
+}
+
+func (cr *chunkReader) Close() (err error) {
+	if cr.body != nil {
+		err = cr.body.Close()
+		cr.body = nil
+	}
+	return
+}
+
+// openPart fetches a chunk, falling back to the paths recorded in the info file
+func (cr *chunkReader) openPart(part Part) (r io.ReadCloser, err error) {
+	r, err = cr.mc.Fetch(ChunkKey(cr.key, part.Number))
+	for i := 0; err != nil && i < len(part.Paths); i++ {
+		resp, gerr := cr.mc.HTTPClient().Get(part.Paths[i])
+		if gerr == nil {
+			if resp.StatusCode >= 200 && resp.StatusCode <= 299 {
+				r, err = resp.Body, nil
+			} else {
+				resp.Body.Close()
+			}
+		}
+	}
+	return
+}
+
+// finishPart verifies the chunk just read and advances to the next one
+func (cr *chunkReader) finishPart(part Part) (err error) {
+	cr.body.Close()
+	cr.body = nil
+	cr.current++
+
+	if cr.nbytes != part.Bytes {
+		err = fmt.Errorf("bigfile:chunk %d has %d bytes, expected %d", part.Number, cr.nbytes, part.Bytes)
+	} else if sum := hex.EncodeToString(cr.hasher.Sum(nil)); sum != part.Md5 {
+		err = fmt.Errorf("bigfile:chunk %d has md5 %s, expected %s", part.Number, sum, part.Md5)
+	}
+	return
+}
+
+type gzipReadCloser struct {
+	*gzip.Reader
+	parent io.Closer
+}
+
+func (g *gzipReadCloser) Close() error {
+	g.Reader.Close()
+	return g.parent.Close()
+}
+
+type countingReader struct {
+	r      io.Reader
+	nbytes int64
+}
+
+func (cr *countingReader) Read(buffer []byte) (nr int, err error) {
+	nr, err = cr.r.Read(buffer)
+	cr.nbytes += int64(nr)
+	return
+}
+
+func boolToInt(value bool) (rv int) {
+	if value {
+		rv = 1
+	}
+	return
+}
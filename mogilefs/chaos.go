@@ -0,0 +1,79 @@
+/*
+
+Copyright 2015 Adrian Ulrich
+Copyright 2015 Fixxpunkt AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package mogilefs
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// Fault injection settings used to rehearse a degraded cluster, see SetChaos().
+//
+// Never enable this in production.
+type ChaosOpts struct {
+	// Delay added to each tracker command
+	Latency time.Duration
+	// Upper limit of an additional random delay added to each tracker command
+	Jitter time.Duration
+	// Probability (0.0 - 1.0) of failing a tracker command without sending it
+	FailureRate float64
+	// Failure rate of specific commands (eg. "create_open"), overriding FailureRate
+	CommandFailureRates map[string]float64
+}
+
+// Enables fault injection with the given settings, see SetChaos()
+func WithChaos(opts ChaosOpts) Option {
+	return func(m *MogileFsClient) {
+		m.SetChaos(&opts)
+	}
+}
+
+// Enables (or disables, if opts is nil) fault injection.
+//
+// This may be called at any time, even while other goroutines use the client.
+func (m *MogileFsClient) SetChaos(opts *ChaosOpts) {
+	m.chaos.Store(opts)
+}
+
+/**
+ * @desc Delays and randomly fails a tracker command as configured by SetChaos()
+ * @param command string the tracker command about to be executed
+ * @return err error an injected failure, nil if the command should be executed
+ */
+func (m *MogileFsClient) injectChaos(command string) (err error) {
+	opts, _ := m.chaos.Load().(*ChaosOpts)
+	if opts == nil {
+		return
+	}
+
+	delay := opts.Latency
+	if opts.Jitter > 0 {
+		delay += time.Duration(rand.Int63n(int64(opts.Jitter)))
+	}
+	time.Sleep(delay)
+
+	rate, ok := opts.CommandFailureRates[command]
+	if !ok {
+		rate = opts.FailureRate
+	}
+	if rand.Float64() < rate {
+		err = fmt.Errorf("chaos:injected failure of %s", command)
+	}
+	return
+}
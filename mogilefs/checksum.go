@@ -0,0 +1,143 @@
+/*
+
+Copyright 2015 Adrian Ulrich
+Copyright 2015 Fixxpunkt AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package mogilefs
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"log/slog"
+	"time"
+)
+
+// How long Create uploads without checksums before retrying to load the class policies
+const class_policy_retry = time.Minute
+
+const (
+	hashtype_none = "NONE"
+	hashtype_md5  = "MD5"
+)
+
+// Loads the checksum policy (hashtype) of all classes of the client's domain.
+//
+// Create uses these policies to compute and send the checksum required by a class. The policies
+// are loaded on the first call to Create if this function was not called before, calling it
+// at startup makes misconfigured classes fail early. If Create can not load the policies, it
+// logs a warning and uploads without checksums, retrying to load them after a minute.
+func (m *MogileFsClient) LoadClassPolicies() (err error) {
+	err = m.loadClassHashtypes()
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for class, hashtype := range m.class_hashtypes {
+		if _, herr := newChecksumHash(hashtype); err == nil && herr != nil {
+			err = fmt.Errorf("%s (class %s)", herr, class)
+		}
+	}
+	return
+}
+
+/**
+ * @desc Fetches the hashtype of all classes of our domain from the tracker
+ */
+func (m *MogileFsClient) loadClassHashtypes() (err error) {
+	domains, err := m.GetDomains()
+	if err == nil {
+		hashtypes := make(map[string]string)
+		for _, domain := range domains {
+			if domain.Name == m.domain {
+				for _, class := range domain.Classes {
+					hashtypes[class.Name] = class.Hashtype
+				}
+			}
+		}
+		m.mutex.Lock()
+		m.class_hashtypes = hashtypes
+		m.mutex.Unlock()
+	}
+	return
+}
+
+/**
+ * @desc Returns the hashtype required by class, loading the class policies if needed
+ * @param class string name of the class, an empty string selects the default class
+ * @return hashtype string the hashtype, an empty string if none is required or the policies can not be loaded
+ */
+func (m *MogileFsClient) classHashtype(class string) (hashtype string) {
+	m.mutex.Lock()
+	load := m.class_hashtypes == nil && time.Since(m.class_hashtypes_failed) >= class_policy_retry
+	m.mutex.Unlock()
+
+	// uploads must not depend on get_domains: without policies, upload without a checksum
+	if load {
+		if err := m.loadClassHashtypes(); err != nil {
+			m.mutex.Lock()
+			m.class_hashtypes_failed = time.Now()
+			m.mutex.Unlock()
+			m.logger.Warn("mogilefs: can not load class policies, uploading without checksums", slog.Any("error", err))
+		}
+	}
+	if len(class) == 0 {
+		class = "default"
+	}
+
+	m.mutex.Lock()
+	hashtype = m.class_hashtypes[class]
+	m.mutex.Unlock()
+	if hashtype == hashtype_none {
+		hashtype = ""
+	}
+	return
+}
+
+/**
+ * @desc Returns a new hash.Hash implementing the given mogilefs hashtype: mogilefsd only supports MD5
+ * @param hashtype string name of the hashtype as used by mogilefsd
+ * @return h hash.Hash the hash, nil if hashtype is empty or 'NONE'
+ * @return err error set if the hashtype is not supported by this client
+ */
+func newChecksumHash(hashtype string) (h hash.Hash, err error) {
+	switch hashtype {
+	case "", hashtype_none:
+	case hashtype_md5:
+		h = md5.New()
+	default:
+		err = fmt.Errorf("internal:unsupported hashtype %s", hashtype)
+	}
+	return
+}
+
+/**
+ * @desc Returns the checksum as expected by create_close, eg. 'MD5:d41d8cd98f00b204e9800998ecf8427e'
+ */
+func checksumString(hashtype string, h hash.Hash) string {
+	return hashtype + ":" + hex.EncodeToString(h.Sum(nil))
+}
+
+/**
+ * @desc Returns ErrChecksumMismatch (wrapping err) if err is a storage node rejecting the Content-MD5 of an upload
+ */
+func checksumRejection(err error) error {
+	var serr *StorageError
+	if errors.As(err, &serr) && (serr.StatusCode == 400 || serr.StatusCode == 422) {
+		return fmt.Errorf("%w: %w", ErrChecksumMismatch, err)
+	}
+	return err
+}
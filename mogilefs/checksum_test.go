@@ -0,0 +1,143 @@
+/*
+
+Copyright 2015 Adrian Ulrich
+Copyright 2015 Fixxpunkt AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package mogilefs
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Counts the tracker commands sent
+type commandCounter struct {
+	mutex    sync.Mutex
+	commands map[string]int
+}
+
+func (c *commandCounter) BeforeRequest(ctx context.Context, info *RequestInfo) context.Context {
+	return ctx
+}
+
+func (c *commandCounter) AfterRequest(ctx context.Context, info *RequestInfo, duration time.Duration, err error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if info.Kind == RequestTracker {
+		c.commands[info.Command]++
+	}
+}
+
+func (c *commandCounter) count(command string) int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.commands[command]
+}
+
+/**
+ * @desc Returns a client of a tracker answering get_domains with domains (an error if empty) and accepting all uploads
+ */
+func newUploadClient(t *testing.T, domains string) (*MogileFsClient, *commandCounter) {
+	t.Helper()
+	storage := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	t.Cleanup(storage.Close)
+
+	replies := map[string]string{
+		"create_open":  "OK " + url.Values{"fid": {"7"}, "devid": {"1"}, "path": {storage.URL + "/dev1/0000000007.fid"}}.Encode(),
+		"create_close": "OK ",
+	}
+	if len(domains) > 0 {
+		replies["get_domains"] = "OK " + domains
+	}
+	counter := &commandCounter{commands: make(map[string]int)}
+	return New("test", []string{newCannedTracker(t, replies)}, WithHooks(counter)), counter
+}
+
+func TestCreateWithoutClassPolicies(t *testing.T) {
+	m, counter := newUploadClient(t, "")
+	for i := 0; i < 3; i++ {
+		if _, err := m.Create("k", "", strings.NewReader("data")); err != nil {
+			t.Fatalf("upload %d without class policies: %v", i, err)
+		}
+	}
+	// the failure is remembered instead of asking the tracker on each upload
+	if n := counter.count(cmd_get_domains); n != 1 {
+		t.Errorf("get_domains was sent %d times, want 1", n)
+	}
+}
+
+func TestCreateUnsupportedHashtype(t *testing.T) {
+	m, counter := newUploadClient(t, "domains=1&domain1=test&domain1classes=1&domain1class1name=default&domain1class1mindevcount=2&domain1class1hashtype=SHA-256")
+	if _, err := m.Create("k", "", strings.NewReader("data")); err == nil {
+		t.Fatalf("uploaded to a class requiring an unsupported hashtype")
+	}
+	if n := counter.count(cmd_create_open); n != 0 {
+		t.Errorf("create_open was sent %d times, want none", n)
+	}
+}
+
+func TestCreateWithSizeStreamChecksum(t *testing.T) {
+	var mutex sync.Mutex
+	var content_length int64
+	var chunked bool
+	storage := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		mutex.Lock()
+		content_length, chunked = r.ContentLength, len(r.TransferEncoding) > 0
+		mutex.Unlock()
+		w.WriteHeader(http.StatusCreated)
+	}))
+	t.Cleanup(storage.Close)
+
+	var checksum string
+	tracker := newScriptedTracker(t, func(command string, args url.Values) string {
+		switch command {
+		case "create_open":
+			return "OK " + url.Values{"fid": {"7"}, "devid": {"1"}, "path": {storage.URL + "/dev1/0000000007.fid"}}.Encode()
+		case "create_close":
+			mutex.Lock()
+			checksum = args.Get("checksum")
+			mutex.Unlock()
+			return "OK "
+		}
+		return "ERR unknown_command unknown"
+	})
+	m := New("test", []string{tracker})
+
+	// a reader which does not implement io.Seeker
+	r := io.MultiReader(strings.NewReader("data"))
+	if _, err := m.CreateWithOpts("k", "", r, &CreateOpts{Size: 4, Checksum: "MD5"}); err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if content_length != 4 || chunked {
+		t.Errorf("upload sent Content-Length %d (chunked: %v), want 4", content_length, chunked)
+	}
+	if checksum != "MD5:8d777f385d3dfec8815d20f7496026dc" {
+		t.Errorf("create_close sent checksum %q", checksum)
+	}
+}
@@ -0,0 +1,67 @@
+/*
+
+Copyright 2015 Adrian Ulrich
+Copyright 2015 Fixxpunkt AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package mogilefs
+
+// Upload settings applied to all uploads of a class, see WithClassDefaults()
+type ClassDefaults struct {
+	// Content-Type sent to the storage nodes - an empty string for none
+	ContentType string
+	// Checksum to compute, see CreateOpts.Checksum
+	Checksum string
+	// Size of the chunks used by chunked uploads (eg. the bigfile package), 0 for their default
+	ChunkSize int64
+}
+
+// Registers defaults for uploads to class.
+//
+// The defaults are used by Create for all settings the caller did not set in CreateOpts,
+// so services sharing a client (or a set of options) share the conventions of each class.
+// Pass the option multiple times to configure multiple classes.
+func WithClassDefaults(class string, defaults ClassDefaults) Option {
+	return func(m *MogileFsClient) {
+		if m.class_defaults == nil {
+			m.class_defaults = make(map[string]ClassDefaults)
+		}
+		m.class_defaults[class] = defaults
+	}
+}
+
+// Returns the defaults registered for class, see WithClassDefaults()
+func (m *MogileFsClient) ClassDefaults(class string) (defaults ClassDefaults, ok bool) {
+	defaults, ok = m.class_defaults[class]
+	return
+}
+
+/**
+ * @desc Returns a copy of opts with all unset settings taken from the defaults of class
+ */
+func (m *MogileFsClient) applyClassDefaults(class string, opts *CreateOpts) *CreateOpts {
+	rv := CreateOpts{}
+	if opts != nil {
+		rv = *opts
+	}
+	if defaults, ok := m.ClassDefaults(class); ok {
+		if len(rv.Checksum) == 0 {
+			rv.Checksum = defaults.Checksum
+		}
+		if len(rv.ContentType) == 0 {
+			rv.ContentType = defaults.ContentType
+		}
+	}
+	return &rv
+}
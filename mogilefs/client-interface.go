@@ -0,0 +1,38 @@
+/*
+
+Copyright 2015 Adrian Ulrich
+Copyright 2015 Fixxpunkt AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package mogilefs
+
+import (
+	"io"
+	"net/url"
+)
+
+// The basic operations on keys, implemented by *MogileFsClient.
+//
+// Depend on Client instead of *MogileFsClient to replace the client in unit tests, eg. by
+// mogiletest.FakeClient.
+type Client interface {
+	GetPaths(key string, opts *GetPathsOpts) (paths []string, err error)
+	Fetch(key string) (r io.ReadCloser, err error)
+	Create(key string, class string, r io.Reader) (close_values url.Values, err error)
+	Delete(key string) (err error)
+	Rename(oldname string, newname string) (err error)
+	ListKeys(prefix string, after string, limit int) (keys []string, next_after string, err error)
+}
+
+var _ Client = (*MogileFsClient)(nil)
@@ -19,79 +19,352 @@ limitations under the License.
 Package mogilefs implements a mogilefs client library.
 
 Example:
+
 	mc := mogilefs.New(domain, trackers)
 	mc.Create("new-key", "custom-class", os.Stdin);
 */
 package mogilefs
 
 import (
+	"context"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"net/url"
+	"sort"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 // MogileFsClient structure returned by New()
+//
+// A MogileFsClient is safe for concurrent use by multiple goroutines and
+// should be shared instead of creating a new client for each request.
 type MogileFsClient struct {
+	// Protects last_tracker, client_id, class_hashtypes and storage_hook
+	mutex sync.Mutex
 	// The domain used by this instance
 	domain string
 	// A list of trackers we should try to connect
 	trackers []string
 	// A list of known broken trackers
-	dead_trackers map[string]time.Time
+	dead_trackers *blacklist
 	// The last tracker used by us - may be an empty string
 	last_tracker string
 	// Generic timeout for dial
 	dial_timeout time.Duration
+	// Timeouts of reading from and writing to a tracker connection, 0 for none
+	read_timeout  time.Duration
+	write_timeout time.Duration
+	// Identity sent along with each tracker command - may be an empty string
+	client_id string
+	// Hashtype of each class of our domain, nil if not loaded yet
+	class_hashtypes map[string]string
+	// When loading class_hashtypes failed the last time
+	class_hashtypes_failed time.Time
+	// Called with each response of a storage node - may be nil
+	storage_hook func(resp *http.Response)
+	// Client used for all requests to storage nodes
+	http_client *http.Client
+	// Defaults used by GetPaths if the caller did not specify them
+	default_pathcount int
+	default_noverify  bool
+	// Return errors on empty or nil arguments instead of using defaults
+	strict bool
+	// Fault injection settings (*ChaosOpts) - may hold nil
+	chaos atomic.Value
+	// Number of attempts of a tracker command and the delay between them
+	retry_attempts     int
+	retry_backoff_base time.Duration
+	retry_backoff_max  time.Duration
+	// How often an upload to a storage node is attempted, see WithStorageRetries
+	put_attempts int
+	// Free space of the devices used to pick upload destinations - nil if disabled
+	free_space *freeSpace
+	// Keys currently uploaded by Create
+	create_locks keyLocks
+	// Fail instead of waiting for a concurrent Create of the same key
+	reject_concurrent_creates bool
+	// Moves data from and to the storage nodes
+	transport StorageTransport
+	// Last known paths returned if no tracker can be reached - may be nil
+	stale_paths   *pathCache
+	stale_max_age time.Duration
+	// Defaults of domains and classes created by Create - nil if disabled
+	auto_provision *Class
+	// Concurrent GetOrCreate calls generating the same key
+	generate_flights flightGroup
+	// Concurrent lookups of the same paths
+	path_flights flightGroup
+	// Lifetime of the lock held while generating a key
+	generate_lock_ttl time.Duration
+	// Delays uploads while replication is behind - nil if disabled
+	pacing *pacer
+	// Limits the concurrent tracker connections
+	pool *TrackerPool
+	// Priority of requests which do not specify one
+	priority Priority
+	// How keys are sent to the trackers
+	key_encoding KeyEncoding
+	// Orders the paths of a key - may be nil
+	path_sorter PathSorter
+	// Running transfers, see Close()
+	lifecycle *lifecycle
+	// Standby cluster used for reads - nil if not configured
+	failover *failover
+	// Decides in which order trackers are tried
+	selector TrackerSelector
+	// Send get_paths to two trackers, see WithHedgedGetPaths()
+	hedge_getpaths bool
+	hedge_delay    time.Duration
+	// Paths which recently failed - nil if disabled
+	failed_paths *blacklist
+	// Storage nodes failing repeatedly - nil if disabled
+	dead_storage *storageBlacklist
+	// Interval of the background tracker checks, 0 if disabled
+	health_interval time.Duration
+	// Called after each modifying command - may be nil
+	audit_hook func(ctx context.Context, event AuditEvent)
+	// Receives lifecycle events of keys - nil if disabled
+	event_sink EventSink
+	// Opens tracker connections - nil to connect directly
+	dialer Dialer
+	// Per-tracker connection settings, keyed by tracker - nil if none
+	tracker_configs map[string]TrackerConfig
+	// Upload settings of each class - nil if none
+	class_defaults map[string]ClassDefaults
+	// Observe all requests
+	hooks []Hooks
+	// Receives the number of bytes transferred, may be nil
+	metrics MetricsCollector
+	// Abort storage transfers not moving any data for this long, 0 for no limit
+	storage_idle_timeout time.Duration
+	// Receives debug logs
+	logger *slog.Logger
+	// Writes the raw tracker protocol, may be nil
+	wire_debug *wireDebug
+	// Class of uploads not specifying one
+	default_class string
+	// Uploads of at most this many bytes are read into memory first, see WithTinyObjects
+	tiny_threshold int64
+	// Uploads of more than this many bytes send Expect: 100-continue, see WithExpectContinue
+	expect_threshold int64
+	// Restricts redirects of storage requests - nil for the default of net/http
+	redirect_policy *redirectPolicy
+	// Recently returned paths - nil if disabled
+	path_cache     PathCache
+	path_cache_ttl time.Duration
+	// Changes of keys with lookups in flight, which must not cache what they looked up
+	path_generations pathGenerations
 }
 
 // Optional argument to the GetPaths function
 type GetPathsOpts struct {
-	// Only return the tracker response - do not verify that the file actually exists
+	// Only return the tracker response - do not verify that the file actually exists.
+	//
+	// If false, the tracker is asked to verify the paths and the client checks all
+	// returned paths at once: paths which can not be read are dropped and the others
+	// are ordered by the latency of their storage nodes, fastest first.
 	NoVerify bool
-	// The number of paths to return. Defaults to 2 (the minimum)
+	// The number of paths to return. Defaults to 2 (the minimum) unless changed by WithPathcountDefault
 	Pathcount int
+	// Network zone of the client (eg. 'alt'): trackers return the paths appropriate for this zone first. Optional
+	Zone string
+	// IP address of the client the paths are looked up for, used by trackers to pick the zone. Optional
+	ClientIP string
+}
+
+// Result of LookupPaths
+type PathsResult struct {
+	// The paths of the key
+	Paths []string
+	// True if no tracker could be reached and Paths are the last known paths of the key, see WithStalePaths()
+	Stale bool
+	// When Paths were returned by a tracker
+	Fetched time.Time
+	// Size of the file as reported by the storage nodes, -1 if unknown (the paths were not verified)
+	Size int64
+	// Details about each of Paths (in the same order)
+	Details []Path
+	// True if the paths were returned by the standby cluster, see WithStandby()
+	Standby bool
+	// True if the paths were taken from the path cache, see WithPathCache()
+	Cached bool
 }
 
 // Returns a new MogileFsClient.
-func New(domain string, trackers []string) *MogileFsClient {
-	return &MogileFsClient{
-		domain:        domain,
-		trackers:      trackers,
-		dial_timeout:  time.Duration(1) * time.Second,
-		dead_trackers: make(map[string]time.Time),
+//
+// The defaults of the client may be changed by passing any number of Options, eg.
+//
+//	mc := mogilefs.New(domain, trackers, mogilefs.WithDialTimeout(5*time.Second))
+func New(domain string, trackers []string, opts ...Option) *MogileFsClient {
+	m := &MogileFsClient{
+		domain:             domain,
+		trackers:           trackers,
+		dial_timeout:       time.Duration(1) * time.Second,
+		read_timeout:       time.Duration(30) * time.Second,
+		write_timeout:      time.Duration(5) * time.Second,
+		dead_trackers:      newBlacklist(time.Duration(60) * time.Second),
+		http_client:        newHTTPClient(),
+		default_pathcount:  2,
+		default_noverify:   true,
+		retry_attempts:     3,
+		retry_backoff_base: time.Duration(50) * time.Millisecond,
+		retry_backoff_max:  time.Duration(1) * time.Second,
+		put_attempts:       1,
+		generate_lock_ttl:  time.Duration(5) * time.Minute,
+	}
+	m.transport = &httpTransport{m: m}
+	m.logger = slog.New(slog.DiscardHandler)
+	m.pool = NewTrackerPool(0)
+	m.lifecycle = newLifecycle()
+	m.selector = InOrder()
+	m.dead_trackers.half_open = true
+	m.dead_trackers.max_duration = time.Duration(10) * time.Minute
+	m.failed_paths = newBlacklist(time.Duration(10) * time.Second)
+	m.failed_paths.max_entries = 10000
+	for _, opt := range opts {
+		opt(m)
 	}
+	m.applyRedirectPolicy()
+	if len(m.hooks) > 0 {
+		m.transport = &hookedTransport{m: m, inner: m.transport}
+	}
+	if m.health_interval > 0 {
+		go m.runHealthCheck()
+	}
+	return m
 }
 
 // Returns the last tracker used (or better: 'touched') by the client (may return an empty string)
-func (m *MogileFsClient) LastTracketr() string {
+func (m *MogileFsClient) LastTracker() string {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
 	return m.last_tracker
 }
 
+// Returns the last tracker used by the client, see LastTracker().
+//
+// Deprecated: misspelled, use LastTracker().
+func (m *MogileFsClient) LastTracketr() string {
+	return m.LastTracker()
+}
+
+// Sets the identity of this client (eg. 'thumbnailer@web01').
+//
+// The identity is sent as 'client_id' argument with every tracker command, so tracker-side
+// logs can attribute traffic to an application. mogilefsd ignores unknown arguments, so this
+// is safe to use with any tracker. Pass an empty string to stop sending it.
+func (m *MogileFsClient) SetClientId(id string) {
+	m.mutex.Lock()
+	m.client_id = id
+	m.mutex.Unlock()
+}
+
 // Returns all known paths of the requested key.
 //
 // The upper limit of the returned paths may be adjusted by passing the optional
-// GetPathsOpts argument to the function.
+// GetPathsOpts argument to the function. Concurrent calls for the same key (and
+// options) share a single tracker request.
 func (m *MogileFsClient) GetPaths(key string, opts *GetPathsOpts) (paths []string, err error) {
+	result, err := m.LookupPaths(key, opts)
+	paths = result.Paths
+	return
+}
+
+// Returns all known paths of the requested key, see GetPaths().
+//
+// Unlike GetPaths, the result tells if the paths were returned by a tracker or
+// taken from the last known paths, see WithStalePaths().
+func (m *MogileFsClient) LookupPaths(key string, opts *GetPathsOpts) (result PathsResult, err error) {
+	return m.LookupPathsContext(context.Background(), key, opts)
+}
+
+// Returns all known paths of the requested key, see LookupPaths().
+//
+// The lookup stops once ctx is done. A tracker request shared with concurrent lookups of
+// the same key keeps running for the others.
+func (m *MogileFsClient) LookupPathsContext(ctx context.Context, key string, opts *GetPathsOpts) (result PathsResult, err error) {
+	result.Size = -1
 	// Set some sane defaults if caller didn't care
 	if opts == nil {
-		opts = &GetPathsOpts{NoVerify: true}
+		opts = &GetPathsOpts{NoVerify: m.default_noverify}
+	}
+	if err = m.checkKey(key); err == nil {
+		err = m.checkPathcount(opts.Pathcount)
+	}
+	if err != nil {
+		return
+	}
+	if m.failover != nil && m.failover.skipPrimary() {
+		return m.failover.lookupPaths(ctx, key, opts)
+	}
+	pathcount := opts.Pathcount
+	if pathcount == 0 {
+		pathcount = m.default_pathcount
 	}
 
 	// returning two paths is the minimum, anything below doesn't make sense
-	if opts.Pathcount < 2 {
-		opts.Pathcount = 2
+	if pathcount < 2 {
+		pathcount = 2
 	}
 
 	args := make(url.Values)
-	args.Add("key", key)
+	args.Add("key", m.encodeKey(key))
 	args.Add("domain", m.domain)
-	args.Add("pathcount", fmt.Sprintf("%d", opts.Pathcount))
+	args.Add("pathcount", fmt.Sprintf("%d", pathcount))
 	args.Add("noverify", fmt.Sprintf("%d", boolToInt(opts.NoVerify)))
+	if len(opts.Zone) > 0 {
+		args.Add("zone", opts.Zone)
+	}
+	if len(opts.ClientIP) > 0 {
+		args.Add("client_ip", opts.ClientIP)
+	}
 
-	values, rqerr := m.DoRequest(cmd_getpaths, args)
-	err = rqerr
+	if opts.NoVerify {
+		if cached, ok := m.cachedPaths(key); ok {
+			m.sortPaths(key, &cached)
+			return cached, nil
+		}
+	}
+
+	// concurrent lookups of the same key share a single tracker request, which must not
+	// fail for all of them if the first caller gives up
+	shared, err, _ := m.path_flights.do(ctx, args.Encode(), func() (interface{}, error) {
+		return m.queryPaths(context.WithoutCancel(ctx), key, opts, args)
+	})
+	if shared == nil {
+		return
+	}
+	result = shared.(PathsResult).clone()
+	if err == nil && !result.Standby {
+		m.sortPaths(key, &result)
+	}
+	return
+}
+
+/**
+ * @desc Sends get_paths to the trackers (or the standby cluster) and verifies the returned paths, see LookupPaths()
+ * @param args url.Values the arguments of get_paths
+ */
+func (m *MogileFsClient) queryPaths(ctx context.Context, key string, opts *GetPathsOpts, args url.Values) (result PathsResult, err error) {
+	result.Size = -1
+	gen := m.path_generations.begin(key)
+
+	var values url.Values
+	if m.hedge_getpaths {
+		values, err = m.doHedgedRequest(ctx, cmd_getpaths, args)
+	} else {
+		values, err = m.DoRequestContext(ctx, cmd_getpaths, args)
+	}
+	if m.failover != nil && m.failover.primaryResult(err) {
+		if standby, serr := m.failover.lookupPaths(ctx, key, opts); serr == nil {
+			m.path_generations.end(key, gen)
+			return standby, nil
+		}
+	}
 
 	if err == nil && values != nil {
 		for i := 1; i < 255; i++ {
@@ -99,33 +372,168 @@ func (m *MogileFsClient) GetPaths(key string, opts *GetPathsOpts) (paths []strin
 			if len(thisPath) == 0 {
 				break
 			} else {
-				paths = append(paths, thisPath)
+				result.Paths = append(result.Paths, thisPath)
 			}
 		}
+		result.Fetched = time.Now()
+		if !opts.NoVerify {
+			err = m.verifyPaths(&result)
+		}
+	}
+
+	// a Delete or Rename while get_paths was in flight makes its result outdated
+	if m.path_generations.current(key, gen) {
+		m.rememberPaths(key, result, err)
+	}
+	if !m.path_generations.end(key, gen) {
+		// changed after the check above: drop what we may have cached
+		m.forgetPaths(key)
+	}
+	if stale, ok := m.stalePaths(key, err); ok {
+		result, err = stale, nil
+	}
+	return
+}
 
+/**
+ * @desc Returns a copy of result which does not share any slices with it
+ */
+func (result PathsResult) clone() PathsResult {
+	result.Paths = append([]string(nil), result.Paths...)
+	if result.Details != nil {
+		result.Details = append([]Path(nil), result.Details...)
 	}
+	return result
+}
 
+/**
+ * @desc Drops all paths of result which can not be read from the storage nodes and orders the others by latency
+ * @return err error the last error if none of the paths could be read
+ */
+func (m *MogileFsClient) verifyPaths(result *PathsResult) (err error) {
+	// check all replicas at once: a slow device must not delay the others
+	details := make([]Path, len(result.Paths))
+	sizes := make([]int64, len(result.Paths))
+	errs := make([]error, len(result.Paths))
+	var wg sync.WaitGroup
+	for i, path := range result.Paths {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			started := time.Now()
+			sizes[i], errs[i] = m.headPath(m.lifecycle.ctx, path)
+			details[i] = Path{URL: path, Devid: pathDevid(path), Verified: true, Latency: time.Since(started)}
+		}()
+	}
+	wg.Wait()
+
+	verified := make([]string, 0, len(result.Paths))
+	result.Details = make([]Path, 0, len(result.Paths))
+	for i, path := range result.Paths {
+		if errs[i] != nil {
+			err = errs[i]
+			m.markPathFailed(path)
+			continue
+		}
+		result.Details = append(result.Details, details[i])
+		if result.Size < 0 {
+			result.Size = sizes[i]
+		}
+	}
+	if len(result.Details) > 0 {
+		err = nil
+	}
+
+	// the fastest replica first, see WithPathSorter for a different order
+	sort.SliceStable(result.Details, func(i, j int) bool {
+		return result.Details[i].Latency < result.Details[j].Latency
+	})
+	for _, p := range result.Details {
+		verified = append(verified, p.URL)
+	}
+	result.Paths = verified
 	return
 }
 
 // Renames an existing key
 func (m *MogileFsClient) Rename(oldname string, newname string) (err error) {
+	return m.RenameContext(context.Background(), oldname, newname)
+}
+
+// Renames an existing key, see Rename().
+//
+// ctx is passed to the audit hook (see WithAuditHook) and limits the time spent on the request.
+func (m *MogileFsClient) RenameContext(ctx context.Context, oldname string, newname string) (err error) {
+	if err = m.checkKey(oldname); err == nil {
+		err = m.checkKey(newname)
+	}
+	if err != nil {
+		return
+	}
+
+	args := make(url.Values)
+	args.Add("domain", m.domain)
+	args.Add("from_key", m.encodeKey(oldname))
+	args.Add("to_key", m.encodeKey(newname))
+
+	started := time.Now()
+	_, err = m.DoRequestContext(ctx, cmd_rename, args)
+	m.forgetPaths(oldname)
+	m.forgetPaths(newname)
+	if err == nil {
+		m.emit(ctx, Event{Type: EventRenamed, Time: started, Key: oldname, NewKey: newname, Size: -1, Duration: time.Since(started)})
+	}
+	return
+}
+
+// Moves an existing key to another class (eg. from a 'temp' class to one with more replicas).
+//
+// The data is not uploaded again: the trackers replicate (or drop) the copies of the key
+// in the background to match the policy of the new class.
+func (m *MogileFsClient) UpdateClass(key string, class string) (err error) {
+	return m.UpdateClassContext(context.Background(), key, class)
+}
+
+// Moves an existing key to another class, see UpdateClass().
+//
+// ctx is passed to the audit hook (see WithAuditHook) and limits the time spent on the request.
+func (m *MogileFsClient) UpdateClassContext(ctx context.Context, key string, class string) (err error) {
+	if err = m.checkKey(key); err != nil {
+		return
+	}
+
 	args := make(url.Values)
 	args.Add("domain", m.domain)
-	args.Add("from_key", oldname)
-	args.Add("to_key", newname)
+	args.Add("key", m.encodeKey(key))
+	args.Add("class", class)
 
-	_, err = m.DoRequest(cmd_rename, args)
+	_, err = m.DoRequestContext(ctx, cmd_updateclass, args)
 	return
 }
 
 // Deletes an existing key
 func (m *MogileFsClient) Delete(key string) (err error) {
+	return m.DeleteContext(context.Background(), key)
+}
+
+// Deletes an existing key, see Delete().
+//
+// ctx is passed to the audit hook (see WithAuditHook) and limits the time spent on the request.
+func (m *MogileFsClient) DeleteContext(ctx context.Context, key string) (err error) {
+	if err = m.checkKey(key); err != nil {
+		return
+	}
+
 	args := make(url.Values)
 	args.Add("domain", m.domain)
-	args.Add("key", key)
+	args.Add("key", m.encodeKey(key))
 
-	_, err = m.DoRequest(cmd_delete, args)
+	started := time.Now()
+	_, err = m.DoRequestContext(ctx, cmd_delete, args)
+	m.forgetPaths(key)
+	if err == nil {
+		m.emit(ctx, Event{Type: EventDeleted, Time: started, Key: key, Size: -1, Duration: time.Since(started)})
+	}
 	return
 }
 
@@ -133,75 +541,75 @@ func (m *MogileFsClient) Delete(key string) (err error) {
 //
 // This function should not be used to lookup paths - use GetPaths to do so.
 func (m *MogileFsClient) Debug(key string) (values url.Values, err error) {
+	if err = m.checkKey(key); err != nil {
+		return
+	}
+
 	args := make(url.Values)
 	args.Add("domain", m.domain)
-	args.Add("key", key)
+	args.Add("key", m.encodeKey(key))
 
 	values, err = m.DoRequest(cmd_debug, args)
 	return
 }
 
 // Returns an io.ReadCloser with the contents of the requested key.
+//
+// If a storage node fails while sending the contents, the reader transparently
+// continues at the same offset using the next replica.
 func (m *MogileFsClient) Fetch(key string) (r io.ReadCloser, err error) {
-	paths, perr := m.GetPaths(key, nil)
-	err = perr
+	r, _, err = m.FetchRange(key, 0, -1)
+	return
+}
 
+// Returns an io.ReadCloser with length bytes of the requested key, starting at offset.
+//
+// Pass -1 (or any other value <= 0) as length to read everything after offset. The total size of the file is
+// returned in size (-1 if the storage node did not tell us).
+func (m *MogileFsClient) FetchRange(key string, offset int64, length int64) (r io.ReadCloser, size int64, err error) {
+	if err = m.lifecycle.begin(); err != nil {
+		return
+	}
+	paths, err := m.GetPaths(key, nil)
 	if err == nil {
-		for _, path := range paths {
-			rqResp, rqErr := http.Get(path)
-			err = rqErr
-			if err == nil {
-				if rqResp.StatusCode == 200 {
-					r = rqResp.Body
-					break
-				} else {
-					err = fmt.Errorf("Invalid HTTP Status code: %d", rqResp.StatusCode)
-				}
-			}
-		}
+		r, size, err = m.fetchPaths(paths, offset, length)
+	}
+	if r == nil {
+		m.lifecycle.end()
 	}
-
 	return
 }
 
-// Uploads (aka: sets) a new key in the filesystem.
-//
-// Note: Set 'class' to an empty string to use the default class of the filesystem.
-func (m *MogileFsClient) Create(key string, class string, r io.Reader) (close_values url.Values, err error) {
-	create_args := make(url.Values)
-	create_args.Set("domain", m.domain)
-	create_args.Set("key", key)
-	create_args.Set("class", class)
-	create_args.Set("fid", "0")
-	create_args.Set("multi_dest", "0") // fixme: implement multi_dest ?
-
-	create_values, err := m.DoRequest(cmd_create_open, create_args)
-	cr := countingReader{r: r}
-
-	if err == nil && len(create_values.Get("path")) > 0 {
-		putRq, putErr := http.NewRequest("PUT", create_values.Get("path"), &cr)
-		err = putErr
+/**
+ * @desc Returns an io.ReadCloser with length bytes starting at offset of the first working path, see FetchRange()
+ * @note the caller must hold a slot of m.lifecycle, which is released by closing r
+ */
+func (m *MogileFsClient) fetchPaths(paths []string, offset int64, length int64) (r io.ReadCloser, size int64, err error) {
+	r, size, _, err = m.openPaths(paths, offset, length, nil)
+	return
+}
 
+/**
+ * @desc Returns a reader with the contents of the first working path, see fetchPaths()
+ * @param header http.Header receives the headers of the storage node, may be nil
+ * @return path string the path the reader started at
+ */
+func (m *MogileFsClient) openPaths(paths []string, offset int64, length int64, header http.Header) (r io.ReadCloser, size int64, path string, err error) {
+	if len(paths) == 0 {
+		// a valid reply of get_paths ('paths=0'), which must not leave us without reader and error
+		err = ErrNoPaths
+		return
+	}
+	for i := range paths {
+		path = paths[i]
+		body, total, rqErr := m.transport.Get(m.lifecycle.ctx, path, &StorageGetOpts{Offset: offset, Length: length, Header: header})
+		err = rqErr
 		if err == nil {
-			client := &http.Client{}
-			putRes, putErr := client.Do(putRq)
-			err = putErr
-			if err == nil {
-				if putRes.StatusCode == 200 {
-					close_args := make(url.Values)
-					close_args.Set("domain", create_args.Get("domain"))
-					close_args.Set("key", create_args.Get("key"))
-					close_args.Set("fid", create_values.Get("fid"))
-					close_args.Set("devid", create_values.Get("devid"))
-					close_args.Set("path", create_values.Get("path"))
-					close_args.Set("size", fmt.Sprintf("%d", cr.nbytes))
-					close_values, err = m.DoRequest(cmd_create_close, close_args)
-				} else {
-					err = fmt.Errorf("Invalid HTTP Status code of storage daemon: %d", putRes.StatusCode)
-				}
-			}
+			r = &fetchReader{m: m, body: body, path: path, paths: paths[i+1:], start: offset, length: length, done: m.lifecycle.end}
+			size = total
+			break
 		}
-
+		m.markPathFailed(path)
 	}
 	return
 }
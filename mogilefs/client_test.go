@@ -0,0 +1,167 @@
+/*
+
+Copyright 2015 Adrian Ulrich
+Copyright 2015 Fixxpunkt AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package mogilefs_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/adrian-bl/golang-mogilefs-client/mogilefs"
+	"github.com/adrian-bl/golang-mogilefs-client/mogilefs/mogiletest"
+)
+
+// Returns a client of the domain 'test' of a new mogiletest server
+func newTestClient(t *testing.T, opts ...mogilefs.Option) (*mogilefs.MogileFsClient, *mogiletest.Server) {
+	t.Helper()
+	srv := mogiletest.NewServer()
+	t.Cleanup(srv.Close)
+	srv.AddDomain("test")
+	return mogilefs.New("test", srv.Trackers(), opts...), srv
+}
+
+/**
+ * @desc Fetches key and returns its contents
+ */
+func fetchString(t *testing.T, mc *mogilefs.MogileFsClient, key string) string {
+	t.Helper()
+	r, err := mc.Fetch(key)
+	if err != nil {
+		t.Fatalf("fetching %q: %v", key, err)
+	}
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("reading %q: %v", key, err)
+	}
+	return string(data)
+}
+
+func TestClientRoundTrip(t *testing.T) {
+	mc, srv := newTestClient(t)
+
+	for _, key := range []string{"a/1", "a/2", "b/1"} {
+		if _, err := mc.Create(key, "", strings.NewReader("contents of "+key)); err != nil {
+			t.Fatalf("creating %q: %v", key, err)
+		}
+	}
+	if got := fetchString(t, mc, "a/1"); got != "contents of a/1" {
+		t.Errorf("fetch a/1 = %q", got)
+	}
+	if data, _ := srv.Data("test", "a/2"); string(data) != "contents of a/2" {
+		t.Errorf("server holds %q for a/2", data)
+	}
+
+	keys, err := mc.ListAllKeys("a/")
+	if err != nil {
+		t.Fatalf("listing keys: %v", err)
+	}
+	if want := []string{"a/1", "a/2"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("keys = %q, want %q", keys, want)
+	}
+
+	info, err := mc.FileInfo("a/1")
+	if err != nil {
+		t.Fatalf("file_info: %v", err)
+	}
+	if info.Key != "a/1" || info.Domain != "test" || info.Length != int64(len("contents of a/1")) || info.Fid == 0 {
+		t.Errorf("file_info = %+v", info)
+	}
+
+	if err = mc.Rename("a/1", "c/1"); err != nil {
+		t.Fatalf("renaming: %v", err)
+	}
+	if got := fetchString(t, mc, "c/1"); got != "contents of a/1" {
+		t.Errorf("fetch of renamed key = %q", got)
+	}
+	if _, err = mc.Fetch("a/1"); !errors.Is(err, mogilefs.ErrUnknownKey) {
+		t.Errorf("fetching the old name: err = %v, want ErrUnknownKey", err)
+	}
+	if err = mc.Rename("a/2", "b/1"); !errors.Is(err, mogilefs.ErrKeyExists) {
+		t.Errorf("renaming onto an existing key: err = %v, want ErrKeyExists", err)
+	}
+
+	if err = mc.Delete("c/1"); err != nil {
+		t.Fatalf("deleting: %v", err)
+	}
+	if _, err = mc.FileInfo("c/1"); !errors.Is(err, mogilefs.ErrUnknownKey) {
+		t.Errorf("file_info of a deleted key: err = %v, want ErrUnknownKey", err)
+	}
+	if err = mc.Delete("c/1"); !errors.Is(err, mogilefs.ErrUnknownKey) {
+		t.Errorf("deleting twice: err = %v, want ErrUnknownKey", err)
+	}
+	if keys = srv.Keys("test"); !reflect.DeepEqual(keys, []string{"a/2", "b/1"}) {
+		t.Errorf("server keys = %q", keys)
+	}
+}
+
+func TestListKeysPaging(t *testing.T) {
+	mc, _ := newTestClient(t)
+	for _, key := range []string{"k1", "k2", "k3", "x"} {
+		if _, err := mc.Create(key, "", strings.NewReader(key)); err != nil {
+			t.Fatalf("creating %q: %v", key, err)
+		}
+	}
+
+	keys, after, err := mc.ListKeys("k", "", 2)
+	if err != nil || !reflect.DeepEqual(keys, []string{"k1", "k2"}) || after != "k2" {
+		t.Fatalf("first page = %q, %q, %v", keys, after, err)
+	}
+	keys, after, err = mc.ListKeys("k", after, 2)
+	if err != nil || !reflect.DeepEqual(keys, []string{"k3"}) {
+		t.Fatalf("second page = %q, %q, %v", keys, after, err)
+	}
+}
+
+// A file changing after being hashed for the Content-MD5 header
+type changingFile struct {
+	r      *bytes.Reader
+	hashed bool
+}
+
+func (f *changingFile) Read(p []byte) (n int, err error) {
+	if n, err = f.r.Read(p); err == io.EOF && !f.hashed {
+		f.r, f.hashed = bytes.NewReader([]byte("changed")), true
+	}
+	return
+}
+
+func (f *changingFile) Seek(offset int64, whence int) (int64, error) {
+	return f.r.Seek(offset, whence)
+}
+
+func TestContentMD5Rejection(t *testing.T) {
+	mc, srv := newTestClient(t)
+	srv.AddClass("test", "md5", "MD5")
+
+	_, err := mc.Create("k", "md5", &changingFile{r: bytes.NewReader([]byte("content"))})
+	var serr *mogilefs.StorageError
+	if !errors.Is(err, mogilefs.ErrChecksumMismatch) || !errors.As(err, &serr) || serr.StatusCode != 400 {
+		t.Fatalf("err = %v, want ErrChecksumMismatch of a StorageError", err)
+	}
+	if keys := srv.Keys("test"); len(keys) > 0 {
+		t.Errorf("rejected upload created %q", keys)
+	}
+
+	if _, err = mc.Create("k", "md5", strings.NewReader("content")); err != nil {
+		t.Fatalf("uploading with Content-MD5: %v", err)
+	}
+}
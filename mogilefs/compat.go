@@ -0,0 +1,41 @@
+/*
+
+Copyright 2015 Adrian Ulrich
+Copyright 2015 Fixxpunkt AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package mogilefs
+
+import (
+	"net/url"
+	"strconv"
+)
+
+/**
+ * @desc Returns the value of a tracker reply field - fields added by newer mogilefsd releases (eg. the hashtype of classes) are missing in replies of older ones
+ * @param values url.Values the tracker reply
+ * @param key string the name of the field
+ * @return rv string the value, an empty string if not present
+ */
+func stringValue(values url.Values, key string) (rv string) {
+	return values.Get(key)
+}
+
+/**
+ * @desc Returns the numeric value of a tracker reply field, see stringValue() - missing or garbage values are returned as 0
+ */
+func intValue(values url.Values, key string) (rv int) {
+	rv, _ = strconv.Atoi(stringValue(values, key))
+	return
+}
@@ -0,0 +1,175 @@
+/*
+
+Copyright 2015 Adrian Ulrich
+Copyright 2015 Fixxpunkt AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package mogilefs
+
+import (
+	"bufio"
+	"net"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Replies of three generations of mogilefsd, keyed by command: releases predating
+// replication policies and device monitoring, releases predating checksums (before 2.60)
+// and current releases. Older releases do not send the fields added later
+var releaseReplies = map[string]map[string]string{
+	"legacy": {
+		"get_domains": "OK domains=1&domain1=test&domain1classes=2&domain1class1name=default&domain1class1mindevcount=2&domain1class2name=big&domain1class2mindevcount=3",
+		"get_devices": "OK devices=1&dev1_devid=1&dev1_hostid=1&dev1_status=alive&dev1_weight=100&dev1_mb_total=1000&dev1_mb_used=10",
+		"file_info":   "OK domain=test&key=a&class=big&fid=7&length=4&devcount=3",
+		"list_keys":   "OK key_count=2&key_1=a&key_2=b&next_after=b",
+	},
+	"pre-checksum": {
+		"get_domains": "OK domains=1&domain1=test&domain1classes=2&domain1class1name=default&domain1class1mindevcount=2&domain1class1replpolicy=MultipleHosts%28%29&domain1class2name=big&domain1class2mindevcount=3&domain1class2replpolicy=MultipleHosts%28%29",
+		"get_devices": "OK devices=1&dev1_devid=1&dev1_hostid=1&dev1_status=alive&dev1_observed_state=writeable&dev1_weight=100&dev1_mb_total=1000&dev1_mb_used=10&dev1_mb_asof=1400000000&dev1_utilization=1.5",
+		"file_info":   "OK domain=test&key=a&class=big&fid=7&length=4&devcount=3&devids=1%2C2%2C3",
+		"list_keys":   "OK key_count=2&key_1=a&key_2=b&next_after=b",
+	},
+	"current": {
+		"get_domains": "OK domains=1&domain1=test&domain1classes=2&domain1class1name=default&domain1class1mindevcount=2&domain1class1replpolicy=MultipleHosts%28%29&domain1class1hashtype=NONE&domain1class2name=big&domain1class2mindevcount=3&domain1class2replpolicy=MultipleHosts%28%29&domain1class2hashtype=MD5",
+		"get_devices": "OK devices=1&dev1_devid=1&dev1_hostid=1&dev1_status=alive&dev1_observed_state=writeable&dev1_weight=100&dev1_mb_total=1000&dev1_mb_used=10&dev1_mb_asof=1400000000&dev1_utilization=1.5&dev1_reject_bad_md5=1",
+		"file_info":   "OK domain=test&key=a&class=big&fid=7&length=4&devcount=3&checksum=MD5%3A098f6bcd4621d373cade4e832627b4f6&devids=1%2C2%2C3",
+		"list_keys":   "OK key_count=2&key_1=a&key_2=b&next_after=b",
+	},
+}
+
+// Returns the address of a tracker answering each command with its reply in replies
+func newCannedTracker(t *testing.T, replies map[string]string) string {
+	return newScriptedTracker(t, func(command string, args url.Values) string {
+		if reply, ok := replies[command]; ok {
+			return reply
+		}
+		return "ERR unknown_command Unknown+server+command"
+	})
+}
+
+// Returns the address of a tracker answering each command with the reply returned by answer
+func newScriptedTracker(t *testing.T, answer func(command string, args url.Values) string) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					command, query, _ := strings.Cut(strings.TrimSpace(line), " ")
+					args, _ := url.ParseQuery(query)
+					conn.Write([]byte(answer(command, args) + "\r\n"))
+				}
+			}()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func TestDecodeReleaseReplies(t *testing.T) {
+	for release, replies := range releaseReplies {
+		m := New("test", []string{newCannedTracker(t, replies)})
+		newer := release != "legacy"
+
+		domains, err := m.GetDomains()
+		if err != nil {
+			t.Fatalf("%s: get_domains: %v", release, err)
+		}
+		want := []Domain{{Name: "test", Classes: []Class{{Name: "default", Mindevcount: 2}, {Name: "big", Mindevcount: 3}}}}
+		if newer {
+			want[0].Classes[0].Replpolicy = "MultipleHosts()"
+			want[0].Classes[1].Replpolicy = "MultipleHosts()"
+		}
+		if release == "current" {
+			want[0].Classes[0].Hashtype = "NONE"
+			want[0].Classes[1].Hashtype = "MD5"
+		}
+		if !reflect.DeepEqual(domains, want) {
+			t.Errorf("%s: domains = %+v, want %+v", release, domains, want)
+		}
+
+		devices, err := m.GetDevices()
+		if err != nil {
+			t.Fatalf("%s: get_devices: %v", release, err)
+		}
+		device := Device{Devid: 1, Hostid: 1, Status: "alive", Weight: 100, MbTotal: 1000, MbUsed: 10}
+		if newer {
+			device.ObservedState = "writeable"
+			device.Utilization = 1.5
+		}
+		if !reflect.DeepEqual(devices, []Device{device}) {
+			t.Errorf("%s: devices = %+v, want %+v", release, devices, device)
+		}
+
+		info, err := m.FileInfo("a")
+		if err != nil {
+			t.Fatalf("%s: file_info: %v", release, err)
+		}
+		if info.Key != "a" || info.Class != "big" || info.Fid != 7 || info.Length != 4 || info.Devcount != 3 {
+			t.Errorf("%s: file_info = %+v", release, info)
+		}
+		if newer && !reflect.DeepEqual(info.Devids, []int{1, 2, 3}) {
+			t.Errorf("%s: devids = %v", release, info.Devids)
+		}
+		if (release == "current") != (info.Checksum == "MD5:098f6bcd4621d373cade4e832627b4f6") {
+			t.Errorf("%s: checksum = %q", release, info.Checksum)
+		}
+
+		keys, after, err := m.ListKeys("", "", 10)
+		if err != nil || !reflect.DeepEqual(keys, []string{"a", "b"}) || after != "b" {
+			t.Errorf("%s: list_keys = %q, %q, %v", release, keys, after, err)
+		}
+	}
+}
+
+func TestParseDestinations(t *testing.T) {
+	for _, tc := range []struct {
+		reply string
+		paths []string
+	}{
+		// without multi_dest
+		{"fid=7&devid=1&path=http%3A%2F%2F10.0.0.1%3A7500%2Fdev1%2F0%2F000%2F000%2F0000000007.fid", []string{"http://10.0.0.1:7500/dev1/0/000/000/0000000007.fid"}},
+		{"fid=7&dev_count=2&devid_1=1&path_1=http%3A%2F%2F10.0.0.1%3A7500%2Fdev1%2F0%2F000%2F000%2F0000000007.fid&devid_2=2&path_2=http%3A%2F%2F10.0.0.2%3A7500%2Fdev2%2F0%2F000%2F000%2F0000000007.fid", []string{"http://10.0.0.1:7500/dev1/0/000/000/0000000007.fid", "http://10.0.0.2:7500/dev2/0/000/000/0000000007.fid"}},
+	} {
+		values, err := url.ParseQuery(tc.reply)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var paths []string
+		for _, dest := range parseDestinations("k", values) {
+			if dest.Fid != "7" || dest.Key != "k" {
+				t.Errorf("destination %+v of %q", dest, tc.reply)
+			}
+			paths = append(paths, dest.Path)
+		}
+		if !reflect.DeepEqual(paths, tc.paths) {
+			t.Errorf("paths of %q = %q, want %q", tc.reply, paths, tc.paths)
+		}
+	}
+}
@@ -0,0 +1,430 @@
+/*
+
+Copyright 2015 Adrian Ulrich
+Copyright 2015 Fixxpunkt AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package mogilefs
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Optional argument to the CreateWithOpts function
+type CreateOpts struct {
+	// Checksum to compute while uploading: 'MD5' (the only hashtype of mogilefsd) or an empty string for none.
+	//
+	// The checksum is sent as Content-MD5 header to the storage node and to the tracker,
+	// which both verify the upload (a mismatch is reported as ErrChecksumMismatch). Streams
+	// of a known size (see Size) are only verified by the tracker, as the checksum is not
+	// known before their data was sent.
+	// Classes with a hashtype always use the hashtype of the class.
+	Checksum string
+	// Size of the data in bytes, 0 if unknown. Detected automatically if the reader implements io.Seeker.
+	//
+	// Uploads of a known size carry a Content-Length header instead of using chunked transfer encoding.
+	Size int64
+	// Content-Type sent to the storage nodes - an empty string for none
+	ContentType string
+	// Called while uploading, may be nil. Starts over at 0 if the upload is retried on another destination
+	Progress ProgressFunc
+}
+
+// A destination of an upload, returned by CreateOpen()
+type CreateDestination struct {
+	// The key being uploaded
+	Key string
+	// The file id assigned by the tracker
+	Fid string
+	// The device to upload the data to
+	Devid string
+	// The URL to upload the data to
+	Path string
+}
+
+// Result of CreateWithResult()
+type CreateResult struct {
+	// The destination the data was uploaded to
+	CreateDestination
+	// The storage node the data was uploaded to ('host:port'), see StorageHost()
+	StorageHost string
+	// Number of bytes uploaded
+	Size int64
+	// The reply of create_close
+	Values url.Values
+}
+
+// Uploads (aka: sets) a new key in the filesystem.
+//
+// The tracker is asked for multiple destinations: if the upload to a storage node fails,
+// the next destination is tried. Note that this is only possible if r implements io.Seeker
+// or if the failed attempt did not consume any data of r.
+//
+// Concurrent calls uploading the same key are serialized, so the key always points to a
+// complete upload (of the last writer).
+//
+// Note: Set 'class' to an empty string to use the default class of the client (see
+// WithDefaultClass) or of the filesystem.
+func (m *MogileFsClient) Create(key string, class string, r io.Reader) (close_values url.Values, err error) {
+	return m.CreateWithOpts(key, class, r, nil)
+}
+
+// Uploads (aka: sets) a new key in the filesystem, see Create().
+//
+// Passing nil as opts is the same as calling Create().
+func (m *MogileFsClient) CreateWithOpts(key string, class string, r io.Reader, opts *CreateOpts) (close_values url.Values, err error) {
+	result, err := m.CreateWithResult(key, class, r, opts)
+	close_values = result.Values
+	return
+}
+
+// Uploads (aka: sets) a new key with a known size of data, see Create().
+//
+// The upload carries a Content-Length header instead of using chunked transfer encoding,
+// which some older mogstored and Perlbal setups reject or handle slowly. r must return
+// exactly size bytes. Note that the size of seekable readers (such as an *os.File) is
+// detected by Create() itself.
+func (m *MogileFsClient) CreateWithSize(key string, class string, r io.Reader, size int64) (close_values url.Values, err error) {
+	return m.CreateWithOpts(key, class, r, &CreateOpts{Size: size})
+}
+
+// Uploads (aka: sets) a new key in the filesystem, see Create().
+//
+// The result tells which storage node received the data. If the client remembers paths
+// (see WithStalePaths), the path of the upload is remembered as path of key, so reads
+// following the upload can be served by the same storage node.
+func (m *MogileFsClient) CreateWithResult(key string, class string, r io.Reader, opts *CreateOpts) (result CreateResult, err error) {
+	return m.CreateContext(context.Background(), key, class, r, opts)
+}
+
+// Uploads (aka: sets) a new key in the filesystem, see CreateWithResult().
+//
+// ctx is passed to the audit hook (see WithAuditHook) and limits the time spent on tracker
+// requests and uploads. If ctx is done while uploading, the upload is aborted, create_close
+// is skipped and the partial upload is removed from the storage node (using a DELETE
+// request). The error returned is then the error of ctx (context.Canceled or
+// context.DeadlineExceeded), so user aborts can be told apart from failures of the cluster.
+func (m *MogileFsClient) CreateContext(ctx context.Context, key string, class string, r io.Reader, opts *CreateOpts) (result CreateResult, err error) {
+	started := time.Now()
+	if len(class) == 0 {
+		class = m.default_class
+	}
+	opts = m.applyClassDefaults(class, opts)
+	if err = m.checkKey(key); err == nil {
+		r, err = m.checkReader(r)
+	}
+	if err == nil {
+		r, err = m.bufferTiny(r, opts.Size)
+	}
+	if err == nil {
+		err = m.lifecycle.begin()
+	}
+	if err != nil {
+		return
+	}
+	defer m.lifecycle.end()
+
+	if err = m.create_locks.lock(key, m.reject_concurrent_creates); err != nil {
+		return
+	}
+	defer m.create_locks.unlock(key)
+
+	// refuse to upload anything if we can not produce the checksum required by the class
+	hashtype := m.classHashtype(class)
+	if len(hashtype) == 0 {
+		hashtype = opts.Checksum
+	}
+	if _, err = newChecksumHash(hashtype); err != nil {
+		return
+	}
+
+	// remember where the data starts, so we can rewind it if a destination fails
+	seeker, _ := r.(io.Seeker)
+	start := int64(0)
+	if seeker != nil {
+		if start, err = seeker.Seek(0, io.SeekCurrent); err != nil {
+			seeker, err = nil, nil
+		}
+	}
+
+	// uploads of a known size carry a Content-Length: measure seekable readers (such as an *os.File)
+	if opts.Size <= 0 && seeker != nil {
+		var end int64
+		if end, err = seeker.Seek(0, io.SeekEnd); err == nil {
+			_, err = seeker.Seek(start, io.SeekStart)
+		}
+		if err != nil {
+			return
+		}
+		opts.Size = end - start
+	}
+
+	// Content-MD5 must be known before sending the data: hash seekable files upfront
+	// and fall back to sending it as trailer for streams of an unknown size
+	content_md5 := ""
+	if hashtype == hashtype_md5 && seeker != nil {
+		hasher := md5.New()
+		if _, err = io.Copy(hasher, r); err == nil {
+			_, err = seeker.Seek(start, io.SeekStart)
+		}
+		if err != nil {
+			return
+		}
+		content_md5 = base64.StdEncoding.EncodeToString(hasher.Sum(nil))
+	}
+
+	m.pace()
+	dests, err := m.createOpen(ctx, key, class)
+	if err != nil {
+		return
+	}
+
+	// abort uploads once the caller gives up or the client is closed
+	put_ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stop := context.AfterFunc(m.lifecycle.ctx, cancel)
+	defer stop()
+
+	put_attempt := 1
+	for i := 0; i < len(dests); i++ {
+		dest := dests[i]
+		hasher, _ := newChecksumHash(hashtype)
+		cr := countingReader{r: r}
+		if hasher != nil {
+			cr.r = io.TeeReader(r, hasher)
+		}
+		var progress *progressReader
+		if opts.Progress != nil {
+			total := int64(-1)
+			if opts.Size > 0 {
+				total = opts.Size
+			}
+			progress = &progressReader{r: cr.r, progress: opts.Progress, total: total}
+			cr.r = progress
+		}
+
+		put_opts := &StoragePutOpts{Header: make(http.Header)}
+		if len(opts.ContentType) > 0 {
+			put_opts.Header.Set("Content-Type", opts.ContentType)
+		}
+		if opts.Size > 0 {
+			put_opts.ContentLength = opts.Size
+		}
+		if m.expectContinue(opts.Size) {
+			put_opts.Header.Set("Expect", "100-continue")
+		}
+		if len(content_md5) > 0 {
+			put_opts.Header.Set("Content-Md5", content_md5)
+		} else if hashtype == hashtype_md5 && opts.Size <= 0 {
+			// trailers require chunked encoding: streams of a known size are only verified by the tracker
+			put_opts.Trailer = http.Header{"Content-Md5": nil}
+			cr.eof = func() {
+				put_opts.Trailer.Set("Content-MD5", base64.StdEncoding.EncodeToString(hasher.Sum(nil)))
+			}
+		}
+
+		err = m.transport.Put(put_ctx, dest.Path, &cr, put_opts)
+		if err != nil && hashtype == hashtype_md5 {
+			err = checksumRejection(err)
+		}
+		if ctx.Err() != nil {
+			// the caller gave up: do not commit what we uploaded so far
+			m.removeUpload(dest.Path)
+			err = ctx.Err()
+			break
+		}
+		if progress != nil && progress.aborted != nil {
+			m.removeUpload(dest.Path)
+			err = progress.aborted
+			break
+		}
+		if err == nil {
+			checksum := ""
+			if hasher != nil {
+				checksum = checksumString(hashtype, hasher)
+			}
+			result.Values, err = m.createClose(ctx, dest, int64(cr.nbytes), checksum)
+			if err == nil {
+				result.CreateDestination = dest
+				result.StorageHost = StorageHost(dest.Path)
+				result.Size = int64(cr.nbytes)
+				m.path_generations.bump(key)
+				m.rememberPaths(key, PathsResult{Paths: []string{dest.Path}, Fetched: time.Now()}, nil)
+				m.emit(ctx, Event{Type: EventCreated, Time: started, Key: key, Fid: dest.Fid, Size: result.Size, Class: class, Duration: time.Since(started)})
+			}
+			break
+		}
+
+		if cr.nbytes > 0 {
+			// the failed attempt consumed some data: try the next destination only if we can rewind
+			if seeker == nil {
+				break
+			}
+			if _, serr := seeker.Seek(start, io.SeekStart); serr != nil {
+				break
+			}
+		}
+
+		// the storage node failed temporarily: try it again before moving on
+		if delay, retry := m.putRetry(err, put_attempt); retry {
+			if err = sleepContext(ctx, delay); err != nil {
+				break
+			}
+			put_attempt++
+			i--
+			continue
+		}
+		put_attempt = 1
+	}
+	return
+}
+
+// Starts the upload of a new key without transferring any data.
+//
+// Use this if the data is uploaded by other means (eg. by a browser or another service).
+// Returns one or more destinations (in order of preference) which share the same Fid:
+// upload the data to the Path of any of them using an HTTP PUT request and finish the
+// upload by passing the destination used to CreateClose(). Keys are never visible before
+// CreateClose() succeeded.
+//
+// Note: Set 'class' to an empty string to use the default class of the filesystem.
+func (m *MogileFsClient) CreateOpen(key string, class string) (dests []CreateDestination, err error) {
+	if len(class) == 0 {
+		class = m.default_class
+	}
+	return m.createOpen(context.Background(), key, class)
+}
+
+/**
+ * @desc Sends create_open, see CreateOpen()
+ */
+func (m *MogileFsClient) createOpen(ctx context.Context, key string, class string) (dests []CreateDestination, err error) {
+	if err = m.checkKey(key); err != nil {
+		return
+	}
+
+	create_args := make(url.Values)
+	create_args.Set("domain", m.domain)
+	create_args.Set("key", m.encodeKey(key))
+	create_args.Set("class", class)
+	create_args.Set("fid", "0")
+	create_args.Set("multi_dest", "1")
+
+	create_values, err := m.DoRequestContext(ctx, cmd_create_open, create_args)
+	if err != nil && m.autoProvision(class, err) {
+		create_values, err = m.DoRequestContext(ctx, cmd_create_open, create_args)
+	}
+
+	if err == nil {
+		dests = parseDestinations(key, create_values)
+		if len(dests) == 0 {
+			err = errors.New("internal:tracker returned no destination")
+		} else if m.free_space != nil {
+			m.free_space.shuffle(m, dests)
+		}
+		m.sortDestinations(dests)
+	}
+	return
+}
+
+// Finishes an upload started by CreateOpen().
+//
+// dest is the destination the data was uploaded to and size the number of bytes uploaded.
+// checksum is optional (pass an empty string to omit it) and must be formatted as
+// '<hashtype>:<hex digest>', eg. 'MD5:d41d8cd98f00b204e9800998ecf8427e'. If given, the
+// tracker verifies the uploaded data and returns ErrChecksumMismatch if it differs.
+func (m *MogileFsClient) CreateClose(dest CreateDestination, size int64, checksum string) (close_values url.Values, err error) {
+	started := time.Now()
+	ctx := context.Background()
+	close_values, err = m.createClose(ctx, dest, size, checksum)
+	if err == nil {
+		m.emit(ctx, Event{Type: EventCreated, Time: started, Key: dest.Key, Fid: dest.Fid, Size: size, Duration: time.Since(started)})
+	}
+	return
+}
+
+/**
+ * @desc Sends create_close, see CreateClose()
+ */
+func (m *MogileFsClient) createClose(ctx context.Context, dest CreateDestination, size int64, checksum string) (close_values url.Values, err error) {
+	close_args := make(url.Values)
+	close_args.Set("domain", m.domain)
+	close_args.Set("key", m.encodeKey(dest.Key))
+	close_args.Set("fid", dest.Fid)
+	close_args.Set("devid", dest.Devid)
+	close_args.Set("path", dest.Path)
+	close_args.Set("size", fmt.Sprintf("%d", size))
+	if len(checksum) > 0 {
+		close_args.Set("checksum", checksum)
+		close_args.Set("checksumverify", "1")
+	}
+
+	close_values, err = m.DoRequestContext(ctx, cmd_create_close, close_args)
+	m.forgetPaths(dest.Key)
+	return
+}
+
+// Returns the storage node ('host:port') of a path returned by the trackers, an empty string if path is not an URL
+func StorageHost(path string) string {
+	if u, err := url.Parse(path); err == nil {
+		return u.Host
+	}
+	return ""
+}
+
+/**
+ * @desc Returns all destinations of a create_open reply, in order of preference
+ * @param key string the key passed to create_open
+ * @param values url.Values the reply of create_open
+ */
+func parseDestinations(key string, values url.Values) (dests []CreateDestination) {
+	for i := 1; i <= intValue(values, "dev_count"); i++ {
+		dest := CreateDestination{
+			Key:   key,
+			Fid:   stringValue(values, "fid"),
+			Devid: stringValue(values, fmt.Sprintf("devid_%d", i)),
+			Path:  stringValue(values, fmt.Sprintf("path_%d", i)),
+		}
+		if len(dest.Path) > 0 {
+			dests = append(dests, dest)
+		}
+	}
+
+	// trackers not supporting multi_dest only return a single destination
+	if len(dests) == 0 && len(stringValue(values, "path")) > 0 {
+		dests = append(dests, CreateDestination{Key: key, Fid: stringValue(values, "fid"), Devid: stringValue(values, "devid"), Path: stringValue(values, "path")})
+	}
+	return
+}
+
+/**
+ * @desc Removes an aborted upload from the storage node, ignoring all errors
+ */
+func (m *MogileFsClient) removeUpload(path string) {
+	deleter, ok := m.transport.(StorageDeleter)
+	if !ok {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(5)*time.Second)
+	defer cancel()
+	deleter.Delete(ctx, path)
+}
@@ -0,0 +1,121 @@
+/*
+
+Copyright 2015 Adrian Ulrich
+Copyright 2015 Fixxpunkt AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package mogilefs
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Stores the values of a tracker reply (as returned by DoRequest) in the struct pointed to by v.
+//
+// Each exported field is set from the reply value named by its 'mogile' tag, or by its
+// lowercased name if it has no tag. Fields tagged with `mogile:"-"` are skipped, as are
+// values missing in the reply. Supported field types are strings, bools ('1' is true),
+// integers, floats and slices of strings or integers (comma separated values). Example:
+//
+//	var info struct {
+//		Fid      int64  `mogile:"fid"`
+//		Devcount int    `mogile:"devcount"`
+//		Devids   []int  `mogile:"devids"`
+//		Class    string
+//	}
+//	values, err := mc.DoRequest("file_info", args)
+//	if err == nil {
+//		err = mogilefs.DecodeValues(values, &info)
+//	}
+//
+// Values are looked up like the typed replies of this library, so fields also accept the
+// names used by other mogilefsd releases.
+func DecodeValues(values url.Values, v interface{}) (err error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return errors.New("internal:DecodeValues needs a pointer to a struct")
+	}
+	rv = rv.Elem()
+	rt := rv.Type()
+
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		if len(field.PkgPath) > 0 {
+			continue // unexported
+		}
+		name := field.Tag.Get("mogile")
+		if name == "-" {
+			continue
+		}
+		if len(name) == 0 {
+			name = strings.ToLower(field.Name)
+		}
+
+		value := stringValue(values, name)
+		if len(value) == 0 {
+			continue
+		}
+		if err = decodeValue(rv.Field(i), value); err != nil {
+			return fmt.Errorf("internal:can not decode '%s' into %s: %s", name, field.Name, err)
+		}
+	}
+	return
+}
+
+/**
+ * @desc Parses value into the field f
+ */
+func decodeValue(f reflect.Value, value string) (err error) {
+	switch f.Kind() {
+	case reflect.String:
+		f.SetString(value)
+	case reflect.Bool:
+		f.SetBool(value == "1" || value == "true")
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var n int64
+		if n, err = strconv.ParseInt(value, 10, f.Type().Bits()); err == nil {
+			f.SetInt(n)
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		var n uint64
+		if n, err = strconv.ParseUint(value, 10, f.Type().Bits()); err == nil {
+			f.SetUint(n)
+		}
+	case reflect.Float32, reflect.Float64:
+		var n float64
+		if n, err = strconv.ParseFloat(value, f.Type().Bits()); err == nil {
+			f.SetFloat(n)
+		}
+	case reflect.Slice:
+		parts := strings.Split(value, ",")
+		slice := reflect.MakeSlice(f.Type(), len(parts), len(parts))
+		for i, part := range parts {
+			if slice.Index(i).Kind() == reflect.Slice {
+				return fmt.Errorf("unsupported type %s", f.Type())
+			}
+			if err = decodeValue(slice.Index(i), part); err != nil {
+				return
+			}
+		}
+		f.Set(slice)
+	default:
+		err = fmt.Errorf("unsupported type %s", f.Type())
+	}
+	return
+}
@@ -0,0 +1,81 @@
+/*
+
+Copyright 2015 Adrian Ulrich
+Copyright 2015 Fixxpunkt AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package mogilefs
+
+import (
+	"errors"
+	"io"
+	"net/url"
+	"sync/atomic"
+)
+
+// The client used by the package level functions (*MogileFsClient)
+var default_client atomic.Value
+
+// Sets the client used by the package level functions GetPaths, Fetch and Create.
+//
+// Example:
+//
+//	mogilefs.SetDefault(mogilefs.New(domain, trackers))
+//	r, err := mogilefs.Fetch("some-key")
+func SetDefault(m *MogileFsClient) {
+	default_client.Store(m)
+}
+
+// Returns the client set by SetDefault(), nil if none was set
+func Default() *MogileFsClient {
+	m, _ := default_client.Load().(*MogileFsClient)
+	return m
+}
+
+// Calls GetPaths of the default client
+func GetPaths(key string, opts *GetPathsOpts) (paths []string, err error) {
+	m, err := defaultClient()
+	if err == nil {
+		paths, err = m.GetPaths(key, opts)
+	}
+	return
+}
+
+// Calls Fetch of the default client
+func Fetch(key string) (r io.ReadCloser, err error) {
+	m, err := defaultClient()
+	if err == nil {
+		r, err = m.Fetch(key)
+	}
+	return
+}
+
+// Calls Create of the default client
+func Create(key string, class string, r io.Reader) (close_values url.Values, err error) {
+	m, err := defaultClient()
+	if err == nil {
+		close_values, err = m.Create(key, class, r)
+	}
+	return
+}
+
+/**
+ * @desc Returns the default client or an error if SetDefault() was never called
+ */
+func defaultClient() (m *MogileFsClient, err error) {
+	if m = Default(); m == nil {
+		err = errors.New("internal:no default client, call SetDefault() first")
+	}
+	return
+}
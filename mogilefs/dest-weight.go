@@ -0,0 +1,119 @@
+/*
+
+Copyright 2015 Adrian Ulrich
+Copyright 2015 Fixxpunkt AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package mogilefs
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Picks among the destinations of an upload weighted by the free space of their devices.
+//
+// The tracker returns several destinations for each upload (see CreateOpen), the client
+// uses the first one unless it fails. With this option the destinations are shuffled,
+// so a device with twice the free space of another receives twice the uploads, which
+// spreads writes more evenly in clusters with devices of different sizes. The free space
+// is taken from get_devices, which is refreshed every ttl. Destinations keep the order of
+// the tracker as long as no device list could be loaded.
+func WithFreeSpaceWeighting(ttl time.Duration) Option {
+	return func(m *MogileFsClient) {
+		m.free_space = &freeSpace{ttl: ttl}
+	}
+}
+
+// The free space of all devices, as returned by get_devices
+type freeSpace struct {
+	ttl   time.Duration
+	mutex sync.Mutex
+	// free megabytes by devid
+	free    map[string]int64
+	fetched time.Time
+	// true while a refresh is in progress
+	loading bool
+}
+
+/**
+ * @desc Returns the free space of all devices, refreshing it if older than fs.ttl
+ * @return free map[string]int64 free megabytes by devid, nil if never loaded
+ */
+func (fs *freeSpace) devices(m *MogileFsClient) (free map[string]int64) {
+	fs.mutex.Lock()
+	free = fs.free
+	refresh := !fs.loading && time.Since(fs.fetched) >= fs.ttl
+	if refresh {
+		fs.loading = true
+	}
+	fs.mutex.Unlock()
+	if !refresh {
+		// concurrent uploads keep using the old list while it is refreshed
+		return
+	}
+
+	devices, err := m.GetDevices()
+
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+	fs.loading = false
+	fs.fetched = time.Now()
+	if err == nil {
+		fs.free = make(map[string]int64, len(devices))
+		for _, device := range devices {
+			fs.free[strconv.Itoa(device.Devid)] = max(int64(device.MbTotal-device.MbUsed), 0)
+		}
+	}
+	return fs.free
+}
+
+/**
+ * @desc Orders dests randomly, weighted by the free space of their devices
+ */
+func (fs *freeSpace) shuffle(m *MogileFsClient, dests []CreateDestination) {
+	free := fs.devices(m)
+	if len(free) == 0 || len(dests) < 2 {
+		return
+	}
+
+	// weighted random order (Efraimidis-Spirakis): sort by u^(1/weight), u being uniform in (0,1],
+	// or by its logarithm ln(u)/weight, which does not run out of precision for large weights
+	keys := make(map[string]float64, len(dests))
+	for _, dest := range dests {
+		weight, ok := free[dest.Devid]
+		if !ok {
+			// unknown device (eg. added since the last refresh): give it an average chance
+			weight = averageFree(free)
+		}
+		keys[dest.Devid] = math.Log(1-rand.Float64()) / float64(max(weight, 1))
+	}
+	sort.SliceStable(dests, func(i, j int) bool {
+		return keys[dests[i].Devid] > keys[dests[j].Devid]
+	})
+}
+
+/**
+ * @desc Returns the average free space of all devices
+ */
+func averageFree(free map[string]int64) (average int64) {
+	for _, mb := range free {
+		average += mb
+	}
+	return average / int64(len(free))
+}
@@ -0,0 +1,192 @@
+/*
+
+Copyright 2015 Adrian Ulrich
+Copyright 2015 Fixxpunkt AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package mogilefs
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Opens connections to trackers, see WithTrackerDialer().
+//
+// This is the same interface as golang.org/x/net/proxy.Dialer, so any dialer returned
+// by proxy.SOCKS5() or proxy.FromURL() may be used.
+type Dialer interface {
+	Dial(network string, addr string) (net.Conn, error)
+}
+
+// Implemented by dialers which support contexts (such as golang.org/x/net/proxy.ContextDialer)
+type ContextDialer interface {
+	DialContext(ctx context.Context, network string, addr string) (net.Conn, error)
+}
+
+// Connects to the trackers using dialer (eg. a SOCKS5 proxy) instead of connecting directly.
+//
+// The dial timeout (see WithDialTimeout) only applies if dialer implements ContextDialer.
+// Storage nodes are not affected, configure the proxy of the http.Client for them (see WithHTTPClient).
+func WithTrackerDialer(dialer Dialer) Option {
+	return func(m *MogileFsClient) {
+		m.dialer = dialer
+	}
+}
+
+// Returns a Dialer connecting through the HTTP proxy at proxyAddr ('host:port') using the CONNECT method
+func HTTPConnectDialer(proxyAddr string) Dialer {
+	return &httpConnectDialer{proxy: proxyAddr}
+}
+
+type httpConnectDialer struct {
+	proxy string
+}
+
+func (d *httpConnectDialer) Dial(network string, addr string) (net.Conn, error) {
+	return d.DialContext(context.Background(), network, addr)
+}
+
+func (d *httpConnectDialer) DialContext(ctx context.Context, network string, addr string) (conn net.Conn, err error) {
+	var dialer net.Dialer
+	if conn, err = dialer.DialContext(ctx, network, d.proxy); err != nil {
+		return
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	connectRq, err := http.NewRequest("CONNECT", "http://"+addr, nil)
+	if err == nil {
+		connectRq.Host = addr
+		err = connectRq.Write(conn)
+	}
+	if err == nil {
+		// the tracker only talks after receiving a command: nothing but the proxy reply is buffered
+		connectRes, rerr := http.ReadResponse(bufio.NewReader(conn), connectRq)
+		if err = rerr; err == nil {
+			connectRes.Body.Close()
+			if connectRes.StatusCode != 200 {
+				err = fmt.Errorf("internal:proxy refused to connect to %s: %s", addr, connectRes.Status)
+			}
+		}
+	}
+
+	if err != nil {
+		conn.Close()
+		conn = nil
+	} else {
+		conn.SetDeadline(time.Time{})
+	}
+	return
+}
+
+// Connection settings of a single tracker, see WithTrackerConfig()
+type TrackerConfig struct {
+	// The tracker ('host:port'), as passed to New
+	Host string
+	// Port to connect to instead of the port of Host, 0 to keep it
+	Port int
+	// Talk TLS to the tracker (eg. to a stunnel in front of it)
+	TLS bool
+	// TLS settings, nil for the defaults. The ServerName defaults to the host of Host
+	TLSConfig *tls.Config
+}
+
+// Returns a new client talking to trackers with individual connection settings, see New() and WithTrackerConfig()
+func NewWithTrackers(domain string, trackers []TrackerConfig, opts ...Option) *MogileFsClient {
+	hosts := make([]string, 0, len(trackers))
+	for _, tracker := range trackers {
+		hosts = append(hosts, tracker.Host)
+	}
+	return New(domain, hosts, append([]Option{WithTrackerConfig(trackers...)}, opts...)...)
+}
+
+// Overrides the connection settings of some trackers (eg. while migrating some of them behind TLS).
+//
+// The trackers are still identified by their Host (eg. in BlacklistStatus), only the
+// connections use a different port or TLS. Trackers without a config are connected to
+// as usual. TLS is spoken over the connection returned by the Dialer, if any.
+func WithTrackerConfig(configs ...TrackerConfig) Option {
+	return func(m *MogileFsClient) {
+		if m.tracker_configs == nil {
+			m.tracker_configs = make(map[string]TrackerConfig)
+		}
+		for _, config := range configs {
+			m.tracker_configs[config.Host] = config
+		}
+	}
+}
+
+/**
+ * @desc Connects to a tracker, applying its TrackerConfig if any
+ */
+func (m *MogileFsClient) dialTracker(ctx context.Context, host string) (conn net.Conn, err error) {
+	config, ok := m.tracker_configs[host]
+	if !ok {
+		return m.dialAddr(ctx, host)
+	}
+
+	addr := host
+	if config.Port > 0 {
+		addr = net.JoinHostPort(hostOnly(host), strconv.Itoa(config.Port))
+	}
+	if conn, err = m.dialAddr(ctx, addr); err != nil || !config.TLS {
+		return
+	}
+
+	tls_config := &tls.Config{}
+	if config.TLSConfig != nil {
+		tls_config = config.TLSConfig.Clone()
+	}
+	if len(tls_config.ServerName) == 0 {
+		tls_config.ServerName = hostOnly(host)
+	}
+	if m.dial_timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, m.dial_timeout)
+		defer cancel()
+	}
+	tls_conn := tls.Client(conn, tls_config)
+	if err = tls_conn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return tls_conn, nil
+}
+
+/**
+ * @desc Opens a TCP connection to addr, using the configured Dialer if any
+ */
+func (m *MogileFsClient) dialAddr(ctx context.Context, host string) (conn net.Conn, err error) {
+	if m.dialer == nil {
+		dialer := net.Dialer{Timeout: m.dial_timeout}
+		return dialer.DialContext(ctx, "tcp", host)
+	}
+	if dialer, ok := m.dialer.(ContextDialer); ok {
+		if m.dial_timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, m.dial_timeout)
+			defer cancel()
+		}
+		return dialer.DialContext(ctx, "tcp", host)
+	}
+	return m.dialer.Dial("tcp", host)
+}
@@ -0,0 +1,139 @@
+/*
+
+Copyright 2015 Adrian Ulrich
+Copyright 2015 Fixxpunkt AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package mogilefs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Returned by Create if another upload of the same key is in progress, see WithRejectConcurrentCreates()
+var ErrConcurrentCreate = errors.New("internal:concurrent create of the same key")
+
+// Returned by a client after Close() was called
+var ErrClientClosed = errors.New("internal:client is closed")
+
+// Returned when reading a key the trackers know no copies of
+var ErrNoPaths = errors.New("internal:key has no paths")
+
+// An unexpected HTTP status code returned by a storage node
+type StorageError struct {
+	// The path requested from the storage node
+	Path string
+	// The HTTP status code returned by the storage node
+	StatusCode int
+	// The delay requested by the Retry-After header of the storage node, 0 if none
+	RetryAfter time.Duration
+}
+
+func (e *StorageError) Error() string {
+	return fmt.Sprintf("Invalid HTTP Status code of storage daemon: %d", e.StatusCode)
+}
+
+// An error returned by the tracker ('ERR <code> <message>').
+//
+// Use errors.Is to check for a specific code, eg.
+//
+//	if errors.Is(err, mogilefs.ErrUnknownKey) { ... }
+//
+// or errors.As to access the message sent by the tracker.
+type TrackerError struct {
+	// The error code, eg. 'unknown_key'
+	Code string
+	// The human readable message sent by the tracker - may be an empty string
+	Message string
+}
+
+// Errors returned by mogilefsd, to be used with errors.Is
+var (
+	ErrUnknownKey       = &TrackerError{Code: "unknown_key"}
+	ErrUnknownCommand   = &TrackerError{Code: "unknown_command"}
+	ErrDomainNotFound   = &TrackerError{Code: "domain_not_found"}
+	ErrDomainExists     = &TrackerError{Code: "domain_exists"}
+	ErrDomainHasFiles   = &TrackerError{Code: "domain_has_files"}
+	ErrUnregDomain      = &TrackerError{Code: "unreg_domain"}
+	ErrUnregClass       = &TrackerError{Code: "unreg_class"}
+	ErrClassNotFound    = &TrackerError{Code: "class_not_found"}
+	ErrClassExists      = &TrackerError{Code: "class_exists"}
+	ErrClassHasFiles    = &TrackerError{Code: "class_has_files"}
+	ErrHostNotFound     = &TrackerError{Code: "host_not_found"}
+	ErrKeyExists        = &TrackerError{Code: "key_exists"}
+	ErrNoKey            = &TrackerError{Code: "no_key"}
+	ErrNoDomain         = &TrackerError{Code: "no_domain"}
+	ErrNoDevices        = &TrackerError{Code: "no_devices"}
+	ErrNoneMatch        = &TrackerError{Code: "none_match"}
+	ErrNoTempFile       = &TrackerError{Code: "no_temp_file"}
+	ErrEmptyFile        = &TrackerError{Code: "empty_file"}
+	ErrSizeMismatch     = &TrackerError{Code: "size_mismatch"}
+	ErrChecksumMismatch = &TrackerError{Code: "checksum_mismatch"}
+)
+
+func (e *TrackerError) Error() string {
+	if len(e.Message) == 0 {
+		return "mogilefsd:" + e.Code
+	}
+	return "mogilefsd:" + e.Code + ": " + e.Message
+}
+
+// Reports whether target is a TrackerError with the same code
+func (e *TrackerError) Is(target error) bool {
+	t, ok := target.(*TrackerError)
+	return ok && t.Code == e.Code
+}
+
+// Returns the HTTP status code a web service should answer with if a request failed with err.
+//
+//	404 Not Found:             the key does not exist
+//	409 Conflict:              the key (domain, class) exists or is being written by someone else
+//	502 Bad Gateway:           a tracker or storage node failed or returned garbage
+//	503 Service Unavailable:   no devices (or trackers) are available, the client is shut down
+//	504 Gateway Timeout:       a tracker or storage node did not answer in time
+//	500 Internal Server Error: anything else (eg. unknown domains or classes)
+//
+// A nil error returns 200 OK.
+func HTTPStatus(err error) int {
+	var tracker_err *TrackerError
+	var storage_err *StorageError
+	var net_err net.Error
+
+	switch {
+	case err == nil:
+		return http.StatusOK
+	case errors.Is(err, ErrUnknownKey), errors.Is(err, ErrNoneMatch):
+		return http.StatusNotFound
+	case errors.Is(err, ErrKeyExists), errors.Is(err, ErrDomainExists), errors.Is(err, ErrClassExists),
+		errors.Is(err, ErrConcurrentCreate), errors.Is(err, ErrKeyLocked):
+		return http.StatusConflict
+	case errors.Is(err, ErrNoDevices), errors.Is(err, ErrNoTempFile), errors.Is(err, ErrClientClosed),
+		errors.Is(err, context.Canceled):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, ErrStorageStalled), errors.As(err, &net_err) && net_err.Timeout():
+		return http.StatusGatewayTimeout
+	case errors.Is(err, ErrSizeMismatch), errors.Is(err, ErrChecksumMismatch):
+		return http.StatusBadGateway
+	case errors.As(err, &tracker_err):
+		return http.StatusInternalServerError
+	case errors.As(err, &storage_err), errors.As(err, &net_err):
+		return http.StatusBadGateway
+	}
+	return http.StatusInternalServerError
+}
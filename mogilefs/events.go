@@ -0,0 +1,83 @@
+/*
+
+Copyright 2015 Adrian Ulrich
+Copyright 2015 Fixxpunkt AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package mogilefs
+
+import (
+	"context"
+	"time"
+)
+
+// The kind of an Event
+type EventType string
+
+const (
+	// A key was uploaded (or replaced by a new upload)
+	EventCreated EventType = "created"
+	// A key was deleted
+	EventDeleted EventType = "deleted"
+	// A key was renamed
+	EventRenamed EventType = "renamed"
+)
+
+// A successful mutation of a key, passed to the EventSink
+type Event struct {
+	// What happened to the key
+	Type EventType
+	// When the mutation was started
+	Time time.Time
+	// The key, for EventRenamed the old name of the key
+	Key string
+	// The new name of the key, only set for EventRenamed
+	NewKey string
+	// The file id of the upload, only set for EventCreated
+	Fid string
+	// The size of the upload in bytes, -1 if unknown
+	Size int64
+	// The class of the upload, only set for EventCreated (an empty string for the default class)
+	Class string
+	// Time it took to execute the mutation
+	Duration time.Duration
+}
+
+// Receives events about keys created, deleted or renamed by the client, see WithEventSink()
+type EventSink interface {
+	Emit(ctx context.Context, event Event)
+}
+
+// Passes an Event to sink after each successful upload, delete and rename.
+//
+// Meant to keep other systems (eg. a search index or a CDN) in sync with the filesystem
+// without wrapping every call site. Failed mutations are not reported, see WithAuditHook
+// for a log of all modifying commands. Uploads finished by CreateClose() are reported
+// without class. Emit is called synchronously with the context of the mutation (see the
+// *Context variants of the client functions) and must be safe for concurrent use: hand
+// slow work off to a queue.
+func WithEventSink(sink EventSink) Option {
+	return func(m *MogileFsClient) {
+		m.event_sink = sink
+	}
+}
+
+/**
+ * @desc Passes event to the event sink, if any
+ */
+func (m *MogileFsClient) emit(ctx context.Context, event Event) {
+	if m.event_sink != nil {
+		m.event_sink.Emit(ctx, event)
+	}
+}
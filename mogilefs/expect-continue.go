@@ -0,0 +1,42 @@
+/*
+
+Copyright 2015 Adrian Ulrich
+Copyright 2015 Fixxpunkt AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package mogilefs
+
+// Sends 'Expect: 100-continue' with uploads of more than size bytes (default: 0, disabled).
+//
+// A storage node refusing the upload (eg. because its device is full) then does so before
+// the data is transferred, and the next destination returned by the tracker is tried.
+// Only uploads of a known size are affected: pass CreateOpts.Size for streams (readers
+// implementing io.Seeker are measured automatically).
+//
+// Note: the http.Client must wait for the '100 Continue' reply, see
+// http.Transport.ExpectContinueTimeout. The default client waits up to 1 second before
+// sending the data anyway, as some storage nodes never reply with '100 Continue'.
+func WithExpectContinue(size int64) Option {
+	return func(m *MogileFsClient) {
+		m.expect_threshold = size
+	}
+}
+
+/**
+ * @desc Returns true if an upload of size bytes should wait for '100 Continue'
+ * @param size int64 the size of the upload, 0 if unknown
+ */
+func (m *MogileFsClient) expectContinue(size int64) bool {
+	return m.expect_threshold > 0 && size > m.expect_threshold
+}
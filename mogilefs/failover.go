@@ -0,0 +1,136 @@
+/*
+
+Copyright 2015 Adrian Ulrich
+Copyright 2015 Fixxpunkt AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package mogilefs
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Counters of WithStandby(), returned by FailoverStats()
+type FailoverStats struct {
+	// Number of path lookups served by the primary and by the standby cluster
+	Primary uint64
+	Standby uint64
+	// True if lookups currently go to the standby cluster
+	OnStandby bool
+}
+
+// Configures a standby cluster used for reads if the primary cluster is unavailable.
+//
+// If none of the trackers of the client can be reached, GetPaths (and everything reading
+// keys, such as Fetch) is served by a client of the standby cluster, created using domain,
+// trackers and opts. Once failed over, the primary trackers are tried again every 30 seconds
+// (see WithFailbackInterval): lookups return to the primary cluster as soon as it answers.
+// Writes are never sent to the standby cluster.
+func WithStandby(domain string, trackers []string, opts ...Option) Option {
+	return func(m *MogileFsClient) {
+		m.failover = &failover{standby: New(domain, trackers, opts...), interval: time.Duration(30) * time.Second}
+	}
+}
+
+// Sets how often the primary cluster is tried while failed over to the standby cluster.
+//
+// Must be passed to New() after WithStandby().
+func WithFailbackInterval(interval time.Duration) Option {
+	return func(m *MogileFsClient) {
+		if m.failover != nil {
+			m.failover.interval = interval
+		}
+	}
+}
+
+// Returns the counters of the standby cluster, see WithStandby()
+func (m *MogileFsClient) FailoverStats() (stats FailoverStats) {
+	if f := m.failover; f != nil {
+		f.mutex.Lock()
+		stats.OnStandby = f.on_standby
+		f.mutex.Unlock()
+		stats.Primary = atomic.LoadUint64(&f.primary_served)
+		stats.Standby = atomic.LoadUint64(&f.standby_served)
+	}
+	return
+}
+
+// State of WithStandby()
+type failover struct {
+	standby  *MogileFsClient
+	interval time.Duration
+	mutex    sync.Mutex
+	// true while the primary cluster is unavailable
+	on_standby bool
+	// when the primary cluster is tried the next time
+	next_probe time.Time
+	// number of lookups served by each cluster
+	primary_served uint64
+	standby_served uint64
+}
+
+/**
+ * @desc Returns true if a lookup should skip the primary cluster
+ */
+func (f *failover) skipPrimary() bool {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if !f.on_standby {
+		return false
+	}
+	if time.Now().After(f.next_probe) {
+		// let this lookup probe the primary cluster
+		f.next_probe = time.Now().Add(f.interval)
+		return false
+	}
+	return true
+}
+
+/**
+ * @desc Records the outcome of a request to the primary cluster
+ * @return down bool true if the primary cluster is unavailable and the standby should be used
+ */
+func (f *failover) primaryResult(err error) (down bool) {
+	var tracker_err *TrackerError
+	down = err != nil && !errors.As(err, &tracker_err) && !errors.Is(err, context.Canceled) && !errors.Is(err, ErrClientClosed)
+
+	f.mutex.Lock()
+	if down && !f.on_standby {
+		f.on_standby = true
+		f.next_probe = time.Now().Add(f.interval)
+	} else if !down {
+		f.on_standby = false
+	}
+	f.mutex.Unlock()
+
+	if !down {
+		atomic.AddUint64(&f.primary_served, 1)
+	}
+	return
+}
+
+/**
+ * @desc Looks up the paths of key using the standby cluster
+ */
+func (f *failover) lookupPaths(ctx context.Context, key string, opts *GetPathsOpts) (result PathsResult, err error) {
+	atomic.AddUint64(&f.standby_served, 1)
+	result, err = f.standby.LookupPathsContext(ctx, key, opts)
+	result.Standby = true
+	return
+}
@@ -0,0 +1,43 @@
+/*
+
+Copyright 2015 Adrian Ulrich
+Copyright 2015 Fixxpunkt AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package mogilefs
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCloseClosesStandby(t *testing.T) {
+	m := New("test", []string{"127.0.0.1:1"}, WithStandby("test", []string{"127.0.0.1:1"}, WithHealthCheck(time.Hour)))
+	standby := m.failover.standby
+
+	if err := m.Close(context.Background()); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if !standby.lifecycle.isDrained() {
+		t.Errorf("standby client not closed")
+	}
+	if standby.lifecycle.ctx.Err() == nil {
+		t.Errorf("health check of the standby client still running")
+	}
+	if _, err := standby.Fetch("k"); !errors.Is(err, ErrClientClosed) {
+		t.Errorf("Fetch on standby = %v, want ErrClientClosed", err)
+	}
+}
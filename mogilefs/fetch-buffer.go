@@ -0,0 +1,171 @@
+/*
+
+Copyright 2015 Adrian Ulrich
+Copyright 2015 Fixxpunkt AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package mogilefs
+
+import (
+	"bufio"
+	"io"
+	"sync"
+)
+
+// Optional argument to the FetchWithOpts function
+type FetchOpts struct {
+	// Size of the read buffer in bytes, 0 for no buffering (or 256KiB if Prefetch is set)
+	BufferSize int
+	// Read the next BufferSize bytes in the background while the caller consumes the current ones
+	Prefetch bool
+	// Compare the stored bytes with the checksum known by the tracker (see FileInfo).
+	//
+	// Reading the end of the contents returns ErrChecksumMismatch instead of io.EOF if they
+	// differ. Keys without a checksum are not verified.
+	VerifyChecksum bool
+	// Decompress gzip compressed contents (detected by their magic bytes), other contents are returned as stored
+	Decompress bool
+	// Called while reading, may be nil. Counts the stored bytes, ie. before decompression
+	Progress ProgressFunc
+}
+
+// Returns an io.ReadCloser with the contents of the requested key, see Fetch().
+//
+// Buffering helps consumers reading in tiny chunks (eg. a bufio.Scanner over a large
+// log file), prefetching keeps the storage node busy while the caller processes data.
+// Passing nil as opts is the same as calling Fetch().
+//
+// If both VerifyChecksum and Decompress are set, the checksum is computed over the stored
+// (compressed) bytes, as the tracker knows the checksum of those. Decompression happens
+// after verification, so a corrupt file is reported as ErrChecksumMismatch rather than
+// as a decompression error wherever possible.
+func (m *MogileFsClient) FetchWithOpts(key string, opts *FetchOpts) (r io.ReadCloser, err error) {
+	checksum := ""
+	if opts != nil && opts.VerifyChecksum {
+		var info FileInfo
+		if info, err = m.FileInfo(key); err != nil {
+			return
+		}
+		checksum = info.Checksum
+	}
+	r, total, err := m.FetchRange(key, 0, -1)
+	if err != nil || opts == nil {
+		return
+	}
+	if opts.Progress != nil {
+		r = &progressReadCloser{progressReader: progressReader{r: r, progress: opts.Progress, total: total}, Closer: r}
+	}
+
+	// order matters: verify the stored bytes, then buffer them, then decompress
+	if len(checksum) > 0 {
+		if r, err = newVerifyingReader(r, checksum); err != nil {
+			return
+		}
+	}
+
+	size := opts.BufferSize
+	if opts.Prefetch {
+		if size <= 0 {
+			size = 256 * 1024
+		}
+		r = newPrefetchReader(r, size)
+	} else if size > 0 {
+		r = &limitedReadCloser{Reader: bufio.NewReaderSize(r, size), Closer: r}
+	}
+	if opts.Decompress {
+		r, err = newDecompressingReader(r)
+	}
+	return
+}
+
+// Reads ahead of its consumer using two buffers
+type prefetchReader struct {
+	r io.ReadCloser
+	// filled buffers, closed after the last one
+	chunks chan []byte
+	// empty buffers to fill
+	free chan []byte
+	// closed by Close()
+	stop      chan struct{}
+	stop_once sync.Once
+	// the error which ended reading, valid once chunks is closed
+	err error
+	// the buffer being consumed and the unread part of it
+	current []byte
+	unread  []byte
+}
+
+func newPrefetchReader(r io.ReadCloser, size int) *prefetchReader {
+	pr := &prefetchReader{r: r, chunks: make(chan []byte, 1), free: make(chan []byte, 2), stop: make(chan struct{})}
+	pr.free <- make([]byte, size)
+	pr.free <- make([]byte, size)
+	go pr.fill()
+	return pr
+}
+
+/**
+ * @desc Reads from r into free buffers until r fails or the reader is closed, closes r afterwards
+ */
+func (pr *prefetchReader) fill() {
+	// r is only touched by this goroutine: closing it here avoids racing with a pending Read
+	defer pr.r.Close()
+	defer close(pr.chunks)
+	for {
+		var buf []byte
+		select {
+		case buf = <-pr.free:
+		case <-pr.stop:
+			pr.err = io.ErrClosedPipe
+			return
+		}
+
+		n, err := io.ReadAtLeast(pr.r, buf[:cap(buf)], 1)
+		if n > 0 {
+			select {
+			case pr.chunks <- buf[:n]:
+			case <-pr.stop:
+				pr.err = io.ErrClosedPipe
+				return
+			}
+		}
+		if err != nil {
+			pr.err = err
+			return
+		}
+	}
+}
+
+func (pr *prefetchReader) Read(buffer []byte) (nr int, err error) {
+	if len(pr.unread) == 0 {
+		if pr.current != nil {
+			pr.free <- pr.current
+			pr.current = nil
+		}
+		chunk, ok := <-pr.chunks
+		if !ok {
+			return 0, pr.err
+		}
+		pr.current, pr.unread = chunk, chunk
+	}
+	nr = copy(buffer, pr.unread)
+	pr.unread = pr.unread[nr:]
+	return
+}
+
+func (pr *prefetchReader) Close() error {
+	pr.stop_once.Do(func() {
+		close(pr.stop)
+	})
+	return nil
+}
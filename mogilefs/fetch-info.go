@@ -0,0 +1,64 @@
+/*
+
+Copyright 2015 Adrian Ulrich
+Copyright 2015 Fixxpunkt AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package mogilefs
+
+import (
+	"io"
+	"net/http"
+	"time"
+)
+
+// Metadata of a download, returned by FetchWithInfo()
+type FetchInfo struct {
+	// The path the download started at. The reader continues on another replica if this one fails
+	Path string
+	// Size of the file in bytes, -1 if unknown
+	Size int64
+	// Last-Modified as sent by the storage node, the zero time if unknown
+	LastModified time.Time
+	// Content-Type as sent by the storage node, an empty string if unknown
+	ContentType string
+}
+
+// Returns an io.ReadCloser with the contents of the requested key and metadata of the download, see Fetch().
+//
+// Meant for serving the contents again (eg. over HTTP) without sending an extra HEAD
+// request. The metadata is the one of the storage node the download started at. Custom
+// storage transports (see WithStorageTransport) may not provide Last-Modified and
+// Content-Type.
+func (m *MogileFsClient) FetchWithInfo(key string) (r io.ReadCloser, info FetchInfo, err error) {
+	if err = m.lifecycle.begin(); err != nil {
+		return
+	}
+	paths, err := m.GetPaths(key, nil)
+	if err == nil {
+		header := make(http.Header)
+		r, info.Size, info.Path, err = m.openPaths(paths, 0, -1, header)
+		if err == nil {
+			info.ContentType = header.Get("Content-Type")
+			if modified, perr := http.ParseTime(header.Get("Last-Modified")); perr == nil {
+				info.LastModified = modified
+			}
+		}
+	}
+	if r == nil {
+		m.lifecycle.end()
+		info.Path = ""
+	}
+	return
+}
@@ -0,0 +1,222 @@
+/*
+
+Copyright 2015 Adrian Ulrich
+Copyright 2015 Fixxpunkt AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package mogilefs
+
+import (
+	"io"
+	"sync"
+)
+
+// Optional argument to the FetchMulti function
+type FetchMultiOpts struct {
+	// Maximum number of keys fetched at the same time (default: 8)
+	Concurrency int
+	// Maximum number of keys fetched from the same storage node at the same time, 0 for no limit
+	PerHostConcurrency int
+}
+
+// Result of FetchMulti for a single key
+type FetchResult struct {
+	// The requested key
+	Key string
+	// The contents of Key, nil on errors
+	Data []byte
+	// The error of this key - nil on success
+	Err error
+}
+
+// Returns the contents of multiple keys.
+//
+// The keys are looked up and fetched in parallel. The results are returned in the order
+// of keys, each with its own error: a failing key (eg. one without copies, which fails
+// with ErrNoPaths) does not affect the other keys.
+// This is meant for small objects, as each result is held in memory.
+//
+// If opts limits the concurrency per storage node, the paths of all keys are looked up
+// first. The keys are then grouped by the storage node of their preferred path, and the
+// groups are served in turns, so a small fleet of storage nodes is loaded evenly instead
+// of by bursts. A key whose preferred storage node fails is fetched from another replica,
+// which may exceed the limit of that storage node for a while.
+func (m *MogileFsClient) FetchMulti(keys []string, opts *FetchMultiOpts) (results []FetchResult) {
+	concurrency := 8
+	if opts != nil && opts.Concurrency > 0 {
+		concurrency = opts.Concurrency
+	}
+	if opts != nil && opts.PerHostConcurrency > 0 {
+		return m.fetchMultiPerHost(keys, concurrency, opts.PerHostConcurrency)
+	}
+
+	results = make([]FetchResult, len(keys))
+	slots := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, key := range keys {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(result *FetchResult, key string) {
+			defer wg.Done()
+			result.Key = key
+			result.Data, result.Err = m.FetchBytes(key)
+			<-slots
+		}(&results[i], key)
+	}
+	wg.Wait()
+	return
+}
+
+/**
+ * @desc Fetches keys with at most concurrency fetches in total and per_host fetches per storage node, see FetchMulti()
+ */
+func (m *MogileFsClient) fetchMultiPerHost(keys []string, concurrency int, per_host int) (results []FetchResult) {
+	results = make([]FetchResult, len(keys))
+	paths := make([][]string, len(keys))
+
+	// look up all keys, so we know the storage node of each key
+	slots := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, key := range keys {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(i int, key string) {
+			defer wg.Done()
+			results[i].Key = key
+			paths[i], results[i].Err = m.GetPaths(key, nil)
+			<-slots
+		}(i, key)
+	}
+	wg.Wait()
+
+	// queue the keys by the storage node of their preferred path
+	var hosts []string
+	queues := make(map[string][]int)
+	for i := range keys {
+		if results[i].Err == nil && len(paths[i]) == 0 {
+			results[i].Err = ErrNoPaths
+		}
+		if results[i].Err != nil {
+			continue
+		}
+		host := StorageHost(paths[i][0])
+		if _, ok := queues[host]; !ok {
+			hosts = append(hosts, host)
+		}
+		queues[host] = append(queues[host], i)
+	}
+
+	var mutex sync.Mutex
+	cond := sync.NewCond(&mutex)
+	active := make(map[string]int)
+	pending := len(hosts)
+	next_host := 0
+
+	// picks the next key of a storage node below its limit, taking the storage nodes in turns.
+	// Returns -1 once all keys were handed out
+	next := func() (i int, host string) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		for pending > 0 {
+			for n := 0; n < len(hosts); n++ {
+				host = hosts[(next_host+n)%len(hosts)]
+				if len(queues[host]) > 0 && active[host] < per_host {
+					i, queues[host] = queues[host][0], queues[host][1:]
+					if len(queues[host]) == 0 {
+						pending--
+					}
+					active[host]++
+					next_host = (next_host + n + 1) % len(hosts)
+					return
+				}
+			}
+			cond.Wait()
+		}
+		return -1, ""
+	}
+
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				i, host := next()
+				if i < 0 {
+					return
+				}
+				results[i].Data, results[i].Err = m.fetchPathsBytes(paths[i])
+
+				mutex.Lock()
+				active[host]--
+				mutex.Unlock()
+				cond.Broadcast()
+			}
+		}()
+	}
+	wg.Wait()
+	return
+}
+
+/**
+ * @desc Returns the contents of the first working path
+ */
+func (m *MogileFsClient) fetchPathsBytes(paths []string) (data []byte, err error) {
+	if err = m.lifecycle.begin(); err != nil {
+		return
+	}
+	r, _, err := m.fetchPaths(paths, 0, -1)
+	if r == nil {
+		m.lifecycle.end()
+	}
+	if err == nil {
+		data, err = io.ReadAll(r)
+		r.Close()
+	}
+	return
+}
+
+// Returns the paths of multiple keys, see GetPaths().
+//
+// The keys are looked up in parallel (up to 8 at the same time, further limited by the
+// tracker pool, see WithTrackerPool). Keys which could not be looked up are missing in
+// paths and have their error in errs, errs is nil if all keys were found.
+func (m *MogileFsClient) GetPathsMulti(keys []string, opts *GetPathsOpts) (paths map[string][]string, errs map[string]error) {
+	paths = make(map[string][]string, len(keys))
+
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, 8)
+	for _, key := range keys {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(key string) {
+			defer wg.Done()
+			key_paths, err := m.GetPaths(key, opts)
+			<-slots
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			if err != nil {
+				if errs == nil {
+					errs = make(map[string]error)
+				}
+				errs[key] = err
+			} else {
+				paths[key] = key_paths
+			}
+		}(key)
+	}
+	wg.Wait()
+	return
+}
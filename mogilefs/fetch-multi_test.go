@@ -0,0 +1,73 @@
+/*
+
+Copyright 2015 Adrian Ulrich
+Copyright 2015 Fixxpunkt AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package mogilefs
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+/**
+ * @desc Returns a client of a tracker knowing no copies of the key 'empty' and one copy of all other keys, containing 'data'
+ */
+func newMultiClient(t *testing.T) *MogileFsClient {
+	t.Helper()
+	storage := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("data"))
+	}))
+	t.Cleanup(storage.Close)
+
+	tracker := newScriptedTracker(t, func(command string, args url.Values) string {
+		if command != cmd_getpaths {
+			return "ERR unknown_command Unknown+server+command"
+		}
+		if args.Get("key") == "empty" {
+			return "OK paths=0"
+		}
+		return "OK " + url.Values{"paths": {"1"}, "path1": {storage.URL + "/" + args.Get("key")}}.Encode()
+	})
+	return New("test", []string{tracker})
+}
+
+/**
+ * @desc Fails the test unless results hold 'data' for a and b and ErrNoPaths for empty
+ */
+func checkMultiResults(t *testing.T, results []FetchResult) {
+	t.Helper()
+	for _, result := range results {
+		switch {
+		case result.Key == "empty" && !errors.Is(result.Err, ErrNoPaths):
+			t.Errorf("key without paths: data %q, err %v, want ErrNoPaths", result.Data, result.Err)
+		case result.Key != "empty" && (result.Err != nil || string(result.Data) != "data"):
+			t.Errorf("key %s: data %q, err %v", result.Key, result.Data, result.Err)
+		}
+	}
+}
+
+func TestFetchMultiKeyWithoutPaths(t *testing.T) {
+	m := newMultiClient(t)
+	checkMultiResults(t, m.FetchMulti([]string{"a", "empty", "b"}, nil))
+}
+
+func TestFetchMultiPerHostKeyWithoutPaths(t *testing.T) {
+	m := newMultiClient(t)
+	checkMultiResults(t, m.FetchMulti([]string{"a", "empty", "b"}, &FetchMultiOpts{PerHostConcurrency: 1}))
+}
@@ -0,0 +1,96 @@
+/*
+
+Copyright 2015 Adrian Ulrich
+Copyright 2015 Fixxpunkt AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package mogilefs
+
+import (
+	"io"
+)
+
+// fetchReader returns the body of a storage node and continues on the next
+// replica if the storage node fails while sending the body
+type fetchReader struct {
+	m *MogileFsClient
+	// the body we are currently reading from and its path
+	body io.ReadCloser
+	path string
+	// replicas to try if body fails
+	paths []string
+	// the offset of the first byte and the number of bytes requested, <= 0 if unlimited
+	start  int64
+	length int64
+	// number of bytes returned so far
+	offset int64
+	// called once the reader is closed - may be nil
+	done func()
+}
+
+func (fr *fetchReader) Read(buffer []byte) (nr int, err error) {
+	for {
+		nr, err = fr.body.Read(buffer)
+		fr.offset += int64(nr)
+
+		if err == nil || err == io.EOF {
+			return
+		}
+		fr.m.markPathFailed(fr.path)
+		fr.m.observeStorage(fr.path, err)
+		if rerr := fr.resume(); rerr != nil {
+			// keep the original error: it is more helpful than the failure of the last replica
+			return
+		}
+		if nr > 0 {
+			return nr, nil
+		}
+	}
+}
+
+func (fr *fetchReader) Close() error {
+	if fr.done != nil {
+		fr.done()
+		fr.done = nil
+	}
+	return fr.body.Close()
+}
+
+/**
+ * @desc Replaces the failed body with the body of the next working replica, starting at the current offset
+ * @return err error set if no replica could be used
+ */
+func (fr *fetchReader) resume() (err error) {
+	fr.body.Close()
+	err = io.ErrUnexpectedEOF
+
+	length := int64(-1)
+	if fr.length > 0 {
+		length = fr.length - fr.offset
+	}
+
+	for len(fr.paths) > 0 {
+		path := fr.paths[0]
+		fr.paths = fr.paths[1:]
+
+		var body io.ReadCloser
+		if body, _, err = fr.m.transport.Get(fr.m.lifecycle.ctx, path, &StorageGetOpts{Offset: fr.start + fr.offset, Length: length}); err == nil {
+			fr.body = body
+			fr.path = path
+			break
+		}
+		fr.m.markPathFailed(path)
+	}
+	return
+}
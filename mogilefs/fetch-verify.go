@@ -0,0 +1,81 @@
+/*
+
+Copyright 2015 Adrian Ulrich
+Copyright 2015 Fixxpunkt AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package mogilefs
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"hash"
+	"io"
+	"strings"
+)
+
+// Computes the checksum of the data read and compares it with the expected checksum at io.EOF
+type verifyingReader struct {
+	r        io.ReadCloser
+	hashtype string
+	hasher   hash.Hash
+	expected string
+}
+
+/**
+ * @desc Returns a reader verifying that r matches checksum ('<hashtype>:<hex digest>'), closes r on errors
+ */
+func newVerifyingReader(r io.ReadCloser, checksum string) (vr *verifyingReader, err error) {
+	hashtype, _, _ := strings.Cut(checksum, ":")
+	hasher, err := newChecksumHash(hashtype)
+	if err != nil {
+		r.Close()
+		return
+	}
+	return &verifyingReader{r: r, hashtype: hashtype, hasher: hasher, expected: strings.ToLower(checksum)}, nil
+}
+
+func (vr *verifyingReader) Read(buffer []byte) (nr int, err error) {
+	nr, err = vr.r.Read(buffer)
+	vr.hasher.Write(buffer[:nr])
+	if err == io.EOF && strings.ToLower(checksumString(vr.hashtype, vr.hasher)) != vr.expected {
+		err = ErrChecksumMismatch
+	}
+	return
+}
+
+func (vr *verifyingReader) Close() error {
+	return vr.r.Close()
+}
+
+/**
+ * @desc Returns a reader decompressing r if it starts with the gzip magic bytes and r itself otherwise
+ */
+func newDecompressingReader(r io.ReadCloser) (rc io.ReadCloser, err error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(2)
+	if err == io.EOF || (err == nil && !bytes.Equal(magic, []byte{0x1f, 0x8b})) {
+		return &limitedReadCloser{Reader: br, Closer: r}, nil
+	}
+	var zr *gzip.Reader
+	if err == nil {
+		zr, err = gzip.NewReader(br)
+	}
+	if err != nil {
+		r.Close()
+		return
+	}
+	return &limitedReadCloser{Reader: zr, Closer: r}, nil
+}
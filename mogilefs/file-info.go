@@ -0,0 +1,74 @@
+/*
+
+Copyright 2015 Adrian Ulrich
+Copyright 2015 Fixxpunkt AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package mogilefs
+
+import (
+	"context"
+	"net/url"
+)
+
+// Information about a key, returned by FileInfo()
+type FileInfo struct {
+	// The key
+	Key string `mogile:"-"`
+	// Domain and class of the key
+	Domain string `mogile:"domain"`
+	Class  string `mogile:"class"`
+	// The file id of the current contents of the key
+	Fid int64 `mogile:"fid"`
+	// Size of the contents in bytes
+	Length int64 `mogile:"length"`
+	// Number of devices holding a copy of the key
+	Devcount int `mogile:"devcount"`
+	// The checksum stored by the tracker (eg. 'MD5:d41d8cd98f00b204e9800998ecf8427e') - an empty string if none
+	Checksum string `mogile:"checksum"`
+	// The devices holding a copy of the key
+	Devids []int `mogile:"devids"`
+}
+
+// Returns the metadata of a key as known by the trackers.
+//
+// Unlike GetPaths, this does not touch any storage node.
+func (m *MogileFsClient) FileInfo(key string) (info FileInfo, err error) {
+	return m.FileInfoContext(context.Background(), key)
+}
+
+// Returns the metadata of a key, see FileInfo().
+//
+// ctx limits the time spent on the request.
+func (m *MogileFsClient) FileInfoContext(ctx context.Context, key string) (info FileInfo, err error) {
+	if err = m.checkKey(key); err != nil {
+		return
+	}
+
+	args := make(url.Values)
+	args.Add("domain", m.domain)
+	args.Add("key", m.encodeKey(key))
+	args.Add("devices", "1")
+
+	values, err := m.DoRequestContext(ctx, cmd_file_info, args)
+	if err == nil {
+		err = DecodeValues(values, &info)
+		info.Key = m.decodeKey(stringValue(values, "key"))
+		// mogilefsd sends 'NONE' if the class has no hashtype
+		if info.Checksum == hashtype_none {
+			info.Checksum = ""
+		}
+	}
+	return
+}
@@ -0,0 +1,204 @@
+/*
+
+Copyright 2015 Adrian Ulrich
+Copyright 2015 Fixxpunkt AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package mogilefs
+
+import (
+	"errors"
+	"io"
+)
+
+// A read-only handle of a key, returned by Open().
+//
+// File implements io.Reader, io.ReaderAt, io.Seeker and io.Closer using Range requests,
+// so it can be passed to archive/zip, archive/tar or http.ServeContent.
+// Failed requests are retried on the next replica.
+//
+// Unlike MogileFsClient, a File must not be used by multiple goroutines at once,
+// with the exception of ReadAt.
+type File struct {
+	m     *MogileFsClient
+	key   string
+	paths []string
+	size  int64
+	// position of Read()
+	offset int64
+	// body used by Read() and its position, nil if not opened yet
+	body        io.ReadCloser
+	body_offset int64
+	// set by Close()
+	closed bool
+	// returned by Stat(), nil if not fetched yet
+	info *FileInfo
+}
+
+var _ io.ReadSeekCloser = (*File)(nil)
+
+// Opens key for reading
+func (m *MogileFsClient) Open(key string) (f *File, err error) {
+	if err = m.lifecycle.begin(); err != nil {
+		return
+	}
+	paths, err := m.GetPaths(key, nil)
+	if err == nil && len(paths) == 0 {
+		err = ErrNoPaths
+	}
+
+	// find out the size of the file by fetching its first byte
+	size := int64(-1)
+	for _, path := range paths {
+		body, total, gerr := m.transport.Get(m.lifecycle.ctx, path, &StorageGetOpts{Length: 1})
+		if err = gerr; err == nil {
+			body.Close()
+			size = total
+			break
+		}
+		m.markPathFailed(path)
+	}
+	if err == nil && size < 0 {
+		err = errors.New("internal:storage node did not return the size of the file")
+	}
+
+	if err == nil {
+		f = &File{m: m, key: key, paths: paths, size: size}
+	} else {
+		m.lifecycle.end()
+	}
+	return
+}
+
+// Returns the key of the file
+func (f *File) Name() string {
+	return f.key
+}
+
+// Returns the size of the file
+func (f *File) Size() int64 {
+	return f.size
+}
+
+// Returns the metadata of the file (size, class, checksum, ...) as known by the trackers.
+//
+// The metadata is fetched once using FileInfo(). Trackers not supporting the file_info
+// command only report the key, domain and size.
+func (f *File) Stat() (info FileInfo, err error) {
+	if f.info == nil {
+		info, err = f.m.FileInfo(f.key)
+		if errors.Is(err, ErrUnknownCommand) {
+			info, err = FileInfo{Key: f.key, Domain: f.m.domain, Length: f.size}, nil
+		}
+		if err != nil {
+			return
+		}
+		f.info = &info
+	}
+	return *f.info, nil
+}
+
+func (f *File) Read(buffer []byte) (nr int, err error) {
+	if f.offset >= f.size {
+		return 0, io.EOF
+	}
+
+	if f.body == nil || f.body_offset != f.offset {
+		f.closeBody()
+		f.body, err = f.openAt(f.offset, -1)
+		f.body_offset = f.offset
+	}
+
+	if err == nil {
+		nr, err = f.body.Read(buffer)
+		f.offset += int64(nr)
+		f.body_offset += int64(nr)
+	}
+	return
+}
+
+func (f *File) ReadAt(buffer []byte, off int64) (nr int, err error) {
+	if off >= f.size {
+		return 0, io.EOF
+	}
+	if len(buffer) == 0 {
+		// a Range of 0 bytes can not be requested: it would return everything after off
+		return 0, nil
+	}
+
+	want := int64(len(buffer))
+	if off+want > f.size {
+		want = f.size - off
+	}
+
+	body, err := f.openAt(off, want)
+	if err == nil {
+		nr, err = io.ReadFull(body, buffer[:want])
+		body.Close()
+	}
+	if err == nil && want < int64(len(buffer)) {
+		err = io.EOF
+	}
+	return
+}
+
+func (f *File) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += f.size
+	default:
+		return f.offset, errors.New("internal:invalid whence")
+	}
+	if offset < 0 {
+		return f.offset, errors.New("internal:negative position")
+	}
+	f.offset = offset
+	return f.offset, nil
+}
+
+func (f *File) Close() error {
+	f.closeBody()
+	if !f.closed {
+		f.closed = true
+		f.m.lifecycle.end()
+	}
+	return nil
+}
+
+/**
+ * @desc Returns length bytes starting at offset, using the first working replica
+ * @param offset int64 position of the first byte
+ * @param length int64 number of bytes to read, <= 0 to read until the end of the file
+ */
+func (f *File) openAt(offset int64, length int64) (r io.ReadCloser, err error) {
+	for i, path := range f.paths {
+		body, _, gerr := f.m.transport.Get(f.m.lifecycle.ctx, path, &StorageGetOpts{Offset: offset, Length: length})
+		if err = gerr; err == nil {
+			r = &fetchReader{m: f.m, body: body, path: path, paths: f.paths[i+1:], start: offset, length: length}
+			break
+		}
+		f.m.markPathFailed(path)
+	}
+	return
+}
+
+func (f *File) closeBody() {
+	if f.body != nil {
+		f.body.Close()
+		f.body = nil
+	}
+}
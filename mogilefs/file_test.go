@@ -0,0 +1,73 @@
+/*
+
+Copyright 2015 Adrian Ulrich
+Copyright 2015 Fixxpunkt AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package mogilefs_test
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/adrian-bl/golang-mogilefs-client/mogilefs"
+)
+
+// Counts the requests sent to storage nodes
+type storageCounter struct {
+	mutex sync.Mutex
+	gets  int
+}
+
+func (c *storageCounter) BeforeRequest(ctx context.Context, info *mogilefs.RequestInfo) context.Context {
+	return ctx
+}
+
+func (c *storageCounter) AfterRequest(ctx context.Context, info *mogilefs.RequestInfo, duration time.Duration, err error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if info.Kind == mogilefs.RequestStorage && info.Command == "GET" {
+		c.gets++
+	}
+}
+
+func TestFileReadAtEmptyBuffer(t *testing.T) {
+	counter := &storageCounter{}
+	mc, _ := newTestClient(t, mogilefs.WithHooks(counter))
+	if _, err := mc.Create("k", "", strings.NewReader("data")); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	f, err := mc.Open("k")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer f.Close()
+	// Open fetches the first byte to learn the size of the file
+	counter.mutex.Lock()
+	opened := counter.gets
+	counter.mutex.Unlock()
+
+	if n, err := f.ReadAt([]byte{}, 1); n != 0 || err != nil {
+		t.Errorf("ReadAt of an empty buffer = %d, %v, want 0, nil", n, err)
+	}
+	counter.mutex.Lock()
+	defer counter.mutex.Unlock()
+	if n := counter.gets - opened; n != 0 {
+		t.Errorf("ReadAt of an empty buffer sent %d GET requests, want none", n)
+	}
+}
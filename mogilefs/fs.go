@@ -0,0 +1,221 @@
+/*
+
+Copyright 2015 Adrian Ulrich
+Copyright 2015 Fixxpunkt AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package mogilefs
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// A read-only io/fs view of the domain of a client, returned by FS().
+//
+// Keys are treated as slash separated paths: the key 'img/2015/logo.png' shows up as file
+// 'logo.png' in the directory 'img/2015'. Directories only exist implicitly and are built
+// from list_keys results, so listing the root of a big domain walks all of its keys.
+//
+// Example:
+//
+//	http.Handle("/", http.FileServer(http.FS(mc.FS())))
+type DomainFS struct {
+	m *MogileFsClient
+}
+
+var (
+	_ fs.StatFS    = (*DomainFS)(nil)
+	_ fs.ReadDirFS = (*DomainFS)(nil)
+)
+
+// Returns an io/fs view of the domain of the client
+func (m *MogileFsClient) FS() *DomainFS {
+	return &DomainFS{m: m}
+}
+
+// Opens the key 'name' or the implicit directory 'name'
+func (dfs *DomainFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+
+	if name != "." {
+		f, err := dfs.m.Open(name)
+		if err == nil {
+			return &fsFile{File: f}, nil
+		}
+		if !errors.Is(err, ErrUnknownKey) {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+	}
+
+	entries, err := dfs.ReadDir(name)
+	if err != nil {
+		return nil, err
+	}
+	return &fsDir{name: name, entries: entries}, nil
+}
+
+// Returns information about the key or implicit directory 'name'
+func (dfs *DomainFS) Stat(name string) (fs.FileInfo, error) {
+	f, err := dfs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return f.Stat()
+}
+
+// Returns the keys and implicit directories below the directory 'name', sorted by name
+func (dfs *DomainFS) ReadDir(name string) (entries []fs.DirEntry, err error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+
+	prefix := ""
+	if name != "." {
+		prefix = name + "/"
+	}
+
+	seen := make(map[string]bool)
+	it := dfs.m.NewKeyIterator(prefix, "")
+	for it.Next() {
+		child := strings.TrimPrefix(it.Key(), prefix)
+		isDir := false
+		if i := strings.Index(child, "/"); i >= 0 {
+			child, isDir = child[:i], true
+		}
+		if len(child) == 0 || seen[child] {
+			continue
+		}
+		seen[child] = true
+
+		if isDir {
+			entries = append(entries, fs.FileInfoToDirEntry(&fsFileInfo{name: child, dir: true}))
+		} else {
+			entries = append(entries, &fsDirEntry{dfs: dfs, key: prefix + child})
+		}
+	}
+
+	if err = it.Err(); err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	if len(entries) == 0 && name != "." {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+// A key opened by DomainFS
+type fsFile struct {
+	*File
+}
+
+func (f *fsFile) Stat() (fs.FileInfo, error) {
+	return &fsFileInfo{name: path.Base(f.Name()), size: f.Size()}, nil
+}
+
+// An implicit directory opened by DomainFS
+type fsDir struct {
+	name    string
+	entries []fs.DirEntry
+	offset  int
+}
+
+func (d *fsDir) Stat() (fs.FileInfo, error) {
+	return &fsFileInfo{name: path.Base(d.name), dir: true}, nil
+}
+
+func (d *fsDir) Read(buffer []byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.name, Err: errors.New("is a directory")}
+}
+
+func (d *fsDir) Close() error {
+	return nil
+}
+
+func (d *fsDir) ReadDir(n int) (entries []fs.DirEntry, err error) {
+	remaining := d.entries[d.offset:]
+	if n > 0 && len(remaining) == 0 {
+		return nil, io.EOF
+	}
+	if n > 0 && n < len(remaining) {
+		remaining = remaining[:n]
+	}
+	d.offset += len(remaining)
+	return remaining, nil
+}
+
+// A key returned by DomainFS.ReadDir, its size is only fetched if Info() is called
+type fsDirEntry struct {
+	dfs *DomainFS
+	key string
+}
+
+func (e *fsDirEntry) Name() string {
+	return path.Base(e.key)
+}
+
+func (e *fsDirEntry) IsDir() bool {
+	return false
+}
+
+func (e *fsDirEntry) Type() fs.FileMode {
+	return 0
+}
+
+func (e *fsDirEntry) Info() (fs.FileInfo, error) {
+	return e.dfs.Stat(e.key)
+}
+
+type fsFileInfo struct {
+	name string
+	size int64
+	dir  bool
+}
+
+func (fi *fsFileInfo) Name() string {
+	return fi.name
+}
+
+func (fi *fsFileInfo) Size() int64 {
+	return fi.size
+}
+
+func (fi *fsFileInfo) Mode() fs.FileMode {
+	if fi.dir {
+		return fs.ModeDir | 0555
+	}
+	return 0444
+}
+
+// MogileFS does not keep track of modification times
+func (fi *fsFileInfo) ModTime() time.Time {
+	return time.Time{}
+}
+
+func (fi *fsFileInfo) IsDir() bool {
+	return fi.dir
+}
+
+func (fi *fsFileInfo) Sys() interface{} {
+	return nil
+}
@@ -0,0 +1,108 @@
+/*
+
+Copyright 2015 Adrian Ulrich
+Copyright 2015 Fixxpunkt AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package mogilefs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+const (
+	// How often GetOrCreate checks if another process finished generating a key
+	generate_poll_interval = time.Duration(250) * time.Millisecond
+)
+
+// Sets the lifetime of the lock held by GetOrCreate while generating a key (default: 5 minutes).
+//
+// The generator must finish within this time, otherwise another process may start generating the same key.
+func WithGenerateLockTTL(ttl time.Duration) Option {
+	return func(m *MogileFsClient) {
+		m.generate_lock_ttl = ttl
+	}
+}
+
+// Returns the contents of key, creating it using generate if it does not exist yet.
+//
+// This implements the usual pattern of derived assets (eg. thumbnails): generate writes
+// the contents of key to the passed io.Writer, which is uploaded using the given class.
+// Concurrent calls for the same key within this client share a single execution of
+// generate, other processes are kept out by AcquireKeyLock(): they wait for the key to
+// show up instead of generating it once more. A key the trackers know no copies of is not
+// generated again: GetOrCreate returns ErrNoPaths.
+func (m *MogileFsClient) GetOrCreate(key string, class string, generate func(w io.Writer) error) (r io.ReadCloser, err error) {
+	r, err = m.Fetch(key)
+	if !errors.Is(err, ErrUnknownKey) {
+		return
+	}
+
+	_, err, _ = m.generate_flights.do(context.Background(), key, func() (interface{}, error) {
+		return nil, m.ensureGenerated(key, class, generate)
+	})
+	if err == nil {
+		r, err = m.Fetch(key)
+	}
+	return
+}
+
+/**
+ * @desc Makes sure that key exists: runs generate while holding the lock of key or waits for the lock holder
+ */
+func (m *MogileFsClient) ensureGenerated(key string, class string, generate func(w io.Writer) error) (err error) {
+	deadline := time.Now().Add(m.generate_lock_ttl)
+
+	for {
+		lock, lerr := m.AcquireKeyLock(key, m.generate_lock_ttl)
+		if lerr == nil {
+			defer lock.Release()
+			// the previous lock holder may have just finished
+			if _, err = m.GetPaths(key, nil); errors.Is(err, ErrUnknownKey) {
+				err = m.createGenerated(key, class, generate)
+			}
+			return
+		}
+		if !errors.Is(lerr, ErrKeyLocked) {
+			return lerr
+		}
+
+		// another process is generating the key: wait for it
+		if _, err = m.GetPaths(key, nil); err == nil || !errors.Is(err, ErrUnknownKey) {
+			return
+		}
+		if time.Now().After(deadline) {
+			return ErrKeyLocked
+		}
+		time.Sleep(generate_poll_interval)
+	}
+}
+
+/**
+ * @desc Uploads the output of generate as key
+ */
+func (m *MogileFsClient) createGenerated(key string, class string, generate func(w io.Writer) error) (err error) {
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(generate(pw))
+	}()
+
+	_, err = m.Create(key, class, pr)
+	// unblock the generator if the upload failed early
+	pr.CloseWithError(err)
+	return
+}
@@ -0,0 +1,36 @@
+/*
+
+Copyright 2015 Adrian Ulrich
+Copyright 2015 Fixxpunkt AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package mogilefs
+
+import (
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestGetOrCreateWithoutPaths(t *testing.T) {
+	m := newRecordedPathsClient(t, "get_paths of a key without copies")
+
+	r, err := m.GetOrCreate("k", "", func(w io.Writer) error {
+		t.Errorf("generated a key which exists")
+		return nil
+	})
+	if r != nil || !errors.Is(err, ErrNoPaths) {
+		t.Errorf("GetOrCreate = %v, %v, want ErrNoPaths", r, err)
+	}
+}
@@ -0,0 +1,81 @@
+/*
+
+Copyright 2015 Adrian Ulrich
+Copyright 2015 Fixxpunkt AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package mogilefs
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"time"
+)
+
+// Checks all trackers in the background every interval.
+//
+// Each tracker - including blacklisted ones - is sent a 'noop' command: trackers which
+// answer are removed from the blacklist, failing ones are added to it. This keeps the
+// blacklist up to date, so requests neither wait for a dead tracker nor avoid a tracker
+// which recovered. The checks stop once the client is closed, see Close().
+func WithHealthCheck(interval time.Duration) Option {
+	return func(m *MogileFsClient) {
+		m.health_interval = interval
+	}
+}
+
+/**
+ * @desc Checks the trackers every health_interval until the client is closed
+ */
+func (m *MogileFsClient) runHealthCheck() {
+	ticker := time.NewTicker(m.health_interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			m.checkTrackers()
+		case <-m.lifecycle.ctx.Done():
+			return
+		}
+	}
+}
+
+/**
+ * @desc Sends a noop command to each tracker, updating the blacklist
+ */
+func (m *MogileFsClient) checkTrackers() {
+	for _, host := range m.trackers {
+		// the probe must not delay the next round: a wedged tracker hits this deadline
+		// before the read and write timeouts if the interval is shorter
+		ctx, cancel := context.WithTimeout(context.WithValue(m.lifecycle.ctx, pinnedTrackerKey{}, host), m.health_interval)
+		// doSingleRequest updates the blacklist if the tracker answers or fails, but not if
+		// the context expires: here, that means the tracker did not answer in time
+		m.doSingleRequest(ctx, cmd_noop, make(url.Values))
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) && m.lifecycle.ctx.Err() == nil {
+			m.markTrackerAsBad(host)
+		}
+		cancel()
+	}
+}
+
+// Checks that a tracker can be reached by sending it a 'noop' command.
+//
+// This is meant for liveness checks (eg. of load balancers): unlike a real command, it
+// neither touches the database of the tracker nor any storage node.
+func (m *MogileFsClient) Ping(ctx context.Context) (err error) {
+	_, err = m.DoRequestContext(ctx, cmd_noop, make(url.Values))
+	return
+}
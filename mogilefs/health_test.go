@@ -0,0 +1,35 @@
+/*
+
+Copyright 2015 Adrian Ulrich
+Copyright 2015 Fixxpunkt AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package mogilefs
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHealthCheckBlacklistsWedgedTracker(t *testing.T) {
+	// the probes time out long before the read timeout of 30 seconds
+	m := New("test", []string{newWedgedTracker(t)})
+	m.health_interval = 20 * time.Millisecond
+	for i := 0; i < 3; i++ {
+		m.checkTrackers()
+	}
+	if len(m.BlacklistStatus()) != 1 {
+		t.Errorf("wedged tracker is not blacklisted after timing out health checks")
+	}
+}
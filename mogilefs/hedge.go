@@ -0,0 +1,102 @@
+/*
+
+Copyright 2015 Adrian Ulrich
+Copyright 2015 Fixxpunkt AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package mogilefs
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"time"
+)
+
+// Sends get_paths to a second tracker if the first one did not answer within delay.
+//
+// The first successful answer is used and the other request is cancelled. This hides
+// slow trackers (eg. due to slow database queries) from latency sensitive reads at the
+// cost of some additional tracker load. Pass 0 as delay to always ask two trackers at once.
+// Hedging requires at least two trackers which are not blacklisted.
+func WithHedgedGetPaths(delay time.Duration) Option {
+	return func(m *MogileFsClient) {
+		m.hedge_getpaths = true
+		m.hedge_delay = delay
+	}
+}
+
+type pinnedTrackerKey struct{}
+
+type hedgedReply struct {
+	values url.Values
+	err    error
+}
+
+/**
+ * @desc Sends command to up to two trackers, returning the first successful reply
+ * @param command string the mogilefsd command to execute, must be idempotent
+ * @param args url.Values list of the arguments of 'command'
+ */
+func (m *MogileFsClient) doHedgedRequest(ctx context.Context, command string, args url.Values) (values url.Values, err error) {
+	var candidates []string
+	for _, host := range m.selector.Order(m.trackers) {
+		if !m.trackerIsBad(host) {
+			candidates = append(candidates, host)
+		}
+	}
+	if len(candidates) < 2 {
+		return m.DoRequestContext(ctx, command, args)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	replies := make(chan hedgedReply, 2)
+	send := func(host string) {
+		v, e := m.DoRequestContext(context.WithValue(ctx, pinnedTrackerKey{}, host), command, args)
+		replies <- hedgedReply{values: v, err: e}
+	}
+
+	go send(candidates[0])
+	pending, hedged := 1, false
+	timer := time.NewTimer(m.hedge_delay)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-timer.C:
+			if !hedged {
+				hedged = true
+				pending++
+				go send(candidates[1])
+			}
+		case reply := <-replies:
+			pending--
+			var tracker_err *TrackerError
+			if reply.err == nil || errors.As(reply.err, &tracker_err) {
+				// a tracker answered: returning the reply cancels the other request
+				return reply.values, reply.err
+			}
+			values, err = reply.values, reply.err
+			if !hedged {
+				hedged = true
+				pending++
+				go send(candidates[1])
+			} else if pending == 0 {
+				return
+			}
+		}
+	}
+}
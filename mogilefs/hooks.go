@@ -0,0 +1,147 @@
+/*
+
+Copyright 2015 Adrian Ulrich
+Copyright 2015 Fixxpunkt AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package mogilefs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/url"
+	"time"
+)
+
+const (
+	// RequestInfo.Kind of tracker commands
+	RequestTracker = "tracker"
+	// RequestInfo.Kind of transfers from and to storage nodes
+	RequestStorage = "storage"
+)
+
+// Describes a request passed to Hooks
+type RequestInfo struct {
+	// RequestTracker or RequestStorage
+	Kind string
+	// The tracker command (eg. 'get_paths') or the HTTP method of a storage request (eg. 'PUT')
+	Command string
+	// The arguments of a tracker command - nil for storage requests
+	Args url.Values
+	// The tracker the command was sent to, only known after the request (may be an empty string)
+	Tracker string
+	// The URL of a storage request - an empty string for tracker commands
+	Path string
+}
+
+// Observes all requests of a client, see WithHooks().
+//
+// Each attempt of a tracker command (a retry is a new request) and each storage transfer
+// is passed to BeforeRequest and AfterRequest. The context returned by BeforeRequest is
+// used for the request and passed to AfterRequest, which allows hooks to attach values
+// (such as tracing spans) to it. Hooks must be safe for concurrent use.
+type Hooks interface {
+	BeforeRequest(ctx context.Context, info *RequestInfo) context.Context
+	AfterRequest(ctx context.Context, info *RequestInfo, duration time.Duration, err error)
+}
+
+// Adds hooks observing the requests of the client, eg. for logging, metrics or tracing.
+//
+// Hooks are called in the order they were added. Note that AfterRequest of a download is
+// called once the storage node answered, not once the body was read.
+func WithHooks(hooks ...Hooks) Option {
+	return func(m *MogileFsClient) {
+		m.hooks = append(m.hooks, hooks...)
+	}
+}
+
+/**
+ * @desc Passes a request about to be sent to all hooks, returns the context to use for the request
+ */
+func (m *MogileFsClient) beforeRequest(ctx context.Context, info *RequestInfo) context.Context {
+	for _, hook := range m.hooks {
+		ctx = hook.BeforeRequest(ctx, info)
+	}
+	return ctx
+}
+
+/**
+ * @desc Passes a finished request to all hooks
+ */
+func (m *MogileFsClient) afterRequest(ctx context.Context, info *RequestInfo, started time.Time, err error) {
+	duration := time.Since(started)
+	for _, hook := range m.hooks {
+		hook.AfterRequest(ctx, info, duration, err)
+	}
+}
+
+// A StorageTransport passing all requests to the hooks of a client
+type hookedTransport struct {
+	m     *MogileFsClient
+	inner StorageTransport
+}
+
+func (t *hookedTransport) Put(ctx context.Context, path string, r io.Reader, opts *StoragePutOpts) (err error) {
+	info := &RequestInfo{Kind: RequestStorage, Command: "PUT", Path: path}
+	ctx = t.m.beforeRequest(ctx, info)
+	started := time.Now()
+	if t.m.metrics != nil {
+		r = &meteredReader{r: r, c: t.m.metrics, direction: DirectionUpload}
+	}
+	err = t.inner.Put(ctx, path, r, opts)
+	t.m.afterRequest(ctx, info, started, err)
+	return
+}
+
+func (t *hookedTransport) Get(ctx context.Context, path string, opts *StorageGetOpts) (body io.ReadCloser, size int64, err error) {
+	info := &RequestInfo{Kind: RequestStorage, Command: "GET", Path: path}
+	ctx = t.m.beforeRequest(ctx, info)
+	started := time.Now()
+	body, size, err = t.inner.Get(ctx, path, opts)
+	if err == nil && t.m.metrics != nil {
+		body = &meteredBody{meteredReader: meteredReader{r: body, c: t.m.metrics, direction: DirectionDownload}, body: body}
+	}
+	t.m.afterRequest(ctx, info, started, err)
+	return
+}
+
+func (t *hookedTransport) Delete(ctx context.Context, path string) (err error) {
+	deleter, ok := t.inner.(StorageDeleter)
+	if !ok {
+		return errors.New("internal:storage transport does not support DELETE")
+	}
+	info := &RequestInfo{Kind: RequestStorage, Command: "DELETE", Path: path}
+	ctx = t.m.beforeRequest(ctx, info)
+	started := time.Now()
+	err = deleter.Delete(ctx, path)
+	t.m.afterRequest(ctx, info, started, err)
+	return
+}
+
+func (t *hookedTransport) Head(ctx context.Context, path string) (size int64, err error) {
+	info := &RequestInfo{Kind: RequestStorage, Command: "HEAD", Path: path}
+	ctx = t.m.beforeRequest(ctx, info)
+	started := time.Now()
+	if header, ok := t.inner.(StorageHeader); ok {
+		size, err = header.Head(ctx, path)
+	} else {
+		var body io.ReadCloser
+		if body, size, err = t.inner.Get(ctx, path, &StorageGetOpts{Length: 1}); err == nil {
+			body.Close()
+		}
+	}
+	t.m.afterRequest(ctx, info, started, err)
+	return
+}
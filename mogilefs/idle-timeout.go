@@ -0,0 +1,135 @@
+/*
+
+Copyright 2015 Adrian Ulrich
+Copyright 2015 Fixxpunkt AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package mogilefs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+// Returned by storage transfers which did not move any data for longer than the idle timeout, see WithStorageIdleTimeout()
+var ErrStorageStalled = errors.New("internal:storage node stalled")
+
+// Aborts transfers from and to storage nodes which do not move any data for longer than timeout (default: 0, no limit).
+//
+// Unlike a total timeout (eg. the deadline of a context) this does not limit the time a
+// large transfer may take, but catches storage nodes which keep a connection open without
+// sending or accepting data. Aborted transfers return ErrStorageStalled. Only applies to the
+// default storage transport.
+func WithStorageIdleTimeout(timeout time.Duration) Option {
+	return func(m *MogileFsClient) {
+		m.storage_idle_timeout = timeout
+	}
+}
+
+// Cancels a transfer once it did not move any data for too long
+type idleWatch struct {
+	ctx     context.Context
+	cancel  context.CancelCauseFunc
+	timer   *time.Timer
+	timeout time.Duration
+}
+
+/**
+ * @desc Returns a context which is canceled if touch() is not called for longer than timeout
+ */
+func newIdleWatch(ctx context.Context, timeout time.Duration) (context.Context, *idleWatch) {
+	w := &idleWatch{timeout: timeout}
+	w.ctx, w.cancel = context.WithCancelCause(ctx)
+	w.timer = time.AfterFunc(timeout, func() {
+		w.cancel(ErrStorageStalled)
+	})
+	return w.ctx, w
+}
+
+/**
+ * @desc Records that data was moved
+ */
+func (w *idleWatch) touch() {
+	w.timer.Reset(w.timeout)
+}
+
+/**
+ * @desc Stops watching, must be called once the transfer finished
+ */
+func (w *idleWatch) stop() {
+	w.timer.Stop()
+	w.cancel(nil)
+}
+
+/**
+ * @desc Returns ErrStorageStalled if the transfer was aborted by the watch, err otherwise
+ */
+func (w *idleWatch) wrap(err error) error {
+	if err != nil && err != io.EOF && errors.Is(context.Cause(w.ctx), ErrStorageStalled) {
+		return ErrStorageStalled
+	}
+	return err
+}
+
+// Touches an idleWatch whenever data is read
+type idleReader struct {
+	r io.Reader
+	w *idleWatch
+}
+
+func (ir *idleReader) Read(buffer []byte) (nr int, err error) {
+	nr, err = ir.r.Read(buffer)
+	if nr > 0 {
+		ir.w.touch()
+	}
+	return nr, ir.w.wrap(err)
+}
+
+// A storage body watched by an idleWatch
+type idleBody struct {
+	idleReader
+	body io.ReadCloser
+}
+
+func (ib *idleBody) Close() error {
+	ib.w.stop()
+	return ib.body.Close()
+}
+
+func (t *httpTransport) Put(ctx context.Context, path string, r io.Reader, opts *StoragePutOpts) (err error) {
+	if t.m.storage_idle_timeout <= 0 {
+		return t.put(ctx, path, r, opts)
+	}
+	ctx, w := newIdleWatch(ctx, t.m.storage_idle_timeout)
+	defer w.stop()
+	err = t.put(ctx, path, &idleReader{r: r, w: w}, opts)
+	return w.wrap(err)
+}
+
+func (t *httpTransport) Get(ctx context.Context, path string, opts *StorageGetOpts) (body io.ReadCloser, size int64, err error) {
+	if t.m.storage_idle_timeout <= 0 {
+		return t.get(ctx, path, opts)
+	}
+	ctx, w := newIdleWatch(ctx, t.m.storage_idle_timeout)
+	body, size, err = t.get(ctx, path, opts)
+	if err != nil {
+		w.stop()
+		return body, size, w.wrap(err)
+	}
+	w.touch()
+	body = &idleBody{idleReader: idleReader{r: body, w: w}, body: body}
+	return
+}
@@ -0,0 +1,88 @@
+/*
+
+Copyright 2015 Adrian Ulrich
+Copyright 2015 Fixxpunkt AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package mogilefs
+
+import (
+	"encoding/hex"
+)
+
+/*
+Keys on the wire
+
+Tracker arguments and replies are URL encoded (spaces become '+', everything else
+outside of [A-Za-z0-9_.-] becomes %XX), so any byte sequence - including '%', '+',
+spaces, newlines and unicode - reaches the tracker unchanged. What limits keys is the
+database of the trackers:
+	- keys are stored with at most MaxKeyLength bytes
+	- installations using a text (instead of a binary) column for keys may alter
+	  invalid UTF-8 and compare keys case-insensitively
+
+Keys are never normalized by this library: 'é' as one code point and 'é' as 'e' plus a
+combining accent are different keys.
+
+A client in strict mode (see WithStrictMode) rejects keys which are too long, contain
+invalid UTF-8 or control characters. Applications storing arbitrary binary keys should
+use WithKeyEncoding(KeyEncodingHex): keys are hex encoded on the wire, which round-trips
+any byte sequence with any database and keeps prefixes and the order of keys intact
+(at the price of a maximum key length of MaxKeyLength/2 bytes).
+*/
+
+// Maximum length of a key (as sent to the tracker) in bytes
+const MaxKeyLength = 255
+
+// How keys are sent to the trackers, see WithKeyEncoding()
+type KeyEncoding int
+
+const (
+	// Keys are sent as-is (the default)
+	KeyEncodingNone KeyEncoding = iota
+	// Keys are sent hex encoded
+	KeyEncodingHex
+)
+
+// Sets how keys are sent to the trackers (default: KeyEncodingNone).
+//
+// All keys of a domain must use the same encoding: keys created with KeyEncodingHex
+// are not visible to clients using KeyEncodingNone (and vice versa).
+func WithKeyEncoding(encoding KeyEncoding) Option {
+	return func(m *MogileFsClient) {
+		m.key_encoding = encoding
+	}
+}
+
+/**
+ * @desc Returns key (or a prefix of keys) as sent to the trackers
+ */
+func (m *MogileFsClient) encodeKey(key string) string {
+	if m.key_encoding == KeyEncodingHex {
+		return hex.EncodeToString([]byte(key))
+	}
+	return key
+}
+
+/**
+ * @desc Returns a key received from the trackers as passed to the client, keys which can not be decoded are returned as-is
+ */
+func (m *MogileFsClient) decodeKey(key string) string {
+	if m.key_encoding == KeyEncodingHex {
+		if decoded, err := hex.DecodeString(key); err == nil {
+			return string(decoded)
+		}
+	}
+	return key
+}
@@ -0,0 +1,119 @@
+/*
+
+Copyright 2015 Adrian Ulrich
+Copyright 2015 Fixxpunkt AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package mogilefs_test
+
+import (
+	"encoding/hex"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/adrian-bl/golang-mogilefs-client/mogilefs"
+)
+
+// Keys which must reach the tracker unchanged
+var awkwardKeys = []string{
+	"with space",
+	"100%",
+	"%41",
+	"a+b",
+	"a&b=c",
+	"unicode/é/日本",
+	"e\u0301", // 'é' as 'e' plus a combining accent
+}
+
+func TestKeyRoundTrip(t *testing.T) {
+	for _, encoding := range []mogilefs.KeyEncoding{mogilefs.KeyEncodingNone, mogilefs.KeyEncodingHex} {
+		mc, srv := newTestClient(t, mogilefs.WithKeyEncoding(encoding))
+		keys := append([]string{}, awkwardKeys...)
+		if encoding == mogilefs.KeyEncodingHex {
+			// hex encoding round-trips any byte sequence
+			keys = append(keys, "tab\there", "new\nline", "\x00\xff")
+		}
+
+		for _, key := range keys {
+			if _, err := mc.Create(key, "", strings.NewReader(key)); err != nil {
+				t.Fatalf("encoding %d: creating %q: %v", encoding, key, err)
+			}
+			if got := fetchString(t, mc, key); got != key {
+				t.Errorf("encoding %d: fetch %q = %q", encoding, key, got)
+			}
+			if info, err := mc.FileInfo(key); err != nil || info.Key != key {
+				t.Errorf("encoding %d: file_info %q = %q, %v", encoding, key, info.Key, err)
+			}
+		}
+
+		listed, err := mc.ListAllKeys("")
+		if err != nil {
+			t.Fatalf("encoding %d: listing keys: %v", encoding, err)
+		}
+		sort.Strings(listed)
+		sort.Strings(keys)
+		if !reflect.DeepEqual(listed, keys) {
+			t.Errorf("encoding %d: listed %q, want %q", encoding, listed, keys)
+		}
+
+		// the tracker stores the keys as sent
+		stored := srv.Keys("test")
+		if encoding == mogilefs.KeyEncodingHex {
+			for i, key := range stored {
+				decoded, _ := hex.DecodeString(key)
+				stored[i] = string(decoded)
+			}
+			sort.Strings(stored)
+		}
+		if !reflect.DeepEqual(stored, keys) {
+			t.Errorf("encoding %d: tracker holds %q, want %q", encoding, stored, keys)
+		}
+	}
+}
+
+func TestStrictModeRejectsKeys(t *testing.T) {
+	long := strings.Repeat("k", mogilefs.MaxKeyLength+1)
+	for _, tc := range []struct {
+		key      string
+		encoding mogilefs.KeyEncoding
+		ok       bool
+	}{
+		{"", mogilefs.KeyEncodingNone, false},
+		{long[1:], mogilefs.KeyEncodingNone, true},
+		{long, mogilefs.KeyEncodingNone, false},
+		{"\xff\xfe", mogilefs.KeyEncodingNone, false},
+		{"tab\there", mogilefs.KeyEncodingNone, false},
+		{"del\x7f", mogilefs.KeyEncodingNone, false},
+		{"unicode/é", mogilefs.KeyEncodingNone, true},
+		// hex encoding doubles the length, but accepts any byte
+		{long[:mogilefs.MaxKeyLength/2], mogilefs.KeyEncodingHex, true},
+		{long[:mogilefs.MaxKeyLength/2+1], mogilefs.KeyEncodingHex, false},
+		{"\xff\xfe", mogilefs.KeyEncodingHex, true},
+		{"tab\there", mogilefs.KeyEncodingHex, true},
+	} {
+		mc, srv := newTestClient(t, mogilefs.WithStrictMode(), mogilefs.WithKeyEncoding(tc.encoding))
+		commands := srv.Commands()
+		_, err := mc.Create(tc.key, "", strings.NewReader("data"))
+		switch {
+		case tc.ok && err != nil:
+			t.Errorf("encoding %d: key %q rejected: %v", tc.encoding, tc.key, err)
+		case !tc.ok && err == nil:
+			t.Errorf("encoding %d: key %q accepted", tc.encoding, tc.key)
+		case !tc.ok && srv.Commands() != commands:
+			t.Errorf("encoding %d: key %q was sent to the tracker", tc.encoding, tc.key)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+/*
+
+Copyright 2015 Adrian Ulrich
+Copyright 2015 Fixxpunkt AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package mogilefs
+
+import (
+	"sync"
+)
+
+// Keys with an upload in progress, used to serialize concurrent Creates of the same key
+type keyLocks struct {
+	mutex sync.Mutex
+	// closed and removed once the upload of the key finished
+	busy map[string]chan struct{}
+}
+
+// Makes Create fail with ErrConcurrentCreate instead of waiting if another
+// goroutine is uploading the same key using this client.
+func WithRejectConcurrentCreates() Option {
+	return func(m *MogileFsClient) {
+		m.reject_concurrent_creates = true
+	}
+}
+
+/**
+ * @desc Waits until no other upload of key is in progress and marks key as busy
+ * @param key string the key to lock
+ * @param reject bool return ErrConcurrentCreate instead of waiting
+ */
+func (kl *keyLocks) lock(key string, reject bool) (err error) {
+	for {
+		kl.mutex.Lock()
+		if kl.busy == nil {
+			kl.busy = make(map[string]chan struct{})
+		}
+		done, isBusy := kl.busy[key]
+		if !isBusy {
+			kl.busy[key] = make(chan struct{})
+		}
+		kl.mutex.Unlock()
+
+		if !isBusy {
+			return
+		}
+		if reject {
+			return ErrConcurrentCreate
+		}
+		<-done
+	}
+}
+
+/**
+ * @desc Marks key as idle again, waking up all waiters
+ */
+func (kl *keyLocks) unlock(key string) {
+	kl.mutex.Lock()
+	close(kl.busy[key])
+	delete(kl.busy, key)
+	kl.mutex.Unlock()
+}
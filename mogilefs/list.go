@@ -0,0 +1,139 @@
+/*
+
+Copyright 2015 Adrian Ulrich
+Copyright 2015 Fixxpunkt AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package mogilefs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+)
+
+// Returns up to limit keys starting with prefix, sorted by name.
+//
+// Pass an empty string as 'after' to start at the beginning, the returned
+// next_after value may be used to fetch the next batch of keys.
+// An empty list of keys indicates that there are no more keys.
+func (m *MogileFsClient) ListKeys(prefix string, after string, limit int) (keys []string, next_after string, err error) {
+	return m.ListKeysContext(context.Background(), prefix, after, limit)
+}
+
+// Returns up to limit keys starting with prefix, see ListKeys().
+//
+// ctx limits the time spent on the request.
+func (m *MogileFsClient) ListKeysContext(ctx context.Context, prefix string, after string, limit int) (keys []string, next_after string, err error) {
+	args := make(url.Values)
+	args.Add("domain", m.domain)
+	args.Add("prefix", m.encodeKey(prefix))
+	if len(after) > 0 {
+		args.Add("after", m.encodeKey(after))
+	}
+	if limit > 0 {
+		args.Add("limit", fmt.Sprintf("%d", limit))
+	}
+
+	values, err := m.DoRequestContext(ctx, cmd_list_keys, args)
+	if errors.Is(err, ErrNoneMatch) {
+		// not an error: the tracker just ran out of keys
+		err = nil
+	} else if err == nil {
+		for i := 1; i <= intValue(values, "key_count"); i++ {
+			keys = append(keys, m.decodeKey(stringValue(values, fmt.Sprintf("key_%d", i))))
+		}
+		next_after = m.decodeKey(stringValue(values, "next_after"))
+	}
+	return
+}
+
+// Returns all keys starting with prefix
+func (m *MogileFsClient) ListAllKeys(prefix string) (keys []string, err error) {
+	it := m.NewKeyIterator(prefix, "")
+	for it.Next() {
+		keys = append(keys, it.Key())
+	}
+	err = it.Err()
+	return
+}
+
+// Iterates over all keys starting with a prefix, see NewKeyIterator()
+type KeyIterator struct {
+	mc     *MogileFsClient
+	prefix string
+	// the last key returned by Next()
+	cursor string
+	// keys fetched from the tracker but not returned yet
+	batch []string
+	// where the tracker wants us to continue
+	next_after string
+	done       bool
+	err        error
+	// Number of keys requested from the tracker per list_keys command (default: 1000)
+	BatchSize int
+}
+
+// Returns an iterator over all keys starting with prefix.
+//
+// The tracker returns keys sorted by name: the iterator starts with the first key after
+// cursor (or at the beginning if cursor is an empty string). Long running jobs may save
+// the value of Cursor() after processing a key and pass it to NewKeyIterator to resume
+// after a crash.
+//
+// Example:
+//
+//	it := mc.NewKeyIterator("logs/", loadCheckpoint())
+//	for it.Next() {
+//		process(it.Key())
+//		saveCheckpoint(it.Cursor())
+//	}
+//	if it.Err() != nil { ... }
+func (m *MogileFsClient) NewKeyIterator(prefix string, cursor string) *KeyIterator {
+	return &KeyIterator{mc: m, prefix: prefix, cursor: cursor, next_after: cursor, BatchSize: 1000}
+}
+
+// Advances to the next key, returns false if there are no more keys or on errors.
+func (it *KeyIterator) Next() bool {
+	if len(it.batch) == 0 && !it.done && it.err == nil {
+		it.batch, it.next_after, it.err = it.mc.ListKeys(it.prefix, it.next_after, it.BatchSize)
+		it.done = len(it.batch) == 0
+		if !it.done && len(it.next_after) == 0 {
+			// older trackers may not send next_after
+			it.next_after = it.batch[len(it.batch)-1]
+		}
+	}
+	if len(it.batch) == 0 {
+		return false
+	}
+	it.cursor = it.batch[0]
+	it.batch = it.batch[1:]
+	return true
+}
+
+// Returns the current key
+func (it *KeyIterator) Key() string {
+	return it.cursor
+}
+
+// Returns the position of the iterator, usable to resume the iteration after the current key
+func (it *KeyIterator) Cursor() string {
+	return it.cursor
+}
+
+// Returns the error which stopped the iteration, nil if all keys were returned
+func (it *KeyIterator) Err() error {
+	return it.err
+}
@@ -0,0 +1,209 @@
+/*
+
+Copyright 2015 Adrian Ulrich
+Copyright 2015 Fixxpunkt AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package mogilefs
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Returned by AcquireKeyLock if another owner holds an unexpired lock
+var ErrKeyLocked = errors.New("internal:key is locked")
+
+// An advisory lock of a key, returned by AcquireKeyLock()
+type KeyLock struct {
+	// The locked key
+	Key string
+	// Owner of the lock: the client id (or hostname and pid if none was set)
+	Owner string
+	// When the lock expires and may be taken over by another owner
+	Expires time.Time
+	// random value identifying this lock
+	token string
+	// generation of the lock, see AcquireKeyLock()
+	gen int64
+	m   *MogileFsClient
+}
+
+// Returns the prefix of the keys used to store the lock of key
+func LockKey(key string) string {
+	return "_lock:" + key
+}
+
+/**
+ * @desc Returns the key of generation gen of the lock of key
+ */
+func lockGenerationKey(key string, gen int64) string {
+	return fmt.Sprintf("%s:%020d", LockKey(key), gen)
+}
+
+// Acquires an advisory lock of key, which expires after ttl.
+//
+// Each acquisition stores a new generation of the lock as key LockKey(key)+':<generation>',
+// holding the owner and the expiry of the lock. The lock is held by the newest generation.
+// A generation is created by renaming a temporary key: mogilefsd refuses to rename onto an
+// existing key, so only one of several processes taking over an expired lock succeeds.
+// Generations are never replaced, so a process working with an outdated view can not remove
+// the lock of another owner. Returns ErrKeyLocked if another owner holds the lock.
+//
+// Note: the lock does not protect key itself, it only works if all writers use it.
+func (m *MogileFsClient) AcquireKeyLock(key string, ttl time.Duration) (lock *KeyLock, err error) {
+	token := make([]byte, 16)
+	if _, err = io.ReadFull(rand.Reader, token); err != nil {
+		return
+	}
+
+	lock = &KeyLock{Key: key, Owner: m.lockOwner(), Expires: time.Now().Add(ttl), token: hex.EncodeToString(token), m: m}
+	content := url.Values{
+		"owner":   {lock.Owner},
+		"token":   {lock.token},
+		"expires": {fmt.Sprintf("%d", lock.Expires.Unix())},
+	}
+
+	// the key holding our lock: removed again if we do not get the lock
+	ours := LockKey(key) + "~" + lock.token
+	if _, err = m.Create(ours, "", strings.NewReader(content.Encode())); err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			m.Delete(ours)
+			lock = nil
+		}
+	}()
+
+	gens, err := m.lockGenerations(key)
+	if err != nil {
+		return
+	}
+	if len(gens) > 0 {
+		current := gens[len(gens)-1]
+		held, rerr := m.readKeyLock(key, current)
+		switch {
+		case rerr == nil && time.Now().Before(held.Expires):
+			return lock, ErrKeyLocked
+		case rerr != nil && !errors.Is(rerr, ErrUnknownKey):
+			// an unknown key was released meanwhile, other errors leave us in the dark
+			return lock, rerr
+		}
+		lock.gen = current + 1
+	}
+
+	if err = m.Rename(ours, lockGenerationKey(key, lock.gen)); errors.Is(err, ErrKeyExists) {
+		// another owner took over first
+		err = ErrKeyLocked
+	}
+	if err != nil {
+		return
+	}
+	ours = lockGenerationKey(key, lock.gen)
+
+	// a process with an outdated view may create a generation below the newest one: only the newest holds the lock
+	if gens, err = m.lockGenerations(key); err == nil && (len(gens) == 0 || gens[len(gens)-1] != lock.gen) {
+		err = ErrKeyLocked
+	}
+	if err == nil {
+		// drop superseded generations, keeping the previous one for processes still reading it
+		for _, gen := range gens {
+			if gen < lock.gen-1 {
+				m.Delete(lockGenerationKey(key, gen))
+			}
+		}
+	}
+	return
+}
+
+// Releases the lock.
+//
+// Only the generation of this lock is removed: if the lock expired and was taken over by
+// another owner, the lock of the new owner is left alone.
+func (lock *KeyLock) Release() (err error) {
+	err = lock.m.Delete(lockGenerationKey(lock.Key, lock.gen))
+	if errors.Is(err, ErrUnknownKey) {
+		// removed by the new owner after taking over
+		err = nil
+	}
+	return
+}
+
+/**
+ * @desc Returns the generations of the lock of key, in ascending order
+ */
+func (m *MogileFsClient) lockGenerations(key string) (gens []int64, err error) {
+	prefix := LockKey(key) + ":"
+	keys, err := m.ListAllKeys(prefix)
+	for _, k := range keys {
+		// skip locks of other keys sharing the prefix (eg. of 'key:1')
+		suffix := strings.TrimPrefix(k, prefix)
+		if len(suffix) != 20 {
+			continue
+		}
+		if gen, perr := strconv.ParseInt(suffix, 10, 64); perr == nil && gen >= 0 {
+			gens = append(gens, gen)
+		}
+	}
+	sort.Slice(gens, func(i, j int) bool {
+		return gens[i] < gens[j]
+	})
+	return
+}
+
+/**
+ * @desc Fetches and parses generation gen of the lock of key
+ */
+func (m *MogileFsClient) readKeyLock(key string, gen int64) (lock *KeyLock, err error) {
+	r, err := m.Fetch(lockGenerationKey(key, gen))
+	if err != nil {
+		return
+	}
+	defer r.Close()
+
+	raw, err := io.ReadAll(io.LimitReader(r, 4096))
+	if err == nil {
+		var content url.Values
+		if content, err = url.ParseQuery(string(raw)); err == nil {
+			expires, _ := strconv.ParseInt(content.Get("expires"), 10, 64)
+			lock = &KeyLock{Key: key, Owner: content.Get("owner"), Expires: time.Unix(expires, 0), token: content.Get("token"), gen: gen, m: m}
+		}
+	}
+	return
+}
+
+/**
+ * @desc Returns the owner recorded in locks created by this client
+ */
+func (m *MogileFsClient) lockOwner() string {
+	m.mutex.Lock()
+	owner := m.client_id
+	m.mutex.Unlock()
+
+	if len(owner) == 0 {
+		hostname, _ := os.Hostname()
+		owner = fmt.Sprintf("%s:%d", hostname, os.Getpid())
+	}
+	return owner
+}
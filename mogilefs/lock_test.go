@@ -0,0 +1,86 @@
+/*
+
+Copyright 2015 Adrian Ulrich
+Copyright 2015 Fixxpunkt AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package mogilefs_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/adrian-bl/golang-mogilefs-client/mogilefs"
+)
+
+func TestKeyLockTakeover(t *testing.T) {
+	mc, _ := newTestClient(t)
+
+	expired, err := mc.AcquireKeyLock("k", -time.Second)
+	if err != nil {
+		t.Fatalf("acquiring a free lock: %v", err)
+	}
+	held, err := mc.AcquireKeyLock("k", time.Minute)
+	if err != nil {
+		t.Fatalf("taking over an expired lock: %v", err)
+	}
+	if _, err = mc.AcquireKeyLock("k", time.Minute); !errors.Is(err, mogilefs.ErrKeyLocked) {
+		t.Fatalf("acquiring a held lock: err = %v, want ErrKeyLocked", err)
+	}
+
+	// the previous owner must not remove the lock taken over
+	if err = expired.Release(); err != nil {
+		t.Fatalf("releasing a lock taken over: %v", err)
+	}
+	if _, err = mc.AcquireKeyLock("k", time.Minute); !errors.Is(err, mogilefs.ErrKeyLocked) {
+		t.Fatalf("lock was released by its previous owner: err = %v, want ErrKeyLocked", err)
+	}
+
+	if err = held.Release(); err != nil {
+		t.Fatalf("releasing the lock: %v", err)
+	}
+	if _, err = mc.AcquireKeyLock("k", time.Minute); err != nil {
+		t.Fatalf("acquiring a released lock: %v", err)
+	}
+}
+
+func TestKeyLockTakeoverRace(t *testing.T) {
+	mc, _ := newTestClient(t)
+	if _, err := mc.AcquireKeyLock("k", -time.Second); err != nil {
+		t.Fatalf("acquiring a free lock: %v", err)
+	}
+
+	// workers racing for the same expired lock: at most one may win
+	const workers = 8
+	won := make(chan *mogilefs.KeyLock, workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			lock, err := mc.AcquireKeyLock("k", time.Minute)
+			if err != nil && !errors.Is(err, mogilefs.ErrKeyLocked) {
+				t.Errorf("acquiring the lock: %v", err)
+			}
+			won <- lock
+		}()
+	}
+	winners := 0
+	for i := 0; i < workers; i++ {
+		if lock := <-won; lock != nil {
+			winners++
+		}
+	}
+	if winners > 1 {
+		t.Fatalf("%d workers acquired the lock", winners)
+	}
+}
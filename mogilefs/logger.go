@@ -0,0 +1,63 @@
+/*
+
+Copyright 2015 Adrian Ulrich
+Copyright 2015 Fixxpunkt AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package mogilefs
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// Emits debug logs to logger (default: discard all logs).
+//
+// The client logs tracker selection, blacklisting of trackers, retries of tracker commands
+// and each tracker request and storage transfer at debug level. Enable debug level on the
+// handler of logger to see them.
+func WithLogger(logger *slog.Logger) Option {
+	return func(m *MogileFsClient) {
+		m.logger = logger
+		m.hooks = append(m.hooks, loggingHooks{logger: logger})
+	}
+}
+
+// Logs all requests
+type loggingHooks struct {
+	logger *slog.Logger
+}
+
+func (h loggingHooks) BeforeRequest(ctx context.Context, info *RequestInfo) context.Context {
+	return ctx
+}
+
+func (h loggingHooks) AfterRequest(ctx context.Context, info *RequestInfo, duration time.Duration, err error) {
+	attrs := []any{slog.String("command", info.Command), slog.Duration("duration", duration)}
+	if info.Kind == RequestTracker {
+		attrs = append(attrs, slog.String("tracker", info.Tracker))
+		if key := info.Args.Get("key"); len(key) > 0 {
+			attrs = append(attrs, slog.String("key", key))
+		}
+	} else {
+		attrs = append(attrs, slog.String("path", info.Path))
+	}
+	if err != nil {
+		attrs = append(attrs, slog.Any("error", err))
+		h.logger.DebugContext(ctx, "mogilefs: "+info.Kind+" request failed", attrs...)
+	} else {
+		h.logger.DebugContext(ctx, "mogilefs: "+info.Kind+" request", attrs...)
+	}
+}
@@ -0,0 +1,195 @@
+/*
+
+Copyright 2015 Adrian Ulrich
+Copyright 2015 Fixxpunkt AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+/*
+Package memcache implements a mogilefs.PathCache stored in memcached.
+
+Frontends sharing the same memcached servers share their get_paths results, like the
+memcache integration of the perl client.
+
+Example:
+
+	cache := memcache.New([]string{"cache1:11211", "cache2:11211"}, nil)
+	mc := mogilefs.New(domain, trackers, mogilefs.WithSharedPathCache(cache, time.Minute))
+*/
+package memcache
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Optional argument to New()
+type Options struct {
+	// Prepended to all keys (default: 'mogfs:')
+	Prefix string
+	// Timeout of connecting and of each command (default: 100 milliseconds)
+	Timeout time.Duration
+	// Number of idle connections kept per server (default: 4)
+	MaxIdle int
+}
+
+// A mogilefs.PathCache stored in memcached, see New().
+//
+// Failures of the memcached servers are treated as cache misses.
+type Cache struct {
+	servers []*server
+	prefix  string
+	timeout time.Duration
+}
+
+// A memcached server and its idle connections
+type server struct {
+	addr string
+	idle chan net.Conn
+}
+
+// Returns a cache spreading keys over the given memcached servers ('host:port'), opts may be nil
+func New(servers []string, opts *Options) *Cache {
+	if opts == nil {
+		opts = &Options{}
+	}
+	c := &Cache{prefix: opts.Prefix, timeout: opts.Timeout}
+	if len(c.prefix) == 0 {
+		c.prefix = "mogfs:"
+	}
+	if c.timeout <= 0 {
+		c.timeout = time.Duration(100) * time.Millisecond
+	}
+	max_idle := opts.MaxIdle
+	if max_idle <= 0 {
+		max_idle = 4
+	}
+	for _, addr := range servers {
+		c.servers = append(c.servers, &server{addr: addr, idle: make(chan net.Conn, max_idle)})
+	}
+	return c
+}
+
+// Implements mogilefs.PathCache
+func (c *Cache) Get(key string) (paths []string, ok bool) {
+	c.do(key, func(cache_key string, rw *bufio.ReadWriter) (err error) {
+		fmt.Fprintf(rw, "get %s\r\n", cache_key)
+		if err = rw.Flush(); err != nil {
+			return
+		}
+		line, err := rw.ReadString('\n')
+		if err != nil || line == "END\r\n" {
+			return
+		}
+		// VALUE <key> <flags> <bytes>
+		fields := strings.Fields(line)
+		if len(fields) != 4 || fields[0] != "VALUE" {
+			return fmt.Errorf("unexpected reply: %q", line)
+		}
+		size, err := strconv.Atoi(fields[3])
+		if err != nil {
+			return
+		}
+		data := make([]byte, size+2)
+		if _, err = io.ReadFull(rw, data); err != nil {
+			return
+		}
+		if line, err = rw.ReadString('\n'); err == nil && line != "END\r\n" {
+			return fmt.Errorf("unexpected reply: %q", line)
+		}
+		paths, ok = strings.Split(string(data[:size]), "\n"), size > 0
+		return
+	})
+	return
+}
+
+// Implements mogilefs.PathCache
+func (c *Cache) Set(key string, paths []string, ttl time.Duration) {
+	data := strings.Join(paths, "\n")
+	// memcached expires in whole seconds
+	exptime := int64((ttl + time.Second - 1) / time.Second)
+	c.do(key, func(cache_key string, rw *bufio.ReadWriter) (err error) {
+		fmt.Fprintf(rw, "set %s 0 %d %d\r\n%s\r\n", cache_key, exptime, len(data), data)
+		return c.expect(rw, "STORED\r\n")
+	})
+}
+
+// Implements mogilefs.PathCache
+func (c *Cache) Delete(key string) {
+	c.do(key, func(cache_key string, rw *bufio.ReadWriter) (err error) {
+		fmt.Fprintf(rw, "delete %s\r\n", cache_key)
+		return c.expect(rw, "DELETED\r\n", "NOT_FOUND\r\n")
+	})
+}
+
+/**
+ * @desc Flushes rw and checks that the server answers with one of replies
+ */
+func (c *Cache) expect(rw *bufio.ReadWriter, replies ...string) (err error) {
+	if err = rw.Flush(); err != nil {
+		return
+	}
+	line, err := rw.ReadString('\n')
+	if err != nil {
+		return
+	}
+	for _, reply := range replies {
+		if line == reply {
+			return nil
+		}
+	}
+	return fmt.Errorf("unexpected reply: %q", line)
+}
+
+/**
+ * @desc Runs fn on a connection to the server of key, passing the key to send to memcached
+ */
+func (c *Cache) do(key string, fn func(cache_key string, rw *bufio.ReadWriter) error) {
+	if len(c.servers) == 0 {
+		return
+	}
+	// memcached keys are limited to 250 bytes without whitespace: hash the mogilefs key
+	sum := sha1.Sum([]byte(key))
+	cache_key := c.prefix + hex.EncodeToString(sum[:])
+	srv := c.servers[crc32.ChecksumIEEE([]byte(key))%uint32(len(c.servers))]
+
+	var conn net.Conn
+	select {
+	case conn = <-srv.idle:
+	default:
+		var err error
+		if conn, err = net.DialTimeout("tcp", srv.addr, c.timeout); err != nil {
+			return
+		}
+	}
+
+	conn.SetDeadline(time.Now().Add(c.timeout))
+	if err := fn(cache_key, bufio.NewReadWriter(bufio.NewReader(conn), bufio.NewWriter(conn))); err != nil {
+		// the state of the connection is unknown
+		conn.Close()
+		return
+	}
+	select {
+	case srv.idle <- conn:
+	default:
+		conn.Close()
+	}
+}
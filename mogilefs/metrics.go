@@ -0,0 +1,116 @@
+/*
+
+Copyright 2015 Adrian Ulrich
+Copyright 2015 Fixxpunkt AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package mogilefs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+// Outcomes of tracker commands, passed to MetricsCollector.ObserveCommand
+const (
+	// The tracker answered with OK
+	OutcomeOK = "ok"
+	// The tracker answered with ERR, eg. for unknown keys
+	OutcomeTrackerError = "tracker_error"
+	// The command failed without a reply of the tracker, eg. due to network errors or timeouts
+	OutcomeFailed = "failed"
+)
+
+// Directions of storage transfers, passed to MetricsCollector.AddBytes
+const (
+	DirectionUpload   = "upload"
+	DirectionDownload = "download"
+)
+
+// Receives metrics of a client, see WithMetrics().
+//
+// The package mogilefs/promexport implements it and exports the metrics in the Prometheus
+// text format. Implementations must be safe for concurrent use.
+type MetricsCollector interface {
+	// Called for each attempt of a tracker command, outcome is one of OutcomeOK, OutcomeTrackerError or OutcomeFailed
+	ObserveCommand(command string, outcome string, duration time.Duration)
+	// Called while data is transferred from or to storage nodes, direction is DirectionUpload or DirectionDownload
+	AddBytes(direction string, n int64)
+}
+
+// Reports the tracker commands and storage transfers of the client to c.
+//
+// The number of blacklisted trackers is not pushed to c: use BlacklistStatus() to query it.
+func WithMetrics(c MetricsCollector) Option {
+	return func(m *MogileFsClient) {
+		m.metrics = c
+		m.hooks = append(m.hooks, metricsHooks{c: c})
+	}
+}
+
+/**
+ * @desc Returns the outcome of a tracker command which failed with err
+ */
+func commandOutcome(err error) string {
+	var tracker_err *TrackerError
+	switch {
+	case err == nil:
+		return OutcomeOK
+	case errors.As(err, &tracker_err):
+		return OutcomeTrackerError
+	}
+	return OutcomeFailed
+}
+
+// Passes tracker commands to a MetricsCollector
+type metricsHooks struct {
+	c MetricsCollector
+}
+
+func (h metricsHooks) BeforeRequest(ctx context.Context, info *RequestInfo) context.Context {
+	return ctx
+}
+
+func (h metricsHooks) AfterRequest(ctx context.Context, info *RequestInfo, duration time.Duration, err error) {
+	if info.Kind == RequestTracker {
+		h.c.ObserveCommand(info.Command, commandOutcome(err), duration)
+	}
+}
+
+// Reports the bytes read from r to a MetricsCollector
+type meteredReader struct {
+	r         io.Reader
+	c         MetricsCollector
+	direction string
+}
+
+func (mr *meteredReader) Read(buffer []byte) (nr int, err error) {
+	nr, err = mr.r.Read(buffer)
+	if nr > 0 {
+		mr.c.AddBytes(mr.direction, int64(nr))
+	}
+	return
+}
+
+// Reports the bytes read from a storage body to a MetricsCollector
+type meteredBody struct {
+	meteredReader
+	body io.ReadCloser
+}
+
+func (mb *meteredBody) Close() error {
+	return mb.body.Close()
+}
@@ -0,0 +1,148 @@
+/*
+
+Copyright 2015 Adrian Ulrich
+Copyright 2015 Fixxpunkt AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package mogiletest
+
+import (
+	"bytes"
+	"io"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/adrian-bl/golang-mogilefs-client/mogilefs"
+)
+
+// An in-memory implementation of mogilefs.Client for unit tests, see NewFakeClient().
+//
+// Unlike Server, FakeClient does not speak the MogileFS protocols at all: it stores the
+// contents of each key in a map. Paths returned by GetPaths are fake URLs which can not
+// be fetched over HTTP. Errors match those of the real client (eg. mogilefs.ErrUnknownKey).
+type FakeClient struct {
+	mutex sync.Mutex
+	files map[string]fakeFile
+	// the last file id handed out
+	fid int64
+}
+
+type fakeFile struct {
+	fid   int64
+	class string
+	data  []byte
+}
+
+var _ mogilefs.Client = (*FakeClient)(nil)
+
+// Returns a new FakeClient without any keys
+func NewFakeClient() *FakeClient {
+	return &FakeClient{files: make(map[string]fakeFile)}
+}
+
+func (c *FakeClient) GetPaths(key string, opts *mogilefs.GetPathsOpts) (paths []string, err error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	f, ok := c.files[key]
+	if !ok {
+		return nil, mogilefs.ErrUnknownKey
+	}
+	return []string{"http://fake.invalid/dev1/" + strconv.FormatInt(f.fid, 10) + ".fid"}, nil
+}
+
+func (c *FakeClient) Fetch(key string) (r io.ReadCloser, err error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	f, ok := c.files[key]
+	if !ok {
+		return nil, mogilefs.ErrUnknownKey
+	}
+	return io.NopCloser(bytes.NewReader(f.data)), nil
+}
+
+func (c *FakeClient) Create(key string, class string, r io.Reader) (close_values url.Values, err error) {
+	if len(key) == 0 {
+		return nil, mogilefs.ErrNoKey
+	}
+	// a nil reader uploads an empty key
+	var data []byte
+	if r != nil {
+		if data, err = io.ReadAll(r); err != nil {
+			return
+		}
+	}
+	if len(class) == 0 {
+		class = "default"
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.fid++
+	c.files[key] = fakeFile{fid: c.fid, class: class, data: data}
+	return make(url.Values), nil
+}
+
+func (c *FakeClient) Delete(key string) (err error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if _, ok := c.files[key]; !ok {
+		return mogilefs.ErrUnknownKey
+	}
+	delete(c.files, key)
+	return
+}
+
+func (c *FakeClient) Rename(oldname string, newname string) (err error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	f, ok := c.files[oldname]
+	if !ok {
+		return mogilefs.ErrUnknownKey
+	}
+	if _, exists := c.files[newname]; exists {
+		return mogilefs.ErrKeyExists
+	}
+	c.files[newname] = f
+	delete(c.files, oldname)
+	return
+}
+
+func (c *FakeClient) ListKeys(prefix string, after string, limit int) (keys []string, next_after string, err error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for key := range c.files {
+		if strings.HasPrefix(key, prefix) && key > after {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	if limit > 0 && len(keys) > limit {
+		keys = keys[:limit]
+	}
+	if len(keys) > 0 {
+		next_after = keys[len(keys)-1]
+	}
+	return
+}
+
+// Returns the contents of key, false if it does not exist
+func (c *FakeClient) Data(key string) (data []byte, ok bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	f, ok := c.files[key]
+	return f.data, ok
+}
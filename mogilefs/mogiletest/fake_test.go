@@ -0,0 +1,34 @@
+/*
+
+Copyright 2015 Adrian Ulrich
+Copyright 2015 Fixxpunkt AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package mogiletest_test
+
+import (
+	"testing"
+
+	"github.com/adrian-bl/golang-mogilefs-client/mogilefs/mogiletest"
+)
+
+func TestFakeCreateNilReader(t *testing.T) {
+	c := mogiletest.NewFakeClient()
+	if _, err := c.Create("k", "", nil); err != nil {
+		t.Fatalf("Create with a nil reader: %v", err)
+	}
+	if data, ok := c.Data("k"); !ok || len(data) != 0 {
+		t.Errorf("Data = %q, %v, want an empty key", data, ok)
+	}
+}
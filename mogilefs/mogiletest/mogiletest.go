@@ -0,0 +1,579 @@
+/*
+
+Copyright 2015 Adrian Ulrich
+Copyright 2015 Fixxpunkt AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+/*
+Package mogiletest provides an in-memory MogileFS cluster for tests.
+
+A Server runs a tracker speaking the mogilefsd line protocol and a storage node
+accepting WebDAV style PUT, GET, HEAD and DELETE requests (served by httptest),
+so applications using the client can run integration tests without a real cluster.
+
+Example:
+
+	srv := mogiletest.NewServer()
+	defer srv.Close()
+	srv.AddDomain("test")
+
+	mc := mogilefs.New("test", srv.Trackers())
+	_, err := mc.Create("hello", "", strings.NewReader("world"))
+
+The tracker supports the commands used for storing, fetching and listing keys
+(create_open, create_close, get_paths, delete, rename, updateclass, list_keys,
+file_info, noop) and for managing domains and classes (get_domains,
+create_domain, delete_domain, create_class, update_class, delete_class).
+Other commands are answered with 'ERR unknown_command'.
+
+Unit tests of code depending on the mogilefs.Client interface may use the
+lighter FakeClient instead, which keeps keys in a map without any networking.
+*/
+package mogiletest
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The device id of the (single) storage node
+const Devid = 1
+
+// An in-memory tracker and storage node, see NewServer()
+type Server struct {
+	mutex    sync.Mutex
+	listener net.Listener
+	storage  *httptest.Server
+	// classes of each domain
+	domains map[string]map[string]*class
+	// keys of each domain
+	files map[string]map[string]*file
+	// contents of the storage node, by URL path
+	blobs map[string][]byte
+	// the last file id handed out
+	fid int64
+	// class of each fid handed out by create_open and not closed yet
+	open_fids map[int64]string
+	// number of commands received by the tracker
+	commands int
+	wg       sync.WaitGroup
+}
+
+type class struct {
+	mindevcount int
+	hashtype    string
+}
+
+type file struct {
+	fid      int64
+	class    string
+	path     string
+	length   int64
+	checksum string
+}
+
+// Starts a new server listening on localhost, the caller must Close() it
+func NewServer() *Server {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(fmt.Sprintf("mogiletest: failed to listen: %v", err))
+	}
+
+	s := &Server{
+		listener:  listener,
+		domains:   make(map[string]map[string]*class),
+		files:     make(map[string]map[string]*file),
+		blobs:     make(map[string][]byte),
+		open_fids: make(map[int64]string),
+	}
+	s.storage = httptest.NewServer(http.HandlerFunc(s.serveStorage))
+
+	s.wg.Add(1)
+	go s.acceptTrackerConnections()
+	return s
+}
+
+// Returns the address of the tracker, to be passed to mogilefs.New()
+func (s *Server) Trackers() []string {
+	return []string{s.listener.Addr().String()}
+}
+
+// Returns the base URL of the storage node
+func (s *Server) StorageURL() string {
+	return s.storage.URL
+}
+
+// Creates domain (with its 'default' class) if it does not exist yet
+func (s *Server) AddDomain(domain string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.addDomain(domain)
+}
+
+// Creates class in domain using the given hashtype ('MD5' or an empty string for none)
+func (s *Server) AddClass(domain string, name string, hashtype string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.addDomain(domain)
+	s.domains[domain][name] = &class{mindevcount: 1, hashtype: hashtype}
+}
+
+// Returns the contents of key, false if it does not exist
+func (s *Server) Data(domain string, key string) (data []byte, ok bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if f := s.files[domain][key]; f != nil {
+		data, ok = s.blobs[f.path], true
+	}
+	return
+}
+
+// Returns all keys of domain, sorted by name
+func (s *Server) Keys(domain string) (keys []string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for key := range s.files[domain] {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return
+}
+
+// Returns the number of commands the tracker received
+func (s *Server) Commands() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.commands
+}
+
+// Stops the tracker and the storage node
+func (s *Server) Close() {
+	s.listener.Close()
+	s.storage.Close()
+	s.wg.Wait()
+}
+
+/**
+ * @desc Creates domain with its default class, must be called with the mutex held
+ */
+func (s *Server) addDomain(domain string) {
+	if s.domains[domain] == nil {
+		s.domains[domain] = map[string]*class{"default": {mindevcount: 2}}
+		s.files[domain] = make(map[string]*file)
+	}
+}
+
+func (s *Server) acceptTrackerConnections() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.wg.Add(1)
+		go s.serveTracker(conn)
+	}
+}
+
+/**
+ * @desc Answers the commands sent on conn until the client closes it
+ */
+func (s *Server) serveTracker(conn net.Conn) {
+	defer s.wg.Done()
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		command, query, _ := strings.Cut(strings.TrimRight(line, "\r\n"), " ")
+		args, err := url.ParseQuery(query)
+
+		var reply url.Values
+		if err != nil {
+			err = &trackerError{code: "invalid_args", message: err.Error()}
+		} else {
+			reply, err = s.handle(command, args)
+		}
+
+		if te, ok := err.(*trackerError); ok {
+			fmt.Fprintf(conn, "ERR %s %s\r\n", te.code, url.QueryEscape(te.message))
+		} else {
+			fmt.Fprintf(conn, "OK %s\r\n", reply.Encode())
+		}
+	}
+}
+
+type trackerError struct {
+	code    string
+	message string
+}
+
+func (e *trackerError) Error() string {
+	return e.code + ": " + e.message
+}
+
+func fail(code string, message string) error {
+	return &trackerError{code: code, message: message}
+}
+
+/**
+ * @desc Executes a tracker command
+ */
+func (s *Server) handle(command string, args url.Values) (reply url.Values, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.commands++
+	reply = make(url.Values)
+
+	if command == "noop" {
+		return
+	}
+	if command == "get_domains" {
+		s.getDomains(reply)
+		return
+	}
+
+	name := args.Get("domain")
+	if len(name) == 0 {
+		return nil, fail("no_domain", "No domain provided")
+	}
+	if command == "create_domain" {
+		if s.domains[name] != nil {
+			return nil, fail("domain_exists", "That domain already exists")
+		}
+		s.addDomain(name)
+		reply.Set("domain", name)
+		return
+	}
+
+	classes := s.domains[name]
+	if classes == nil {
+		return nil, fail("unreg_domain", "Domain name invalid/not found")
+	}
+	files := s.files[name]
+
+	switch command {
+	case "delete_domain":
+		if len(files) > 0 {
+			return nil, fail("domain_has_files", "Domain still has files")
+		}
+		delete(s.domains, name)
+		delete(s.files, name)
+	case "create_class", "update_class":
+		c := classes[args.Get("class")]
+		if command == "create_class" && c != nil {
+			return nil, fail("class_exists", "That class already exists")
+		}
+		if command == "update_class" && c == nil {
+			return nil, fail("class_not_found", "Class not found")
+		}
+		if c == nil {
+			c = &class{mindevcount: 2}
+			classes[args.Get("class")] = c
+		}
+		if n, _ := strconv.Atoi(args.Get("mindevcount")); n > 0 {
+			c.mindevcount = n
+		}
+		if len(args.Get("hashtype")) > 0 {
+			c.hashtype = args.Get("hashtype")
+		}
+		reply.Set("class", args.Get("class"))
+		reply.Set("mindevcount", strconv.Itoa(c.mindevcount))
+	case "delete_class":
+		if classes[args.Get("class")] == nil {
+			return nil, fail("class_not_found", "Class not found")
+		}
+		delete(classes, args.Get("class"))
+	case "create_open":
+		err = s.createOpen(classes, args, reply)
+	case "create_close":
+		err = s.createClose(classes, files, args, reply)
+	case "get_paths", "file_info", "delete", "updateclass":
+		f := files[args.Get("key")]
+		if len(args.Get("key")) == 0 {
+			return nil, fail("no_key", "No key provided")
+		}
+		if f == nil {
+			return nil, fail("unknown_key", "Unknown key")
+		}
+		switch command {
+		case "get_paths":
+			reply.Set("paths", "1")
+			reply.Set("path1", s.storage.URL+f.path)
+		case "file_info":
+			reply.Set("domain", name)
+			reply.Set("key", args.Get("key"))
+			reply.Set("class", f.class)
+			reply.Set("fid", strconv.FormatInt(f.fid, 10))
+			reply.Set("length", strconv.FormatInt(f.length, 10))
+			reply.Set("devcount", "1")
+			reply.Set("checksum", f.checksum)
+			if args.Get("devices") == "1" {
+				reply.Set("devids", strconv.Itoa(Devid))
+			}
+		case "delete":
+			delete(s.blobs, f.path)
+			delete(files, args.Get("key"))
+		case "updateclass":
+			if classes[args.Get("class")] == nil {
+				return nil, fail("class_not_found", "Class not found")
+			}
+			f.class = args.Get("class")
+		}
+	case "rename":
+		from, to := args.Get("from_key"), args.Get("to_key")
+		if files[from] == nil {
+			return nil, fail("unknown_key", "Unknown key")
+		}
+		if files[to] != nil {
+			return nil, fail("key_exists", "Target key name already exists; can't overwrite.")
+		}
+		files[to] = files[from]
+		delete(files, from)
+	case "list_keys":
+		err = s.listKeys(files, args, reply)
+	default:
+		return nil, fail("unknown_command", "Unknown server command")
+	}
+	return
+}
+
+/**
+ * @desc Answers get_domains
+ */
+func (s *Server) getDomains(reply url.Values) {
+	var names []string
+	for name := range s.domains {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	reply.Set("domains", strconv.Itoa(len(names)))
+	for i, name := range names {
+		prefix := fmt.Sprintf("domain%d", i+1)
+		reply.Set(prefix, name)
+
+		var classes []string
+		for c := range s.domains[name] {
+			classes = append(classes, c)
+		}
+		sort.Strings(classes)
+		reply.Set(prefix+"classes", strconv.Itoa(len(classes)))
+		for j, c := range classes {
+			cprefix := fmt.Sprintf("%sclass%d", prefix, j+1)
+			hashtype := s.domains[name][c].hashtype
+			if len(hashtype) == 0 {
+				hashtype = "NONE"
+			}
+			reply.Set(cprefix+"name", c)
+			reply.Set(cprefix+"mindevcount", strconv.Itoa(s.domains[name][c].mindevcount))
+			reply.Set(cprefix+"replpolicy", "MultipleHosts()")
+			reply.Set(cprefix+"hashtype", hashtype)
+		}
+	}
+}
+
+/**
+ * @desc Answers create_open: hands out a new fid and its path on the storage node
+ */
+func (s *Server) createOpen(classes map[string]*class, args url.Values, reply url.Values) error {
+	if len(args.Get("key")) == 0 {
+		return fail("no_key", "No key provided")
+	}
+	class_name := args.Get("class")
+	if len(class_name) == 0 {
+		class_name = "default"
+	}
+	if classes[class_name] == nil {
+		return fail("unreg_class", "Invalid class")
+	}
+
+	s.fid++
+	s.open_fids[s.fid] = class_name
+	path := fidPath(s.fid)
+	reply.Set("fid", strconv.FormatInt(s.fid, 10))
+	if args.Get("multi_dest") == "1" {
+		reply.Set("dev_count", "1")
+		reply.Set("devid_1", strconv.Itoa(Devid))
+		reply.Set("path_1", s.storage.URL+path)
+	} else {
+		reply.Set("devid", strconv.Itoa(Devid))
+		reply.Set("path", s.storage.URL+path)
+	}
+	return nil
+}
+
+/**
+ * @desc Answers create_close: checks the uploaded data and makes the key point to it
+ */
+func (s *Server) createClose(classes map[string]*class, files map[string]*file, args url.Values, reply url.Values) error {
+	fid, _ := strconv.ParseInt(args.Get("fid"), 10, 64)
+	path := fidPath(fid)
+	class_name, ok := s.open_fids[fid]
+	if !ok || s.storage.URL+path != args.Get("path") {
+		return fail("invalid_fid", "Invalid fid or path")
+	}
+
+	data, ok := s.blobs[path]
+	if !ok {
+		return fail("empty_file", "Upload not found on the storage node")
+	}
+	if size, _ := strconv.ParseInt(args.Get("size"), 10, 64); size != int64(len(data)) {
+		return fail("size_mismatch", fmt.Sprintf("Expected: %d; actual: %d; path: %s", size, len(data), args.Get("path")))
+	}
+
+	checksum := "NONE"
+	if sum := args.Get("checksum"); len(sum) > 0 {
+		hashtype, _, _ := strings.Cut(sum, ":")
+		computed := checksumString(hashtype, data)
+		if len(computed) == 0 {
+			return fail("invalid_checksum", "Unsupported checksum type")
+		}
+		if args.Get("checksumverify") == "1" && computed != sum {
+			return fail("checksum_mismatch", "Checksum mismatch: "+computed)
+		}
+		checksum = computed
+	}
+
+	key := args.Get("key")
+	if old := files[key]; old != nil {
+		delete(s.blobs, old.path)
+	}
+	delete(s.open_fids, fid)
+	files[key] = &file{fid: fid, class: class_name, path: path, length: int64(len(data)), checksum: checksum}
+	return nil
+}
+
+/**
+ * @desc Answers list_keys
+ */
+func (s *Server) listKeys(files map[string]*file, args url.Values, reply url.Values) error {
+	limit, _ := strconv.Atoi(args.Get("limit"))
+	if limit <= 0 || limit > 1000 {
+		limit = 1000
+	}
+
+	var keys []string
+	for key := range files {
+		if strings.HasPrefix(key, args.Get("prefix")) && key > args.Get("after") {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		return fail("none_match", "No keys match that pattern and after-value (if any).")
+	}
+	sort.Strings(keys)
+	if len(keys) > limit {
+		keys = keys[:limit]
+	}
+
+	reply.Set("key_count", strconv.Itoa(len(keys)))
+	for i, key := range keys {
+		reply.Set(fmt.Sprintf("key_%d", i+1), key)
+	}
+	reply.Set("next_after", keys[len(keys)-1])
+	return nil
+}
+
+/**
+ * @desc Serves the storage node: PUT stores, GET and HEAD return (ranges of) and DELETE removes a file
+ */
+func (s *Server) serveStorage(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "PUT":
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		content_md5 := r.Header.Get("Content-Md5")
+		if len(content_md5) == 0 {
+			content_md5 = r.Trailer.Get("Content-Md5")
+		}
+		if len(content_md5) > 0 {
+			sum := md5.Sum(data)
+			if content_md5 != base64.StdEncoding.EncodeToString(sum[:]) {
+				http.Error(w, "Content-MD5 mismatch", http.StatusBadRequest)
+				return
+			}
+		}
+		s.mutex.Lock()
+		s.blobs[r.URL.Path] = data
+		s.mutex.Unlock()
+		w.WriteHeader(http.StatusCreated)
+	case "GET", "HEAD":
+		s.mutex.Lock()
+		data, ok := s.blobs[r.URL.Path]
+		s.mutex.Unlock()
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+	case "DELETE":
+		s.mutex.Lock()
+		_, ok := s.blobs[r.URL.Path]
+		delete(s.blobs, r.URL.Path)
+		s.mutex.Unlock()
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+/**
+ * @desc Returns the path of a fid on the storage node, using the layout of mogstored
+ */
+func fidPath(fid int64) string {
+	padded := fmt.Sprintf("%010d", fid)
+	return fmt.Sprintf("/dev%d/%s/%s/%s/%s.fid", Devid, padded[0:1], padded[1:4], padded[4:7], padded)
+}
+
+/**
+ * @desc Returns the checksum of data formatted as '<hashtype>:<hex digest>', an empty string for unsupported hashtypes
+ */
+func checksumString(hashtype string, data []byte) string {
+	var h hash.Hash
+	switch hashtype {
+	case "MD5":
+		h = md5.New()
+	default:
+		return ""
+	}
+	h.Write(data)
+	return hashtype + ":" + hex.EncodeToString(h.Sum(nil))
+}
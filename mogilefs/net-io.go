@@ -19,56 +19,97 @@ package mogilefs
 
 import (
 	"bufio"
+	"context"
 	"errors"
-	"fmt"
 	"io"
+	"log/slog"
 	"net"
 	"net/url"
 	"regexp"
+	"time"
 )
 
 const (
-	cmd_getpaths     = "get_paths"
-	cmd_rename       = "rename"
-	cmd_delete       = "delete"
-	cmd_debug        = "file_debug"
-	cmd_create_open  = "create_open"
-	cmd_create_close = "create_close"
+	cmd_getpaths      = "get_paths"
+	cmd_rename        = "rename"
+	cmd_delete        = "delete"
+	cmd_debug         = "file_debug"
+	cmd_create_open   = "create_open"
+	cmd_create_close  = "create_close"
+	cmd_get_domains   = "get_domains"
+	cmd_create_domain = "create_domain"
+	cmd_delete_domain = "delete_domain"
+	cmd_create_class  = "create_class"
+	cmd_update_class  = "update_class"
+	cmd_delete_class  = "delete_class"
+	cmd_get_hosts     = "get_hosts"
+	cmd_create_host   = "create_host"
+	cmd_update_host   = "update_host"
+	cmd_delete_host   = "delete_host"
+	cmd_get_devices   = "get_devices"
+	cmd_create_device = "create_device"
+	cmd_set_state     = "set_state"
+	cmd_set_weight    = "set_weight"
+	cmd_list_keys     = "list_keys"
+	cmd_updateclass   = "updateclass"
+	cmd_file_info     = "file_info"
+	cmd_stats         = "stats"
+	cmd_noop          = "noop"
 )
 
 type countingReader struct {
 	r      io.Reader
 	nbytes int
+	// called once r returned io.EOF - may be nil
+	eof func()
 }
 
 func (cr *countingReader) Read(buffer []byte) (nr int, err error) {
 	nr, err = cr.r.Read(buffer)
 	cr.nbytes += nr
+	if err == io.EOF && cr.eof != nil {
+		cr.eof()
+		cr.eof = nil
+	}
 	return
 }
 
 /**
  * @desc Returns an established TCP connection to one of the specified trackers
+ * @param ctx context.Context aborts connecting if done
  * @return conn net.Conn connection
+ * @return host string the tracker we are connected to
  * @return err error last connection error if all trackers are down
  */
-func (m *MogileFsClient) getTrackerConnection() (conn net.Conn, err error) {
+func (m *MogileFsClient) getTrackerConnection(ctx context.Context) (conn net.Conn, host string, err error) {
+	if len(m.trackers) == 0 {
+		err = errors.New("internal:no trackers configured")
+		return
+	}
 
+	trackers := m.selector.Order(m.trackers)
+	if pinned, ok := ctx.Value(pinnedTrackerKey{}).(string); ok {
+		trackers = []string{pinned}
+	}
 	for _, ignoreBlacklist := range [2]bool{false, true} {
-		for _, host := range m.trackers {
-			m.last_tracker = host
+		for _, host = range trackers {
+			m.setLastTracker(host)
 
-			if ignoreBlacklist == false && m.trackerIsBad(m.last_tracker) {
+			if ignoreBlacklist == false && m.trackerIsBad(host) {
 				continue
 			}
 
-			conn, err = net.DialTimeout("tcp", m.last_tracker, m.dial_timeout)
+			conn, err = m.dialTracker(ctx, host)
 			if err == nil {
+				m.logger.DebugContext(ctx, "mogilefs: selected tracker", slog.String("tracker", host), slog.Bool("blacklisted", ignoreBlacklist))
 				// we connected to this tracker for whatever reason: it is NOT whitelisted now - it will only be
 				// whitelisted after returning a successful command or/and finishing the dead timeout
 				return
+			} else if ctx.Err() != nil {
+				// we gave up: that's not the fault of the tracker
+				return
 			} else {
-				m.markTrackerAsBad(m.last_tracker)
+				m.markTrackerAsBad(host)
 			}
 		}
 	}
@@ -80,16 +121,40 @@ func (m *MogileFsClient) getTrackerConnection() (conn net.Conn, err error) {
 /**
  * @desc Returns a tracker connection so it can be closed (or maybe put in a pool in a later version
  * @param conn net.Conn as handed out by getTrackerConnection()
+ * @param host string the tracker of conn
  */
-func (m *MogileFsClient) returnTrackerConnection(conn net.Conn, hadError bool) {
+func (m *MogileFsClient) returnTrackerConnection(conn net.Conn, host string, hadError bool) {
 	if hadError == true {
-		m.markTrackerAsBad(m.last_tracker)
+		m.markTrackerAsBad(host)
 	} else { // else: could keepalive
-		m.markTrackerAsAlive(m.last_tracker)
+		m.markTrackerAsAlive(host)
 	}
 	conn.Close()
 }
 
+/**
+ * @desc Returns the deadline of a tracker socket operation: timeout from now, or the deadline of ctx if it expires earlier
+ * @return deadline time.Time the deadline, the zero time for none
+ */
+func (m *MogileFsClient) trackerDeadline(ctx context.Context, timeout time.Duration) (deadline time.Time) {
+	if timeout > 0 {
+		deadline = time.Now().Add(timeout)
+	}
+	if ctx_deadline, ok := ctx.Deadline(); ok && (deadline.IsZero() || ctx_deadline.Before(deadline)) {
+		deadline = ctx_deadline
+	}
+	return
+}
+
+/**
+ * @desc Remembers the last tracker used, see LastTracker()
+ */
+func (m *MogileFsClient) setLastTracker(host string) {
+	m.mutex.Lock()
+	m.last_tracker = host
+	m.mutex.Unlock()
+}
+
 /**
  * @desc Performs a request on the connected mogilefsd
  * @param command string the mogilefsd command to execute
@@ -98,9 +163,92 @@ func (m *MogileFsClient) returnTrackerConnection(conn net.Conn, hadError bool) {
  * @return err error returned by the tracker - nil on success
  */
 var reMogileOk = regexp.MustCompile("^OK (.*)\r\n$")
-var reMogileFail = regexp.MustCompile("^ERR (\\S+) ")
+var reMogileFail = regexp.MustCompile("^ERR (\\S+)(?: (.*?))?\r?\n?$")
 
 func (m *MogileFsClient) DoRequest(command string, args url.Values) (values url.Values, err error) {
+	return m.DoRequestContext(context.Background(), command, args)
+}
+
+// Performs a request on the connected mogilefsd, see DoRequest().
+//
+// ctx limits the time spent waiting for a tracker connection and between retries, see
+// ContextWithPriority() to set the priority of the request.
+func (m *MogileFsClient) DoRequestContext(ctx context.Context, command string, args url.Values) (values url.Values, err error) {
+	if m.lifecycle.isDrained() {
+		err = ErrClientClosed
+		return
+	}
+
+	// tag the request with our identity without touching the callers args
+	m.mutex.Lock()
+	client_id := m.client_id
+	m.mutex.Unlock()
+	if len(client_id) > 0 && len(args.Get("client_id")) == 0 {
+		tagged_args := make(url.Values)
+		for k, v := range args {
+			tagged_args[k] = v
+		}
+		tagged_args.Set("client_id", client_id)
+		args = tagged_args
+	}
+
+	started := time.Now()
+	defer func() {
+		m.audit(ctx, command, args, started, err)
+	}()
+
+	for attempt := 1; ; attempt++ {
+		retryable := false
+		values, retryable, err = m.doSingleRequest(ctx, command, args)
+		if err == nil || !retryable || attempt >= m.retry_attempts {
+			break
+		}
+		// the failing tracker is blacklisted now: the next attempt picks another one
+		backoff := m.retryBackoff(attempt)
+		m.logger.DebugContext(ctx, "mogilefs: retrying command", slog.String("command", command), slog.Int("attempt", attempt), slog.Duration("backoff", backoff), slog.Any("error", err))
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		}
+	}
+	return
+}
+
+/**
+ * @desc Sends a command to a single tracker
+ * @param ctx context.Context aborts waiting for a connection of the pool
+ * @param command string the mogilefsd command to execute
+ * @param args url.Values list of the arguments of 'command'
+ * @return values url.Values of the result
+ * @return retryable bool true if the command failed and may safely be sent to another tracker
+ * @return err error returned by the tracker - nil on success
+ */
+func (m *MogileFsClient) doSingleRequest(ctx context.Context, command string, args url.Values) (values url.Values, retryable bool, err error) {
+	if err = m.injectChaos(command); err != nil {
+		retryable = true
+		return
+	}
+
+	info := &RequestInfo{Kind: RequestTracker, Command: command, Args: args}
+	if len(m.hooks) > 0 {
+		ctx = m.beforeRequest(ctx, info)
+		hook_started := time.Now()
+		defer func() {
+			m.afterRequest(ctx, info, hook_started, err)
+		}()
+	}
+
+	if err = m.pool.acquire(ctx, m.requestPriority(ctx)); err != nil {
+		return
+	}
+	defer m.pool.release()
+
+	// once the command was sent, we can only retry if executing it twice does no harm
+	retryable = true
+	idempotent := isIdempotent(command)
 
 	// change command into something understood by mogilefsd
 	// format: COMMAND URLENCODED_ARGS\r\n
@@ -109,36 +257,86 @@ func (m *MogileFsClient) DoRequest(command string, args url.Values) (values url.
 	tracker_reply := ""   // buffer to store the tracker reply
 	blame_tracker := true // passed to returnTrackerConnection to mark a tracker as 'suspect'
 
-	tracker_conn, tracker_conn_err := m.getTrackerConnection()
+	started := time.Now()
+	tracker_conn, tracker_host, tracker_conn_err := m.getTrackerConnection(ctx)
+	info.Tracker = tracker_host
 	err = tracker_conn_err
 	if err == nil {
+		// unblock reads and writes once the caller gives up
+		stop := context.AfterFunc(ctx, func() {
+			tracker_conn.SetDeadline(time.Now())
+		})
+		defer stop()
+		tracker_conn.SetWriteDeadline(m.trackerDeadline(ctx, m.write_timeout))
+		m.debugWire(tracker_host, ">>", command)
 		_, err = tracker_conn.Write([]byte(command))
 		if err == nil {
+			retryable = idempotent
+			tracker_conn.SetReadDeadline(m.trackerDeadline(ctx, m.read_timeout))
 			b := bufio.NewReader(tracker_conn)
 			tracker_reply, err = b.ReadString('\n')
+			if len(tracker_reply) > 0 {
+				m.debugWire(tracker_host, "<<", tracker_reply)
+			}
 		}
 	}
 
 	if len(tracker_reply) > 0 {
-		okMatch := reMogileOk.FindAllStringSubmatch(tracker_reply, 1)
-		if okMatch == nil {
-			// reply was not ok: try to get a better error message
-			failMatch := reMogileFail.FindAllStringSubmatch(tracker_reply, 1)
-			if failMatch == nil {
-				err = errors.New("internal:invalid tracker reply")
-			} else {
-				err = fmt.Errorf("mogilefsd:%s", failMatch[0][1])
-				blame_tracker = false // that's not a tracker failure
-			}
-		} else {
-			// reply was probably ok: just let
-			// ParseQuery() decide the outcome of err
-			values, err = url.ParseQuery(okMatch[0][1])
+		var answered bool
+		values, answered, err = parseTrackerReply(tracker_reply)
+		if answered {
+			// the tracker did its job, even if it returned an error
 			blame_tracker = false
+			retryable = false
 		}
 	}
 
-	m.returnTrackerConnection(tracker_conn, blame_tracker)
+	// the caller gave up before the tracker answered: that's not the fault of the tracker
+	gave_up := blame_tracker && ctx.Err() != nil
+
+	if tracker_conn != nil && gave_up {
+		// we do not know whether the tracker would have answered: leave its blacklist state alone
+		tracker_conn.Close()
+	} else if tracker_conn != nil {
+		if blame_tracker {
+			m.selector.Observe(tracker_host, time.Since(started), err)
+		} else {
+			m.selector.Observe(tracker_host, time.Since(started), nil)
+		}
+		m.returnTrackerConnection(tracker_conn, tracker_host, blame_tracker)
+	}
+
+	return
+}
+
+/**
+ * @desc Parses a single reply line of a tracker: 'OK <urlencoded values>\r\n' or 'ERR <code> [<urlencoded message>]'
+ * @param reply string the reply, including the line terminator
+ * @return values url.Values the values of an OK reply
+ * @return answered bool true if reply is a valid OK or ERR reply, false if the tracker misbehaved
+ * @return err error a *TrackerError for ERR replies, set if reply could not be parsed
+ */
+func parseTrackerReply(reply string) (values url.Values, answered bool, err error) {
+	okMatch := reMogileOk.FindAllStringSubmatch(reply, 1)
+	if okMatch != nil {
+		// reply was probably ok: just let
+		// ParseQuery() decide the outcome of err
+		values, err = url.ParseQuery(okMatch[0][1])
+		answered = true
+		return
+	}
 
+	// reply was not ok: try to get a better error message
+	failMatch := reMogileFail.FindAllStringSubmatch(reply, 1)
+	if failMatch == nil {
+		err = errors.New("internal:invalid tracker reply")
+		return
+	}
+	message, uerr := url.QueryUnescape(failMatch[0][2])
+	if uerr != nil {
+		message = failMatch[0][2]
+	}
+	err = &TrackerError{Code: failMatch[0][1], Message: message}
+	answered = true
 	return
 }
@@ -0,0 +1,177 @@
+/*
+
+Copyright 2015 Adrian Ulrich
+Copyright 2015 Fixxpunkt AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package mogilefs
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// Replies in the format of mogilefsd: url encoded values terminated by CRLF
+var trackerReplies = []struct {
+	name     string
+	reply    string
+	values   url.Values
+	answered bool
+	code     string
+	message  string
+}{
+	{
+		name:     "ok without payload (delete)",
+		reply:    "OK \r\n",
+		values:   url.Values{},
+		answered: true,
+	},
+	{
+		name:     "get_paths with two paths",
+		reply:    "OK path1=http%3A%2F%2F10.0.0.1%3A7500%2Fdev1%2F0%2F000%2F000%2F0000000123.fid&path2=http%3A%2F%2F10.0.0.2%3A7500%2Fdev7%2F0%2F000%2F000%2F0000000123.fid&paths=2\r\n",
+		values:   url.Values{"paths": {"2"}, "path1": {"http://10.0.0.1:7500/dev1/0/000/000/0000000123.fid"}, "path2": {"http://10.0.0.2:7500/dev7/0/000/000/0000000123.fid"}},
+		answered: true,
+	},
+	{
+		name:     "get_paths of a key without copies",
+		reply:    "OK paths=0\r\n",
+		values:   url.Values{"paths": {"0"}},
+		answered: true,
+	},
+	{
+		name:     "create_open with multi_dest",
+		reply:    "OK dev_count=2&devid_1=3&path_1=http%3A%2F%2F10.0.0.3%3A7500%2Fdev3%2F0%2F000%2F000%2F0000000124.fid&devid_2=1&path_2=http%3A%2F%2F10.0.0.1%3A7500%2Fdev1%2F0%2F000%2F000%2F0000000124.fid&fid=124\r\n",
+		values:   url.Values{"dev_count": {"2"}, "devid_1": {"3"}, "path_1": {"http://10.0.0.3:7500/dev3/0/000/000/0000000124.fid"}, "devid_2": {"1"}, "path_2": {"http://10.0.0.1:7500/dev1/0/000/000/0000000124.fid"}, "fid": {"124"}},
+		answered: true,
+	},
+	{
+		name:     "error with message",
+		reply:    "ERR unknown_key unknown_key\r\n",
+		answered: true,
+		code:     "unknown_key",
+		message:  "unknown_key",
+	},
+	{
+		name:     "error with url escaped message",
+		reply:    "ERR domain_not_found Domain+name+invalid%2Fnot+found\r\n",
+		answered: true,
+		code:     "domain_not_found",
+		message:  "Domain name invalid/not found",
+	},
+	{
+		name:     "error with invalid escape keeps the raw message",
+		reply:    "ERR key_exists 100%+taken\r\n",
+		answered: true,
+		code:     "key_exists",
+		message:  "100%+taken",
+	},
+	{
+		name:     "error without message",
+		reply:    "ERR none_match\r\n",
+		answered: true,
+		code:     "none_match",
+	},
+	{
+		name:     "error without carriage return",
+		reply:    "ERR unknown_command Unknown+server+command\n",
+		answered: true,
+		code:     "unknown_command",
+		message:  "Unknown server command",
+	},
+	{
+		name:  "ok without carriage return",
+		reply: "OK paths=0\n",
+	},
+	{
+		name:  "http reply of a storage node",
+		reply: "HTTP/1.0 400 Bad Request\r\n",
+	},
+	{
+		name:  "garbage",
+		reply: "\x00\xffOKAY\r\n",
+	},
+}
+
+func TestParseTrackerReply(t *testing.T) {
+	for _, tt := range trackerReplies {
+		t.Run(tt.name, func(t *testing.T) {
+			values, answered, err := parseTrackerReply(tt.reply)
+			if answered != tt.answered {
+				t.Fatalf("answered = %v, want %v (err: %v)", answered, tt.answered, err)
+			}
+
+			var tracker_err *TrackerError
+			switch {
+			case len(tt.code) > 0:
+				if !errors.As(err, &tracker_err) {
+					t.Fatalf("err = %v, want a *TrackerError", err)
+				}
+				if tracker_err.Code != tt.code || tracker_err.Message != tt.message {
+					t.Errorf("err = %q/%q, want %q/%q", tracker_err.Code, tracker_err.Message, tt.code, tt.message)
+				}
+			case tt.answered:
+				if err != nil {
+					t.Fatalf("err = %v, want nil", err)
+				}
+				if !reflect.DeepEqual(values, tt.values) {
+					t.Errorf("values = %v, want %v", values, tt.values)
+				}
+			default:
+				if err == nil || errors.As(err, &tracker_err) {
+					t.Errorf("err = %v, want an invalid reply error", err)
+				}
+			}
+		})
+	}
+}
+
+// Returns the address of a wedged tracker: it accepts connections but never answers
+func newWedgedTracker(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			t.Cleanup(func() { conn.Close() })
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func TestGivingUpKeepsTrackerBlacklisted(t *testing.T) {
+	tracker := newWedgedTracker(t)
+	m := New("test", []string{tracker}, WithRetries(1))
+	m.markTrackerAsBad(tracker)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := m.DoRequestContext(ctx, cmd_noop, url.Values{}); err == nil {
+		t.Fatal("request to a wedged tracker succeeded")
+	}
+	if len(m.BlacklistStatus()) != 1 {
+		t.Errorf("tracker was removed from the blacklist after the caller gave up")
+	}
+}
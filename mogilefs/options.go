@@ -0,0 +1,104 @@
+/*
+
+Copyright 2015 Adrian Ulrich
+Copyright 2015 Fixxpunkt AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package mogilefs
+
+import (
+	"net/http"
+	"time"
+)
+
+// An optional argument to New()
+type Option func(m *MogileFsClient)
+
+// Sets the timeout used to connect to a tracker (default: 1 second)
+func WithDialTimeout(timeout time.Duration) Option {
+	return func(m *MogileFsClient) {
+		m.dial_timeout = timeout
+	}
+}
+
+// Sets how long a tracker may take to accept a command (write) and to reply to it (read) (default: 5 and 30 seconds).
+//
+// A tracker exceeding a timeout is blacklisted. Pass 0 to wait forever. The deadline of the
+// context passed to DoRequestContext is applied in addition.
+func WithTrackerTimeouts(read time.Duration, write time.Duration) Option {
+	return func(m *MogileFsClient) {
+		m.read_timeout = read
+		m.write_timeout = write
+	}
+}
+
+// Sets the http.Client used to talk to the storage nodes.
+//
+// The default client keeps up to 16 idle connections per storage node and gives up if
+// a storage node does not connect within 5 seconds or does not answer within 30 seconds.
+// It has no overall timeout, as transfers of large files may take a long time.
+func WithHTTPClient(client *http.Client) Option {
+	return func(m *MogileFsClient) {
+		m.http_client = client
+	}
+}
+
+// Sets how long a failing tracker is avoided (default: 60 seconds)
+func WithBlacklistDuration(duration time.Duration) Option {
+	return func(m *MogileFsClient) {
+		m.dead_trackers.duration = duration
+	}
+}
+
+// Sets the number of paths requested by GetPaths if the caller does not specify a Pathcount (default: 2)
+func WithPathcountDefault(pathcount int) Option {
+	return func(m *MogileFsClient) {
+		m.default_pathcount = pathcount
+	}
+}
+
+// Sets the value of NoVerify used by GetPaths if called without options (default: true)
+func WithNoVerifyDefault(noverify bool) Option {
+	return func(m *MogileFsClient) {
+		m.default_noverify = noverify
+	}
+}
+
+// Sets the class of uploads which do not specify one (default: an empty string, the default class of the domain)
+func WithDefaultClass(class string) Option {
+	return func(m *MogileFsClient) {
+		m.default_class = class
+	}
+}
+
+// Sets the identity of the client, see SetClientId()
+func WithClientId(id string) Option {
+	return func(m *MogileFsClient) {
+		m.client_id = id
+	}
+}
+
+// Makes misuse of the client return an error instead of falling back to a default.
+//
+// A strict client refuses, before talking to any tracker:
+//   - empty keys, and empty prefixes passed to RenamePrefix
+//   - keys longer than MaxKeyLength bytes as sent to the tracker (ie. after WithKeyEncoding)
+//   - keys with invalid UTF-8 or control characters, unless they are sent hex encoded
+//   - a nil reader passed to Create, instead of uploading an empty file
+//   - a negative GetPathsOpts.Pathcount, instead of requesting 2 paths
+func WithStrictMode() Option {
+	return func(m *MogileFsClient) {
+		m.strict = true
+	}
+}
@@ -0,0 +1,138 @@
+/*
+
+Copyright 2015 Adrian Ulrich
+Copyright 2015 Fixxpunkt AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package mogilefs
+
+import (
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Settings of WithUploadPacing()
+type PacingOpts struct {
+	// Uploads are delayed while the replication backlog exceeds this number of files
+	Threshold int
+	// How often the backlog is checked (default: 10s)
+	Interval time.Duration
+	// Upper limit of the delay of a single upload, 0 for none
+	MaxDelay time.Duration
+	// Returns the current replication backlog - defaults to ReplicationBacklog() of the client
+	Backlog func() (int, error)
+}
+
+// Slows down Create while the trackers are behind with replication.
+//
+// Bulk imports can upload files much faster than the cluster replicates them. With pacing enabled,
+// Create waits until the replication backlog dropped below opts.Threshold before starting an upload.
+// Failures to determine the backlog never block uploads.
+func WithUploadPacing(opts PacingOpts) Option {
+	return func(m *MogileFsClient) {
+		if opts.Interval <= 0 {
+			opts.Interval = time.Duration(10) * time.Second
+		}
+		if opts.Backlog == nil {
+			opts.Backlog = m.ReplicationBacklog
+		}
+		m.pacing = &pacer{opts: opts}
+	}
+}
+
+// Returns the number of files of our domain which have fewer copies than required by their class.
+//
+// The number is computed from the replication statistics of the tracker ('stats' command), which
+// may be expensive on large installations: do not call this for each upload.
+func (m *MogileFsClient) ReplicationBacklog() (backlog int, err error) {
+	domains, err := m.GetDomains()
+	if err != nil {
+		return
+	}
+	mindevcount := make(map[string]int)
+	for _, domain := range domains {
+		if domain.Name == m.domain {
+			for _, class := range domain.Classes {
+				mindevcount[class.Name] = class.Mindevcount
+			}
+		}
+	}
+
+	args := make(url.Values)
+	args.Add("replication", "1")
+	values, err := m.DoRequest(cmd_stats, args)
+	if err != nil {
+		return
+	}
+	for i := 1; i <= intValue(values, "replicationcount"); i++ {
+		prefix := fmt.Sprintf("replication%d", i)
+		if stringValue(values, prefix+"domain") != m.domain {
+			continue
+		}
+		if intValue(values, prefix+"devcount") < mindevcount[stringValue(values, prefix+"class")] {
+			backlog += intValue(values, prefix+"files")
+		}
+	}
+	return
+}
+
+// State of WithUploadPacing()
+type pacer struct {
+	opts  PacingOpts
+	mutex sync.Mutex
+	// Last known backlog and when it was checked
+	backlog int
+	checked time.Time
+}
+
+/**
+ * @desc Waits until the replication backlog is below the threshold (or the maximum delay passed)
+ */
+func (m *MogileFsClient) pace() {
+	p := m.pacing
+	if p == nil {
+		return
+	}
+
+	started := time.Now()
+	for {
+		if p.currentBacklog() <= p.opts.Threshold {
+			return
+		}
+		if p.opts.MaxDelay > 0 && time.Since(started) >= p.opts.MaxDelay {
+			return
+		}
+		time.Sleep(p.opts.Interval)
+	}
+}
+
+/**
+ * @desc Returns the backlog, asking the trackers at most once per interval
+ */
+func (p *pacer) currentBacklog() int {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if time.Since(p.checked) >= p.opts.Interval {
+		p.checked = time.Now()
+		backlog, err := p.opts.Backlog()
+		if err != nil {
+			backlog = 0
+		}
+		p.backlog = backlog
+	}
+	return p.backlog
+}
@@ -0,0 +1,301 @@
+/*
+
+Copyright 2015 Adrian Ulrich
+Copyright 2015 Fixxpunkt AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package mogilefs
+
+import (
+	"container/list"
+	"errors"
+	"sync"
+	"time"
+)
+
+// A size limited LRU cache of get_paths results
+type pathCache struct {
+	mutex sync.Mutex
+	// maximum number of keys to remember
+	max_entries int
+	// maps a key to its element in lru
+	entries map[string]*list.Element
+	// *pathCacheEntry values, most recently used first
+	lru *list.List
+}
+
+type pathCacheEntry struct {
+	key   string
+	paths []string
+	// when the paths were returned by a tracker
+	fetched time.Time
+	// when the entry expires, zero if it does not
+	expires time.Time
+}
+
+// Generations of keys with lookups in flight, see MogileFsClient.queryPaths()
+type pathGenerations struct {
+	mutex   sync.Mutex
+	entries map[string]*pathGeneration
+}
+
+type pathGeneration struct {
+	// incremented by each change of the key
+	gen uint64
+	// number of lookups in flight
+	lookups int
+}
+
+// Makes GetPaths return the last known paths of a key if no tracker can be reached.
+//
+// Paths are remembered for up to maxAge and for at most maxEntries keys. Results
+// returned from this cache are marked as Stale by LookupPaths.
+func WithStalePaths(maxAge time.Duration, maxEntries int) Option {
+	return func(m *MogileFsClient) {
+		m.stale_paths = newPathCache(maxEntries)
+		m.stale_max_age = maxAge
+	}
+}
+
+// A cache of the paths returned by GetPaths, see WithSharedPathCache().
+//
+// The packages mogilefs/memcache and mogilefs/rediscache implement caches shared by
+// multiple processes. Keys passed to the cache are prefixed by the domain of the client.
+// Implementations must be safe for concurrent use and should treat failures as misses.
+type PathCache interface {
+	// Returns the paths of key, false if they are not cached
+	Get(key string) (paths []string, ok bool)
+	// Stores the paths of key for up to ttl
+	Set(key string, paths []string, ttl time.Duration)
+	// Removes the paths of key
+	Delete(key string)
+}
+
+// Caches the paths returned by GetPaths for up to ttl, for at most maxEntries keys (least recently used keys are evicted).
+//
+// The cache saves a tracker round trip for keys which are read repeatedly. It is only used
+// for lookups which do not verify the paths (see GetPathsOpts.NoVerify) and ignores the
+// other options, eg. Pathcount. Create, Delete and Rename of this client update
+// the cache, changes made by other clients are only seen after ttl. Cached results are
+// marked as Cached by LookupPaths.
+func WithPathCache(ttl time.Duration, maxEntries int) Option {
+	return WithSharedPathCache(&memoryPathCache{pc: newPathCache(maxEntries)}, ttl)
+}
+
+// Caches the paths returned by GetPaths in cache for up to ttl, see WithPathCache().
+//
+// Clients sharing a cache see the paths looked up by each other, while changes made by
+// one client (eg. Delete) only invalidate the shared cache.
+func WithSharedPathCache(cache PathCache, ttl time.Duration) Option {
+	return func(m *MogileFsClient) {
+		m.path_cache = cache
+		m.path_cache_ttl = ttl
+	}
+}
+
+// The in-process PathCache of WithPathCache()
+type memoryPathCache struct {
+	pc *pathCache
+}
+
+func (mc *memoryPathCache) Get(key string) (paths []string, ok bool) {
+	entry, found := mc.pc.get(key)
+	if found && time.Now().Before(entry.expires) {
+		paths, ok = append([]string(nil), entry.paths...), true
+	}
+	return
+}
+
+func (mc *memoryPathCache) Set(key string, paths []string, ttl time.Duration) {
+	now := time.Now()
+	mc.pc.set(key, paths, now, now.Add(ttl))
+}
+
+func (mc *memoryPathCache) Delete(key string) {
+	mc.pc.remove(key)
+}
+
+func newPathCache(max_entries int) *pathCache {
+	return &pathCache{max_entries: max_entries, entries: make(map[string]*list.Element), lru: list.New()}
+}
+
+/**
+ * @desc Returns the cached entry of key
+ */
+func (pc *pathCache) get(key string) (entry pathCacheEntry, ok bool) {
+	pc.mutex.Lock()
+	defer pc.mutex.Unlock()
+
+	if elem, found := pc.entries[key]; found {
+		pc.lru.MoveToFront(elem)
+		entry, ok = *elem.Value.(*pathCacheEntry), true
+	}
+	return
+}
+
+/**
+ * @desc Stores the paths of key, evicting the least recently used key if the cache is full
+ * @param expires time.Time when the entry expires, zero if it does not
+ */
+func (pc *pathCache) set(key string, paths []string, fetched time.Time, expires time.Time) {
+	pc.mutex.Lock()
+	defer pc.mutex.Unlock()
+
+	entry := &pathCacheEntry{key: key, paths: paths, fetched: fetched, expires: expires}
+	if elem, found := pc.entries[key]; found {
+		pc.lru.MoveToFront(elem)
+		elem.Value = entry
+		return
+	}
+
+	pc.entries[key] = pc.lru.PushFront(entry)
+	for pc.lru.Len() > pc.max_entries {
+		oldest := pc.lru.Back()
+		pc.lru.Remove(oldest)
+		delete(pc.entries, oldest.Value.(*pathCacheEntry).key)
+	}
+}
+
+/**
+ * @desc Forgets the paths of key
+ */
+func (pc *pathCache) remove(key string) {
+	pc.mutex.Lock()
+	defer pc.mutex.Unlock()
+
+	if elem, found := pc.entries[key]; found {
+		pc.lru.Remove(elem)
+		delete(pc.entries, key)
+	}
+}
+
+/**
+ * @desc Updates the caches after a get_paths command
+ * @param key string the key passed to get_paths
+ * @param result PathsResult the result of get_paths, only used if err is nil
+ * @param err error the error returned by get_paths
+ */
+func (m *MogileFsClient) rememberPaths(key string, result PathsResult, err error) {
+	if m.stale_paths != nil {
+		if err == nil {
+			m.stale_paths.set(key, result.Paths, result.Fetched, time.Time{})
+		} else if errors.Is(err, ErrUnknownKey) {
+			m.stale_paths.remove(key)
+		}
+	}
+	if m.path_cache != nil && !result.Stale {
+		if err == nil && len(result.Paths) > 0 {
+			m.path_cache.Set(m.domain+":"+key, result.Paths, m.path_cache_ttl)
+		} else if errors.Is(err, ErrUnknownKey) {
+			m.path_cache.Delete(m.domain + ":" + key)
+		}
+	}
+}
+
+/**
+ * @desc Returns the paths of key stored in the path cache
+ */
+func (m *MogileFsClient) cachedPaths(key string) (result PathsResult, ok bool) {
+	if m.path_cache == nil {
+		return
+	}
+	if paths, found := m.path_cache.Get(m.domain + ":" + key); found && len(paths) > 0 {
+		result, ok = PathsResult{Paths: paths, Cached: true, Size: -1}, true
+	}
+	return
+}
+
+/**
+ * @desc Returns the last known paths of key if err indicates that no tracker could be reached
+ */
+func (m *MogileFsClient) stalePaths(key string, err error) (result PathsResult, ok bool) {
+	var tracker_err *TrackerError
+	if m.stale_paths == nil || errors.As(err, &tracker_err) {
+		return
+	}
+
+	entry, found := m.stale_paths.get(key)
+	if found && time.Since(entry.fetched) <= m.stale_max_age {
+		result, ok = PathsResult{Paths: entry.paths, Stale: true, Fetched: entry.fetched, Size: -1}, true
+	}
+	return
+}
+
+/**
+ * @desc Forgets everything we know about the paths of key, called after modifying key
+ */
+func (m *MogileFsClient) forgetPaths(key string) {
+	m.path_generations.bump(key)
+	if m.stale_paths != nil {
+		m.stale_paths.remove(key)
+	}
+	if m.path_cache != nil {
+		m.path_cache.Delete(m.domain + ":" + key)
+	}
+}
+
+/**
+ * @desc Registers a lookup of key, returns the generation to pass to current() and end()
+ */
+func (pg *pathGenerations) begin(key string) uint64 {
+	pg.mutex.Lock()
+	defer pg.mutex.Unlock()
+
+	if pg.entries == nil {
+		pg.entries = make(map[string]*pathGeneration)
+	}
+	entry, found := pg.entries[key]
+	if !found {
+		entry = &pathGeneration{}
+		pg.entries[key] = entry
+	}
+	entry.lookups++
+	return entry.gen
+}
+
+/**
+ * @desc Returns true if key did not change since begin() returned gen
+ */
+func (pg *pathGenerations) current(key string, gen uint64) bool {
+	pg.mutex.Lock()
+	defer pg.mutex.Unlock()
+	return pg.entries[key].gen == gen
+}
+
+/**
+ * @desc Unregisters a lookup of key, returns true if key did not change since begin() returned gen
+ */
+func (pg *pathGenerations) end(key string, gen uint64) (current bool) {
+	pg.mutex.Lock()
+	defer pg.mutex.Unlock()
+
+	entry := pg.entries[key]
+	current = entry.gen == gen
+	if entry.lookups--; entry.lookups == 0 {
+		delete(pg.entries, key)
+	}
+	return
+}
+
+/**
+ * @desc Records a change of key: lookups in flight must not cache their result
+ */
+func (pg *pathGenerations) bump(key string) {
+	pg.mutex.Lock()
+	defer pg.mutex.Unlock()
+
+	if entry, found := pg.entries[key]; found {
+		entry.gen++
+	}
+}
@@ -0,0 +1,75 @@
+/*
+
+Copyright 2015 Adrian Ulrich
+Copyright 2015 Fixxpunkt AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package mogilefs
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestMemoryPathCacheExpires(t *testing.T) {
+	mc := &memoryPathCache{pc: newPathCache(10)}
+	mc.Set("k", []string{"http://a/1"}, 50*time.Millisecond)
+
+	if paths, ok := mc.Get("k"); !ok || len(paths) != 1 {
+		t.Fatalf("fresh entry: %v, %v", paths, ok)
+	}
+	entry, _ := mc.pc.get("k")
+	if !entry.expires.After(entry.fetched) {
+		t.Errorf("entry fetched at %s expires at %s", entry.fetched, entry.expires)
+	}
+	time.Sleep(60 * time.Millisecond)
+	if paths, ok := mc.Get("k"); ok {
+		t.Errorf("expired entry returned %v", paths)
+	}
+}
+
+func TestDeleteDuringLookupIsNotCached(t *testing.T) {
+	requested, release := make(chan struct{}), make(chan struct{})
+	tracker := newScriptedTracker(t, func(command string, args url.Values) string {
+		if command == cmd_getpaths {
+			close(requested)
+			<-release
+			return "OK paths=1&path1=http%3A%2F%2F127.0.0.1%3A1%2Fdev1%2F0000000001.fid"
+		}
+		return "OK "
+	})
+	m := New("test", []string{tracker}, WithPathCache(time.Minute, 10))
+
+	done := make(chan error)
+	go func() {
+		_, err := m.LookupPaths("k", &GetPathsOpts{NoVerify: true})
+		done <- err
+	}()
+	<-requested
+	if err := m.Delete("k"); err != nil {
+		t.Fatalf("deleting: %v", err)
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatalf("lookup: %v", err)
+	}
+
+	if cached, ok := m.cachedPaths("k"); ok {
+		t.Errorf("paths looked up before Delete were cached: %v", cached.Paths)
+	}
+	if len(m.path_generations.entries) != 0 {
+		t.Errorf("generations of finished lookups are kept: %v", m.path_generations.entries)
+	}
+}
@@ -0,0 +1,195 @@
+/*
+
+Copyright 2015 Adrian Ulrich
+Copyright 2015 Fixxpunkt AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package mogilefs
+
+import (
+	"hash/fnv"
+	"net"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// A path of a key, returned by GetPathsInfo()
+type Path struct {
+	// The key the path belongs to
+	Key string
+	// The URL of the file on the storage node
+	URL string
+	// The device holding the file, 0 if unknown
+	Devid int
+	// True if the client checked that the file can be read (see GetPathsOpts.NoVerify)
+	Verified bool
+	// Time it took to verify the path, 0 if not verified
+	Latency time.Duration
+}
+
+// Orders the paths of a key by preference, see WithPathSorter().
+//
+// The sorter must only reorder paths: adding or removing paths is not supported.
+type PathSorter func(paths []Path)
+
+// Reorders the paths returned by the trackers before they are returned by GetPaths or used by Fetch (default: keep the order of the tracker, verified paths are ordered by latency)
+func WithPathSorter(sorter PathSorter) Option {
+	return func(m *MogileFsClient) {
+		m.path_sorter = sorter
+	}
+}
+
+// Returns a PathSorter preferring storage nodes in the given networks (eg. the local subnet or rack).
+//
+// Paths in the first network come first, paths not in any network last. The order within
+// each group stays the same. Storage nodes must be configured by IP address for this to work.
+func PreferNetworks(networks ...*net.IPNet) PathSorter {
+	rank := func(p Path) int {
+		if ip := net.ParseIP(hostOnly(StorageHost(p.URL))); ip != nil {
+			for i, network := range networks {
+				if network.Contains(ip) {
+					return i
+				}
+			}
+		}
+		return len(networks)
+	}
+	return func(paths []Path) {
+		sort.SliceStable(paths, func(i, j int) bool {
+			return rank(paths[i]) < rank(paths[j])
+		})
+	}
+}
+
+// Returns a PathSorter preferring the verified paths with the lowest latency
+func PreferLowLatency() PathSorter {
+	return func(paths []Path) {
+		sort.SliceStable(paths, func(i, j int) bool {
+			if paths[i].Verified != paths[j].Verified {
+				return paths[i].Verified
+			}
+			return paths[i].Latency < paths[j].Latency
+		})
+	}
+}
+
+// Returns a PathSorter ordering the paths of each key by a consistent hash of the key and the storage node.
+//
+// All clients using it fetch a given key from the same replica (as long as it is available),
+// which maximizes the page cache hit rate of the storage nodes for hot content. Keys are
+// spread evenly over the storage nodes, and adding or removing a storage node only changes
+// the order of the keys it holds.
+func ConsistentHash() PathSorter {
+	weight := func(p Path) uint64 {
+		h := fnv.New64a()
+		h.Write([]byte(p.Key))
+		h.Write([]byte{0})
+		h.Write([]byte(StorageHost(p.URL)))
+		return h.Sum64()
+	}
+	return func(paths []Path) {
+		sort.SliceStable(paths, func(i, j int) bool {
+			return weight(paths[i]) > weight(paths[j])
+		})
+	}
+}
+
+// Returns all known paths of the requested key with details about each path, see GetPaths().
+func (m *MogileFsClient) GetPathsInfo(key string, opts *GetPathsOpts) (paths []Path, err error) {
+	result, err := m.LookupPaths(key, opts)
+	paths = result.Details
+	return
+}
+
+var rePathDevid = regexp.MustCompile("/dev(\\d+)/")
+
+/**
+ * @desc Returns the device id of a path returned by the trackers ('http://host:7500/dev12/0/000/000/0000000123.fid'), 0 if unknown
+ */
+func pathDevid(path string) (devid int) {
+	if match := rePathDevid.FindStringSubmatch(path); match != nil {
+		devid, _ = strconv.Atoi(match[1])
+	}
+	return
+}
+
+/**
+ * @desc Returns host without its port
+ */
+func hostOnly(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		return h
+	}
+	return host
+}
+
+/**
+ * @desc Fills in the details of result (if missing) and applies the path sorter
+ * @param key string the key the paths belong to
+ */
+func (m *MogileFsClient) sortPaths(key string, result *PathsResult) {
+	if result.Details == nil {
+		result.Details = make([]Path, 0, len(result.Paths))
+		for _, path := range result.Paths {
+			result.Details = append(result.Details, Path{URL: path, Devid: pathDevid(path)})
+		}
+	}
+	for i := range result.Details {
+		result.Details[i].Key = key
+	}
+	if m.path_sorter != nil {
+		m.path_sorter(result.Details)
+	}
+	if m.failed_paths != nil {
+		// try replicas which failed recently last
+		sort.SliceStable(result.Details, func(i, j int) bool {
+			return !m.failed_paths.isBad(result.Details[i].URL) && m.failed_paths.isBad(result.Details[j].URL)
+		})
+	}
+	if m.dead_storage != nil {
+		// ...and replicas on blacklisted storage nodes after all others
+		sort.SliceStable(result.Details, func(i, j int) bool {
+			return !m.storageIsBad(result.Details[i].URL) && m.storageIsBad(result.Details[j].URL)
+		})
+	}
+	result.Paths = make([]string, len(result.Details))
+	for i, p := range result.Details {
+		result.Paths[i] = p.URL
+	}
+}
+
+// Sets how long a path which failed to return its data is tried after all other paths of a key (default: 10 seconds).
+//
+// This keeps repeated reads of the same key from waiting for a broken replica each time.
+// Pass 0 to disable.
+func WithFailedPathTTL(ttl time.Duration) Option {
+	return func(m *MogileFsClient) {
+		m.failed_paths = nil
+		if ttl > 0 {
+			m.failed_paths = newBlacklist(ttl)
+			m.failed_paths.max_entries = 10000
+		}
+	}
+}
+
+/**
+ * @desc Remembers that path failed, see WithFailedPathTTL()
+ */
+func (m *MogileFsClient) markPathFailed(path string) {
+	if m.failed_paths != nil {
+		m.failed_paths.markBad(path)
+	}
+}
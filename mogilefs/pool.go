@@ -0,0 +1,156 @@
+/*
+
+Copyright 2015 Adrian Ulrich
+Copyright 2015 Fixxpunkt AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package mogilefs
+
+import (
+	"container/list"
+	"context"
+	"sync"
+)
+
+// Priority of a tracker request, see TrackerPool
+type Priority int
+
+const (
+	// Latency sensitive requests (the default)
+	PriorityInteractive Priority = iota
+	// Bulk jobs which may wait for interactive requests
+	PriorityBatch
+	priority_count
+)
+
+// Limits the number of concurrent tracker connections.
+//
+// Requests waiting for a connection are served by priority: a waiting interactive request
+// is always served before any waiting batch request, so batch jobs can not starve the
+// lookups of the same process. A pool may be shared by multiple clients (eg. one client
+// used by a batch job and one serving interactive traffic), see WithTrackerPool().
+type TrackerPool struct {
+	mutex sync.Mutex
+	// Maximum number of concurrent connections, 0 for no limit
+	max int
+	// Number of connections handed out
+	busy int
+	// Requests waiting for a connection (chan struct{}), one list per priority
+	waiting [priority_count]*list.List
+}
+
+// Returns a new TrackerPool allowing up to max concurrent tracker connections (0 for no limit)
+func NewTrackerPool(max int) *TrackerPool {
+	p := &TrackerPool{max: max}
+	for i := range p.waiting {
+		p.waiting[i] = list.New()
+	}
+	return p
+}
+
+// Uses pool to limit the tracker connections of the client (default: a pool of the client without a limit)
+func WithTrackerPool(pool *TrackerPool) Option {
+	return func(m *MogileFsClient) {
+		m.pool = pool
+	}
+}
+
+// Sets the priority of requests which do not specify one using ContextWithPriority() (default: PriorityInteractive)
+func WithRequestPriority(priority Priority) Option {
+	return func(m *MogileFsClient) {
+		m.priority = priority
+	}
+}
+
+type priorityKey struct{}
+
+// Returns a copy of ctx which makes requests issued with it use the given priority
+func ContextWithPriority(ctx context.Context, priority Priority) context.Context {
+	return context.WithValue(ctx, priorityKey{}, priority)
+}
+
+/**
+ * @desc Returns the priority of a request issued with ctx
+ */
+func (m *MogileFsClient) requestPriority(ctx context.Context) Priority {
+	if p, ok := ctx.Value(priorityKey{}).(Priority); ok && p >= 0 && p < priority_count {
+		return p
+	}
+	return m.priority
+}
+
+/**
+ * @desc Waits until a connection may be opened
+ * @param ctx context.Context aborts waiting if done
+ * @param priority Priority the priority of the request
+ * @return err error ctx.Err() if ctx was done before a connection was available
+ */
+func (p *TrackerPool) acquire(ctx context.Context, priority Priority) (err error) {
+	p.mutex.Lock()
+	if p.max <= 0 || (p.busy < p.max && !p.hasWaiting(priority)) {
+		p.busy++
+		p.mutex.Unlock()
+		return
+	}
+	ready := make(chan struct{})
+	elem := p.waiting[priority].PushBack(ready)
+	p.mutex.Unlock()
+
+	select {
+	case <-ready:
+	case <-ctx.Done():
+		p.mutex.Lock()
+		select {
+		case <-ready:
+			// got the connection while giving up: hand it to the next one
+			p.mutex.Unlock()
+			p.release()
+		default:
+			p.waiting[priority].Remove(elem)
+			p.mutex.Unlock()
+		}
+		err = ctx.Err()
+	}
+	return
+}
+
+/**
+ * @desc Returns a connection acquired by acquire(), handing it to the waiting request of the highest priority
+ */
+func (p *TrackerPool) release() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	for _, waiting := range p.waiting {
+		if front := waiting.Front(); front != nil {
+			// the connection is passed on: busy stays the same
+			waiting.Remove(front)
+			close(front.Value.(chan struct{}))
+			return
+		}
+	}
+	p.busy--
+}
+
+/**
+ * @desc Returns true if a request of the same or a higher priority is waiting
+ */
+func (p *TrackerPool) hasWaiting(priority Priority) bool {
+	for i := Priority(0); i <= priority; i++ {
+		if p.waiting[i].Len() > 0 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,109 @@
+/*
+
+Copyright 2015 Adrian Ulrich
+Copyright 2015 Fixxpunkt AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package mogilefs
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Result of probing a single storage device, returned by ProbeStorage()
+type DeviceProbe struct {
+	// The probed device and its host
+	Devid  int
+	Hostid int
+	// The storage node of the device ('ip:port')
+	Host string
+	// The probed URL, the usage file of the device
+	URL string
+	// True if the usage file could be read
+	Reachable bool
+	// Time the probe took
+	Latency time.Duration
+	// Why the device could not be reached - nil if Reachable
+	Err error
+}
+
+// Checks that the storage nodes serve each device (except dead ones).
+//
+// The devices and hosts are taken from the trackers, then the usage file of each device
+// ('http://ip:port/devN/usage', written by mogstored) is requested using a HEAD request.
+// Up to 16 devices are probed at the same time, ctx limits the time spent on the probes.
+// The results are sorted by devid.
+func (m *MogileFsClient) ProbeStorage(ctx context.Context) (probes []DeviceProbe, err error) {
+	hosts, err := m.GetHosts()
+	if err != nil {
+		return
+	}
+	devices, err := m.GetDevices()
+	if err != nil {
+		return
+	}
+
+	host_by_id := make(map[int]Host)
+	for _, host := range hosts {
+		host_by_id[host.Hostid] = host
+	}
+
+	for _, dev := range devices {
+		host, found := host_by_id[dev.Hostid]
+		if dev.Status == "dead" || (found && host.Status == "dead") {
+			continue
+		}
+		probe := DeviceProbe{Devid: dev.Devid, Hostid: dev.Hostid}
+		if found {
+			port := host.Port
+			if host.GetPort > 0 {
+				port = host.GetPort
+			}
+			probe.Host = net.JoinHostPort(host.Ip, strconv.Itoa(port))
+			probe.URL = fmt.Sprintf("http://%s/dev%d/usage", probe.Host, dev.Devid)
+		} else {
+			probe.Err = fmt.Errorf("internal:unknown host %d", dev.Hostid)
+		}
+		probes = append(probes, probe)
+	}
+	sort.Slice(probes, func(i, j int) bool {
+		return probes[i].Devid < probes[j].Devid
+	})
+
+	slots := make(chan struct{}, 16)
+	var wg sync.WaitGroup
+	for i := range probes {
+		if probes[i].Err != nil {
+			continue
+		}
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(probe *DeviceProbe) {
+			defer wg.Done()
+			started := time.Now()
+			_, probe.Err = m.headPath(ctx, probe.URL)
+			probe.Latency = time.Since(started)
+			probe.Reachable = probe.Err == nil
+			<-slots
+		}(&probes[i])
+	}
+	wg.Wait()
+	return
+}
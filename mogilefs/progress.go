@@ -0,0 +1,60 @@
+/*
+
+Copyright 2015 Adrian Ulrich
+Copyright 2015 Fixxpunkt AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package mogilefs
+
+import (
+	"io"
+)
+
+// Receives the progress of a transfer, see CreateOpts.Progress and FetchOpts.Progress.
+//
+// transferred is the number of bytes moved so far and total the size of the transfer,
+// -1 if unknown. Returning an error aborts the transfer with this error, eg. to enforce
+// a byte budget.
+type ProgressFunc func(transferred int64, total int64) error
+
+// Reports the bytes read from r to a ProgressFunc
+type progressReader struct {
+	r        io.Reader
+	progress ProgressFunc
+	total    int64
+	nbytes   int64
+	// the error returned by progress, which aborted the transfer
+	aborted error
+}
+
+func (pr *progressReader) Read(buffer []byte) (nr int, err error) {
+	if pr.aborted != nil {
+		return 0, pr.aborted
+	}
+	nr, err = pr.r.Read(buffer)
+	if nr > 0 || err == io.EOF {
+		pr.nbytes += int64(nr)
+		if perr := pr.progress(pr.nbytes, pr.total); perr != nil {
+			pr.aborted = perr
+			err = perr
+		}
+	}
+	return
+}
+
+// A ReadCloser reporting its progress
+type progressReadCloser struct {
+	progressReader
+	io.Closer
+}
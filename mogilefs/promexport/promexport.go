@@ -0,0 +1,193 @@
+/*
+
+Copyright 2015 Adrian Ulrich
+Copyright 2015 Fixxpunkt AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+/*
+Package promexport exports the metrics of MogileFS clients in the Prometheus text format.
+
+Example:
+
+	collector := promexport.NewCollector()
+	mc := mogilefs.New(domain, trackers, mogilefs.WithMetrics(collector))
+	collector.WatchBlacklist(mc)
+	http.Handle("/metrics", collector)
+
+Exported metrics:
+
+	mogilefs_client_commands_total{command,outcome}         tracker commands by outcome
+	mogilefs_client_command_duration_seconds{command}       histogram of the tracker latency
+	mogilefs_client_storage_bytes_total{direction}          bytes uploaded to or downloaded from storage nodes
+	mogilefs_client_blacklisted_trackers                    number of blacklisted trackers
+*/
+package promexport
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/adrian-bl/golang-mogilefs-client/mogilefs"
+)
+
+// The default buckets of the latency histogram, in seconds
+var DefaultBuckets = []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Collects metrics of one or more clients, implements mogilefs.MetricsCollector and http.Handler
+type Collector struct {
+	mutex sync.Mutex
+	// upper bounds of the histogram buckets, in seconds
+	buckets []float64
+	// number of commands, by command and outcome
+	commands map[commandKey]uint64
+	// latency histogram of each command
+	latency map[string]*histogram
+	// bytes transferred, by direction
+	bytes map[string]int64
+	// clients whose blacklist is exported
+	clients []*mogilefs.MogileFsClient
+}
+
+type commandKey struct {
+	command string
+	outcome string
+}
+
+type histogram struct {
+	// number of observations <= each bucket, not cumulative
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// Returns a new collector using DefaultBuckets
+func NewCollector() *Collector {
+	return NewCollectorWithBuckets(DefaultBuckets)
+}
+
+// Returns a new collector using the given (sorted) upper bounds of the latency histogram, in seconds
+func NewCollectorWithBuckets(buckets []float64) *Collector {
+	return &Collector{
+		buckets:  buckets,
+		commands: make(map[commandKey]uint64),
+		latency:  make(map[string]*histogram),
+		bytes:    make(map[string]int64),
+	}
+}
+
+// Exports the number of trackers blacklisted by mc
+func (c *Collector) WatchBlacklist(mc *mogilefs.MogileFsClient) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.clients = append(c.clients, mc)
+}
+
+// Implements mogilefs.MetricsCollector
+func (c *Collector) ObserveCommand(command string, outcome string, duration time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.commands[commandKey{command: command, outcome: outcome}]++
+	h := c.latency[command]
+	if h == nil {
+		h = &histogram{counts: make([]uint64, len(c.buckets))}
+		c.latency[command] = h
+	}
+	seconds := duration.Seconds()
+	if i := sort.SearchFloat64s(c.buckets, seconds); i < len(c.buckets) {
+		h.counts[i]++
+	}
+	h.count++
+	h.sum += seconds
+}
+
+// Implements mogilefs.MetricsCollector
+func (c *Collector) AddBytes(direction string, n int64) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.bytes[direction] += n
+}
+
+// Writes all metrics in the Prometheus text format to w
+func (c *Collector) WriteTo(w io.Writer) (n int64, err error) {
+	c.mutex.Lock()
+	clients := c.clients
+	buf := &bytes.Buffer{}
+
+	fmt.Fprintf(buf, "# HELP mogilefs_client_commands_total Tracker commands by outcome\n# TYPE mogilefs_client_commands_total counter\n")
+	keys := make([]commandKey, 0, len(c.commands))
+	for k := range c.commands {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].command != keys[j].command {
+			return keys[i].command < keys[j].command
+		}
+		return keys[i].outcome < keys[j].outcome
+	})
+	for _, k := range keys {
+		fmt.Fprintf(buf, "mogilefs_client_commands_total{command=%q,outcome=%q} %d\n", k.command, k.outcome, c.commands[k])
+	}
+
+	fmt.Fprintf(buf, "# HELP mogilefs_client_command_duration_seconds Latency of tracker commands\n# TYPE mogilefs_client_command_duration_seconds histogram\n")
+	commands := make([]string, 0, len(c.latency))
+	for command := range c.latency {
+		commands = append(commands, command)
+	}
+	sort.Strings(commands)
+	for _, command := range commands {
+		h := c.latency[command]
+		cumulative := uint64(0)
+		for i, le := range c.buckets {
+			cumulative += h.counts[i]
+			fmt.Fprintf(buf, "mogilefs_client_command_duration_seconds_bucket{command=%q,le=%q} %d\n", command, formatFloat(le), cumulative)
+		}
+		fmt.Fprintf(buf, "mogilefs_client_command_duration_seconds_bucket{command=%q,le=\"+Inf\"} %d\n", command, h.count)
+		fmt.Fprintf(buf, "mogilefs_client_command_duration_seconds_sum{command=%q} %s\n", command, formatFloat(h.sum))
+		fmt.Fprintf(buf, "mogilefs_client_command_duration_seconds_count{command=%q} %d\n", command, h.count)
+	}
+
+	fmt.Fprintf(buf, "# HELP mogilefs_client_storage_bytes_total Bytes transferred from or to storage nodes\n# TYPE mogilefs_client_storage_bytes_total counter\n")
+	for _, direction := range []string{mogilefs.DirectionDownload, mogilefs.DirectionUpload} {
+		fmt.Fprintf(buf, "mogilefs_client_storage_bytes_total{direction=%q} %d\n", direction, c.bytes[direction])
+	}
+	c.mutex.Unlock()
+
+	// BlacklistStatus takes locks of its own: query it without holding ours
+	if len(clients) > 0 {
+		blacklisted := 0
+		for _, mc := range clients {
+			blacklisted += len(mc.BlacklistStatus())
+		}
+		fmt.Fprintf(buf, "# HELP mogilefs_client_blacklisted_trackers Number of blacklisted trackers\n# TYPE mogilefs_client_blacklisted_trackers gauge\n")
+		fmt.Fprintf(buf, "mogilefs_client_blacklisted_trackers %d\n", blacklisted)
+	}
+	return buf.WriteTo(w)
+}
+
+// Serves the metrics in the Prometheus text format
+func (c *Collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	c.WriteTo(w)
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
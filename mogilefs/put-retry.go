@@ -0,0 +1,92 @@
+/*
+
+Copyright 2015 Adrian Ulrich
+Copyright 2015 Fixxpunkt AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package mogilefs
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Upper limit of a delay requested by the Retry-After header of a storage node
+const max_retry_after = time.Duration(30) * time.Second
+
+// Sets how often an upload is attempted on a storage node answering with a 5xx status (default: 1).
+//
+// The delay between the attempts follows WithRetryBackoff, unless the storage node asks for
+// a delay with a Retry-After header (honored up to 30 seconds). Once all attempts failed,
+// the next destination returned by the tracker is tried. Uploads are only retried if the
+// data can be sent again, ie. if the reader implements io.Seeker or no data was consumed.
+func WithStorageRetries(attempts int) Option {
+	return func(m *MogileFsClient) {
+		m.put_attempts = attempts
+	}
+}
+
+/**
+ * @desc Decides if an upload failing with err is attempted again on the same storage node
+ * @param attempt int the number of the attempt which just failed, starting at 1
+ * @return delay time.Duration the delay before the next attempt
+ * @return retry bool true if the upload should be retried
+ */
+func (m *MogileFsClient) putRetry(err error, attempt int) (delay time.Duration, retry bool) {
+	var serr *StorageError
+	if attempt >= m.put_attempts || !errors.As(err, &serr) || serr.StatusCode < 500 {
+		return
+	}
+	delay, retry = m.retryBackoff(attempt), true
+	if serr.RetryAfter > 0 {
+		delay = min(serr.RetryAfter, max_retry_after)
+	}
+	return
+}
+
+/**
+ * @desc Parses the value of a Retry-After header: a number of seconds or an HTTP date
+ * @return delay time.Duration the requested delay, 0 if none or invalid
+ */
+func parseRetryAfter(value string) (delay time.Duration) {
+	if len(value) == 0 {
+		return
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds > 0 {
+			delay = time.Duration(seconds) * time.Second
+		}
+	} else if date, err := http.ParseTime(value); err == nil {
+		delay = max(time.Until(date), 0)
+	}
+	return
+}
+
+/**
+ * @desc Waits for delay
+ * @return err error the error of ctx if it is done before
+ */
+func sleepContext(ctx context.Context, delay time.Duration) (err error) {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	return
+}
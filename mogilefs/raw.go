@@ -0,0 +1,50 @@
+/*
+
+Copyright 2015 Adrian Ulrich
+Copyright 2015 Fixxpunkt AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package mogilefs
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+)
+
+// Sends any command to a tracker, eg. commands added by tracker plugins or test commands
+// such as 'sleep':
+//
+//	values, err := mc.RawCommand(ctx, "sleep", url.Values{"duration": {"2"}})
+//
+// Unlike the other functions of the client, RawCommand sends args as-is: the domain of the
+// client is not added (set 'domain' yourself if the command needs it) and keys are not
+// encoded (see WithKeyEncoding). The only argument added is the identity of the client
+// (see SetClientId).
+//
+// The command is sent to the first working tracker. If the tracker fails before the command
+// was sent, the next tracker is tried; custom commands are never sent twice. An 'ERR' reply
+// is returned as *TrackerError, an 'OK' reply as values. Custom commands are passed to the
+// audit hook (see WithAuditHook).
+func (m *MogileFsClient) RawCommand(ctx context.Context, command string, args url.Values) (values url.Values, err error) {
+	if len(command) == 0 || strings.ContainsAny(command, " \t\r\n") {
+		err = errors.New("internal:invalid command name")
+		return
+	}
+	if args == nil {
+		args = make(url.Values)
+	}
+	return m.DoRequestContext(ctx, command, args)
+}
@@ -0,0 +1,74 @@
+/*
+
+Copyright 2015 Adrian Ulrich
+Copyright 2015 Fixxpunkt AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package mogilefs
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// Restrictions of redirects followed by storage requests, see WithStorageRedirects()
+type redirectPolicy struct {
+	// Maximum number of redirects to follow
+	max int
+	// Hosts ('host' or 'host:port') redirects may point to, empty to allow any host
+	allowed map[string]bool
+}
+
+// Limits the redirects followed by requests to storage nodes (default: up to 10 redirects to any host).
+//
+// At most max redirects are followed (pass 0 to refuse all redirects). If allowedHosts is
+// not empty, redirects must point to the storage node of the original request or to one of
+// allowedHosts, given as 'host' (any port) or 'host:port'. Other redirects fail the request.
+//
+// The http.Client passed to WithHTTPClient is not modified: the client uses a copy of it.
+func WithStorageRedirects(max int, allowedHosts ...string) Option {
+	return func(m *MogileFsClient) {
+		m.redirect_policy = &redirectPolicy{max: max, allowed: make(map[string]bool)}
+		for _, host := range allowedHosts {
+			m.redirect_policy.allowed[host] = true
+		}
+	}
+}
+
+/**
+ * @desc Implements http.Client.CheckRedirect
+ * @param req *http.Request the request of the redirect
+ * @param via []*http.Request the requests made so far, oldest first
+ */
+func (p *redirectPolicy) check(req *http.Request, via []*http.Request) error {
+	if len(via) > p.max {
+		return fmt.Errorf("internal:storage node exceeded %d redirects", p.max)
+	}
+	if len(p.allowed) > 0 && req.URL.Host != via[0].URL.Host && !p.allowed[req.URL.Host] && !p.allowed[req.URL.Hostname()] {
+		return fmt.Errorf("internal:storage node redirected to disallowed host %s", req.URL.Host)
+	}
+	return nil
+}
+
+/**
+ * @desc Makes the http client of m obey the redirect policy, using a copy of the client
+ */
+func (m *MogileFsClient) applyRedirectPolicy() {
+	if m.redirect_policy == nil {
+		return
+	}
+	client := *m.http_client
+	client.CheckRedirect = m.redirect_policy.check
+	m.http_client = &client
+}
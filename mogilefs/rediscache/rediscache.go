@@ -0,0 +1,199 @@
+/*
+
+Copyright 2015 Adrian Ulrich
+Copyright 2015 Fixxpunkt AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+/*
+Package rediscache implements a mogilefs.PathCache stored in Redis.
+
+Example:
+
+	cache := rediscache.New("localhost:6379", nil)
+	mc := mogilefs.New(domain, trackers, mogilefs.WithSharedPathCache(cache, time.Minute))
+*/
+package rediscache
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Optional argument to New()
+type Options struct {
+	// Prepended to all keys (default: 'mogfs:')
+	Prefix string
+	// Password sent using AUTH, an empty string for none
+	Password string
+	// Database selected using SELECT (default: 0)
+	DB int
+	// Timeout of connecting and of each command (default: 100 milliseconds)
+	Timeout time.Duration
+	// Number of idle connections kept (default: 4)
+	MaxIdle int
+}
+
+// A mogilefs.PathCache stored in Redis, see New().
+//
+// Failures of the Redis server are treated as cache misses.
+type Cache struct {
+	addr string
+	opts Options
+	idle chan net.Conn
+}
+
+// A connection to the Redis server
+type conn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+// Returns a cache stored on the Redis server at addr ('host:port'), opts may be nil
+func New(addr string, opts *Options) *Cache {
+	c := &Cache{addr: addr}
+	if opts != nil {
+		c.opts = *opts
+	}
+	if len(c.opts.Prefix) == 0 {
+		c.opts.Prefix = "mogfs:"
+	}
+	if c.opts.Timeout <= 0 {
+		c.opts.Timeout = time.Duration(100) * time.Millisecond
+	}
+	if c.opts.MaxIdle <= 0 {
+		c.opts.MaxIdle = 4
+	}
+	c.idle = make(chan net.Conn, c.opts.MaxIdle)
+	return c
+}
+
+// Implements mogilefs.PathCache
+func (c *Cache) Get(key string) (paths []string, ok bool) {
+	reply, err := c.command("GET", c.opts.Prefix+key)
+	if data, is_string := reply.(string); err == nil && is_string && len(data) > 0 {
+		paths, ok = strings.Split(data, "\n"), true
+	}
+	return
+}
+
+// Implements mogilefs.PathCache
+func (c *Cache) Set(key string, paths []string, ttl time.Duration) {
+	c.command("SET", c.opts.Prefix+key, strings.Join(paths, "\n"), "PX", strconv.FormatInt(ttl.Milliseconds(), 10))
+}
+
+// Implements mogilefs.PathCache
+func (c *Cache) Delete(key string) {
+	c.command("DEL", c.opts.Prefix+key)
+}
+
+/**
+ * @desc Sends a command and returns its reply: a string, an int64 or nil for a null reply
+ */
+func (c *Cache) command(args ...string) (reply interface{}, err error) {
+	var cn *conn
+	select {
+	case idle := <-c.idle:
+		cn = idle.(*conn)
+	default:
+		if cn, err = c.dial(); err != nil {
+			return
+		}
+	}
+
+	cn.SetDeadline(time.Now().Add(c.opts.Timeout))
+	if reply, err = cn.do(args...); err != nil {
+		// the state of the connection is unknown
+		cn.Close()
+		return
+	}
+	select {
+	case c.idle <- cn:
+	default:
+		cn.Close()
+	}
+	return
+}
+
+/**
+ * @desc Opens a new connection, authenticating and selecting the database if configured
+ */
+func (c *Cache) dial() (cn *conn, err error) {
+	nc, err := net.DialTimeout("tcp", c.addr, c.opts.Timeout)
+	if err != nil {
+		return
+	}
+	cn = &conn{Conn: nc, r: bufio.NewReader(nc)}
+	cn.SetDeadline(time.Now().Add(c.opts.Timeout))
+	if len(c.opts.Password) > 0 {
+		_, err = cn.do("AUTH", c.opts.Password)
+	}
+	if err == nil && c.opts.DB != 0 {
+		_, err = cn.do("SELECT", strconv.Itoa(c.opts.DB))
+	}
+	if err != nil {
+		cn.Close()
+		cn = nil
+	}
+	return
+}
+
+/**
+ * @desc Sends a command using the RESP protocol and reads its reply
+ */
+func (cn *conn) do(args ...string) (reply interface{}, err error) {
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&buf, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err = io.WriteString(cn, buf.String()); err != nil {
+		return
+	}
+
+	line, err := cn.r.ReadString('\n')
+	if err != nil {
+		return
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if len(line) == 0 {
+		return nil, errors.New("empty reply")
+	}
+
+	switch line[0] {
+	case '+':
+		reply = line[1:]
+	case '-':
+		err = errors.New(line[1:])
+	case ':':
+		reply, err = strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		size, perr := strconv.Atoi(line[1:])
+		if err = perr; err != nil || size < 0 {
+			return
+		}
+		data := make([]byte, size+2)
+		if _, err = io.ReadFull(cn.r, data); err == nil {
+			reply = string(data[:size])
+		}
+	default:
+		err = fmt.Errorf("unsupported reply: %q", line)
+	}
+	return
+}
@@ -0,0 +1,80 @@
+/*
+
+Copyright 2015 Adrian Ulrich
+Copyright 2015 Fixxpunkt AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package mogilefs
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A single rename performed by RenamePrefix
+type RenameEntry struct {
+	From string
+	To   string
+}
+
+// The journal of completed renames, as returned by RenamePrefix
+type RenameJournal struct {
+	// Completed renames, oldest first
+	Renames []RenameEntry
+}
+
+// Renames all keys starting with oldPrefix so that they start with newPrefix.
+//
+// Every completed rename is recorded in the returned journal. If a rename fails, all
+// renames done so far are rolled back and the error is returned: the journal then holds
+// the renames that could not be rolled back (if any), which may be retried by passing it
+// to RollbackRenames.
+func (m *MogileFsClient) RenamePrefix(oldPrefix string, newPrefix string) (journal *RenameJournal, err error) {
+	journal = &RenameJournal{}
+	if err = m.checkPrefix(oldPrefix); err != nil {
+		return
+	}
+
+	// list everything first: renaming while listing would move keys under our cursor
+	keys, err := m.ListAllKeys(oldPrefix)
+
+	for _, key := range keys {
+		if err != nil {
+			break
+		}
+		newname := newPrefix + strings.TrimPrefix(key, oldPrefix)
+		err = m.Rename(key, newname)
+		if err == nil {
+			journal.Renames = append(journal.Renames, RenameEntry{From: key, To: newname})
+		} else if rberr := m.RollbackRenames(journal); rberr != nil {
+			err = fmt.Errorf("%s (rollback failed: %s)", err, rberr)
+		}
+	}
+	return
+}
+
+// Reverts the renames recorded in journal, newest first.
+//
+// Successfully reverted renames are removed from the journal, so a failed rollback
+// may be resumed by calling this function again.
+func (m *MogileFsClient) RollbackRenames(journal *RenameJournal) (err error) {
+	for len(journal.Renames) > 0 && err == nil {
+		last := journal.Renames[len(journal.Renames)-1]
+		err = m.Rename(last.To, last.From)
+		if err == nil {
+			journal.Renames = journal.Renames[:len(journal.Renames)-1]
+		}
+	}
+	return
+}
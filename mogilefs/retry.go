@@ -0,0 +1,83 @@
+/*
+
+Copyright 2015 Adrian Ulrich
+Copyright 2015 Fixxpunkt AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package mogilefs
+
+import (
+	"math/rand"
+	"time"
+)
+
+// Commands which may be sent to another tracker if the reply got lost
+var idempotent_commands = map[string]bool{
+	cmd_getpaths:    true,
+	cmd_debug:       true,
+	cmd_list_keys:   true,
+	cmd_get_domains: true,
+	cmd_get_hosts:   true,
+	cmd_get_devices: true,
+	cmd_updateclass: true,
+	cmd_file_info:   true,
+	cmd_stats:       true,
+	cmd_noop:        true,
+}
+
+// Sets how often a tracker command is attempted if trackers fail (default: 3).
+//
+// Commands are only retried if they did not reach a tracker or if executing them
+// twice does no harm. Tracker errors (such as 'unknown_key') are never retried.
+func WithRetries(attempts int) Option {
+	return func(m *MogileFsClient) {
+		m.retry_attempts = attempts
+	}
+}
+
+// Sets the delay before the first retry and the upper limit of the delay (default: 50ms and 1s).
+//
+// The delay doubles with each retry, a random jitter is applied to each delay.
+func WithRetryBackoff(base time.Duration, max time.Duration) Option {
+	return func(m *MogileFsClient) {
+		m.retry_backoff_base = base
+		m.retry_backoff_max = max
+	}
+}
+
+/**
+ * @desc Returns true if command may be executed twice
+ */
+func isIdempotent(command string) bool {
+	return idempotent_commands[command]
+}
+
+/**
+ * @desc Returns the delay before the next attempt
+ * @param attempt int the number of the attempt which just failed, starting at 1
+ */
+func (m *MogileFsClient) retryBackoff(attempt int) time.Duration {
+	backoff := m.retry_backoff_base
+	for i := 1; i < attempt && backoff < m.retry_backoff_max; i++ {
+		backoff *= 2
+	}
+	if backoff > m.retry_backoff_max {
+		backoff = m.retry_backoff_max
+	}
+	if backoff <= 0 {
+		return 0
+	}
+	// 'equal jitter': wait at least half of the backoff
+	return backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+}
@@ -0,0 +1,115 @@
+/*
+
+Copyright 2015 Adrian Ulrich
+Copyright 2015 Fixxpunkt AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package mogilefs
+
+import (
+	"context"
+	"sync"
+)
+
+// Tracks the transfers of a client, see Close()
+type lifecycle struct {
+	mutex sync.Mutex
+	// set by Close(): no new transfers are started
+	closed bool
+	// number of running transfers
+	active int
+	// closed once the client is closed and all transfers finished
+	drained chan struct{}
+	// context of all transfers, canceled to abort them
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func newLifecycle() *lifecycle {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &lifecycle{drained: make(chan struct{}), ctx: ctx, cancel: cancel}
+}
+
+// Shuts down the client.
+//
+// New uploads and downloads are refused with ErrClientClosed once Close was called,
+// while running transfers may finish (a download finishes once its reader is closed).
+// Tracker commands are accepted until all transfers finished, so running uploads can
+// complete. If ctx expires before, all remaining transfers are aborted and ctx.Err() is
+// returned. The client of the standby cluster (see WithStandby) is closed as well.
+func (m *MogileFsClient) Close(ctx context.Context) (err error) {
+	l := m.lifecycle
+	l.mutex.Lock()
+	if !l.closed {
+		l.closed = true
+		if l.active == 0 {
+			close(l.drained)
+		}
+	}
+	l.mutex.Unlock()
+
+	select {
+	case <-l.drained:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	l.cancel()
+
+	if m.failover != nil {
+		if serr := m.failover.standby.Close(ctx); err == nil {
+			err = serr
+		}
+	}
+	return
+}
+
+/**
+ * @desc Registers a new transfer, returns ErrClientClosed if the client is closed
+ */
+func (l *lifecycle) begin() (err error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.closed {
+		err = ErrClientClosed
+	} else {
+		l.active++
+	}
+	return
+}
+
+/**
+ * @desc Unregisters a transfer registered by begin()
+ */
+func (l *lifecycle) end() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.active--
+	if l.closed && l.active == 0 {
+		close(l.drained)
+	}
+}
+
+/**
+ * @desc Returns true if the client is closed and all transfers finished
+ */
+func (l *lifecycle) isDrained() bool {
+	select {
+	case <-l.drained:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,71 @@
+/*
+
+Copyright 2015 Adrian Ulrich
+Copyright 2015 Fixxpunkt AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package mogilefs
+
+import (
+	"context"
+	"sync"
+)
+
+// Collapses concurrent calls with the same key into a single execution
+type flightGroup struct {
+	mutex sync.Mutex
+	calls map[string]*flightCall
+}
+
+type flightCall struct {
+	// closed once value and err are set
+	done  chan struct{}
+	value interface{}
+	err   error
+}
+
+/**
+ * @desc Executes fn, unless a call with the same key is in flight: waits for its result in this case
+ * @param ctx context.Context stops waiting for the result once done, returning a nil value and ctx.Err() - fn keeps running for the other callers
+ * @param key string identifies the call
+ * @param fn func() the function to execute
+ * @return shared bool true if the result was produced by another caller
+ */
+func (g *flightGroup) do(ctx context.Context, key string, fn func() (interface{}, error)) (value interface{}, err error, shared bool) {
+	g.mutex.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*flightCall)
+	}
+	call, shared := g.calls[key]
+	if !shared {
+		call = &flightCall{done: make(chan struct{})}
+		g.calls[key] = call
+		go func() {
+			call.value, call.err = fn()
+
+			g.mutex.Lock()
+			delete(g.calls, key)
+			g.mutex.Unlock()
+			close(call.done)
+		}()
+	}
+	g.mutex.Unlock()
+
+	select {
+	case <-call.done:
+		return call.value, call.err, shared
+	case <-ctx.Done():
+		return nil, ctx.Err(), shared
+	}
+}
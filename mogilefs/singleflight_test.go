@@ -0,0 +1,52 @@
+/*
+
+Copyright 2015 Adrian Ulrich
+Copyright 2015 Fixxpunkt AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package mogilefs
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestFlightOutlivesCallerGivingUp(t *testing.T) {
+	var g flightGroup
+	release := make(chan struct{})
+	fn := func() (interface{}, error) {
+		<-release
+		return "value", nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if value, err, _ := g.do(ctx, "k", fn); value != nil || err != context.Canceled {
+		t.Fatalf("caller giving up got %v, %v", value, err)
+	}
+
+	// the call started by the first caller is still in flight: join it
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		close(release)
+	}()
+	value, err, shared := g.do(context.Background(), "k", func() (interface{}, error) {
+		t.Errorf("second caller started another call")
+		return nil, nil
+	})
+	if value != "value" || err != nil || !shared {
+		t.Errorf("second caller got %v, %v, shared %v", value, err, shared)
+	}
+}
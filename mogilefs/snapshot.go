@@ -0,0 +1,160 @@
+/*
+
+Copyright 2015 Adrian Ulrich
+Copyright 2015 Fixxpunkt AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package mogilefs
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/url"
+	"strings"
+)
+
+// Result of ListKeysSnapshot()
+type KeySnapshot struct {
+	// All keys starting with the prefix, sorted by name
+	Keys []string
+	// True if no fenced mutation of the prefix was in progress or finished while listing
+	Consistent bool
+	// The fence token seen before listing, an empty string if the prefix was never fenced
+	Token string
+}
+
+// Returns the key used to store the fence of prefix, see FencedMutation()
+func FenceKey(prefix string) string {
+	return "_fence:" + prefix
+}
+
+/**
+ * @desc Returns the key marking the fenced mutation token of prefix as in progress
+ */
+func openFenceKey(prefix string, token string) string {
+	return FenceKey(prefix) + "~" + token
+}
+
+// Runs mutate, which creates or deletes keys starting with prefix, fenced for ListKeysSnapshot().
+//
+// Each mutation gets a new random token. While mutate runs, the token is marked as open
+// by its own key, so concurrent mutations of the same prefix do not hide each other.
+// Afterwards (even if mutate fails) the token is stored as the fence (key FenceKey(prefix))
+// before the open marker is removed.
+func (m *MogileFsClient) FencedMutation(prefix string, mutate func() error) (err error) {
+	raw := make([]byte, 16)
+	if _, err = io.ReadFull(rand.Reader, raw); err != nil {
+		return
+	}
+	token := hex.EncodeToString(raw)
+	fence := url.Values{"token": {token}, "owner": {m.lockOwner()}}
+	if err = m.StoreBytes(openFenceKey(prefix, token), "", []byte(fence.Encode())); err != nil {
+		return
+	}
+
+	err = mutate()
+
+	// a listing must see either the open marker or the new fence
+	ferr := m.StoreBytes(FenceKey(prefix), "", []byte(fence.Encode()))
+	if ferr == nil {
+		ferr = m.Delete(openFenceKey(prefix, token))
+	}
+	if err == nil {
+		err = ferr
+	}
+	return
+}
+
+// Lists all keys starting with prefix and reports whether the listing is consistent.
+//
+// The fence of prefix and the open fenced mutations are read before and after listing: the
+// listing is consistent if the fence did not change and no mutation was open, ie. no fenced
+// mutation (see FencedMutation) was in progress or finished meanwhile. This only detects
+// mutations of writers using FencedMutation; callers needing a consistent view (eg. billing
+// exports) should retry inconsistent listings. The fence keys are not part of the listed keys.
+func (m *MogileFsClient) ListKeysSnapshot(prefix string) (snap KeySnapshot, err error) {
+	before, err := m.readFence(prefix)
+	if err != nil {
+		return
+	}
+	open, err := m.openFences(prefix)
+	if err != nil {
+		return
+	}
+
+	keys, err := m.ListAllKeys(prefix)
+	if err != nil {
+		return
+	}
+	for _, key := range keys {
+		if key != FenceKey(prefix) && !isOpenFenceKey(prefix, key) {
+			snap.Keys = append(snap.Keys, key)
+		}
+	}
+
+	// in reverse order: a mutation finishing meanwhile has already replaced the fence
+	// when its open marker disappears
+	openAfter, err := m.openFences(prefix)
+	if err != nil {
+		return
+	}
+	after, err := m.readFence(prefix)
+	if err != nil {
+		return
+	}
+	snap.Token = before.Get("token")
+	snap.Consistent = before.Encode() == after.Encode() && open == 0 && openAfter == 0
+	return
+}
+
+/**
+ * @desc Returns the fence of prefix, empty values if it does not exist
+ */
+func (m *MogileFsClient) readFence(prefix string) (fence url.Values, err error) {
+	data, err := m.FetchBytes(FenceKey(prefix))
+	if errors.Is(err, ErrUnknownKey) {
+		return url.Values{}, nil
+	}
+	if err == nil {
+		fence, err = url.ParseQuery(string(data))
+	}
+	return
+}
+
+/**
+ * @desc Returns the number of fenced mutations of prefix in progress
+ */
+func (m *MogileFsClient) openFences(prefix string) (open int, err error) {
+	keys, err := m.ListAllKeys(FenceKey(prefix) + "~")
+	for _, key := range keys {
+		if isOpenFenceKey(prefix, key) {
+			open++
+		}
+	}
+	return
+}
+
+/**
+ * @desc Returns true if key marks a fenced mutation of prefix as in progress (and not eg. one of the prefix 'prefix~')
+ */
+func isOpenFenceKey(prefix string, key string) bool {
+	token := strings.TrimPrefix(key, FenceKey(prefix)+"~")
+	if len(token) != 32 || len(token) == len(key) {
+		return false
+	}
+	_, err := hex.DecodeString(token)
+	return err == nil
+}
@@ -0,0 +1,77 @@
+/*
+
+Copyright 2015 Adrian Ulrich
+Copyright 2015 Fixxpunkt AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package mogilefs_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/adrian-bl/golang-mogilefs-client/mogilefs"
+)
+
+/**
+ * @desc Lists prefix and fails the test if the listing is not reported as expected by consistent
+ */
+func checkSnapshot(t *testing.T, mc *mogilefs.MogileFsClient, prefix string, consistent bool) mogilefs.KeySnapshot {
+	t.Helper()
+	snap, err := mc.ListKeysSnapshot(prefix)
+	if err != nil {
+		t.Fatalf("listing %q: %v", prefix, err)
+	}
+	if snap.Consistent != consistent {
+		t.Errorf("listing %q: consistent = %v, want %v", prefix, snap.Consistent, consistent)
+	}
+	return snap
+}
+
+func TestFencedMutation(t *testing.T) {
+	mc, _ := newTestClient(t)
+	checkSnapshot(t, mc, "", true)
+
+	err := mc.FencedMutation("", func() error {
+		checkSnapshot(t, mc, "", false)
+		_, err := mc.Create("a", "", strings.NewReader("a"))
+		return err
+	})
+	if err != nil {
+		t.Fatalf("mutating: %v", err)
+	}
+
+	snap := checkSnapshot(t, mc, "", true)
+	if !reflect.DeepEqual(snap.Keys, []string{"a"}) || len(snap.Token) == 0 {
+		t.Errorf("snapshot = %+v, want key 'a' only and a token", snap)
+	}
+}
+
+func TestConcurrentFencedMutations(t *testing.T) {
+	mc, _ := newTestClient(t)
+
+	err := mc.FencedMutation("p/", func() error {
+		// a second mutation finishing first must not close the fence of the first one
+		if err := mc.FencedMutation("p/", func() error { return nil }); err != nil {
+			return err
+		}
+		checkSnapshot(t, mc, "p/", false)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("mutating: %v", err)
+	}
+	checkSnapshot(t, mc, "p/", true)
+}
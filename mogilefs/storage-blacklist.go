@@ -0,0 +1,155 @@
+/*
+
+Copyright 2015 Adrian Ulrich
+Copyright 2015 Fixxpunkt AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package mogilefs
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Storage nodes which failed repeatedly, see WithStorageBlacklist()
+type storageBlacklist struct {
+	*blacklist
+	// Number of consecutive failures which blacklist a storage node
+	threshold int
+	// Protects failures
+	failures_mutex sync.Mutex
+	// Number of consecutive failures of each storage node
+	failures map[string]int
+}
+
+// Avoids storage nodes ('host:port') failing threshold times in a row for duration (default: disabled).
+//
+// Refused connections, timeouts and 5xx replies count as failures, any successful request
+// resets the count. Paths and upload destinations on a blacklisted storage node are tried
+// after all others, so reads and uploads keep working if all copies are on blacklisted
+// nodes. Missing files (404) never blacklist a storage node.
+func WithStorageBlacklist(duration time.Duration, threshold int) Option {
+	return func(m *MogileFsClient) {
+		if m.dead_storage == nil {
+			m.hooks = append(m.hooks, storageBlacklistHooks{m: m})
+		}
+		m.dead_storage = &storageBlacklist{blacklist: newBlacklist(duration), threshold: max(threshold, 1), failures: make(map[string]int)}
+		m.dead_storage.max_entries = 10000
+	}
+}
+
+// Returns the storage nodes currently blacklisted, see WithStorageBlacklist()
+func (m *MogileFsClient) StorageBlacklistStatus() (entries []BlacklistEntry) {
+	if m.dead_storage != nil {
+		entries = m.dead_storage.status()
+	}
+	return
+}
+
+/**
+ * @desc Counts a failure of host, blacklisting it once it reaches the threshold
+ * @return added bool true if host was added to the blacklist
+ */
+func (sb *storageBlacklist) failed(host string) (added bool) {
+	sb.failures_mutex.Lock()
+	sb.failures[host]++
+	reached := sb.failures[host] >= sb.threshold
+	if reached {
+		delete(sb.failures, host)
+	}
+	sb.failures_mutex.Unlock()
+
+	if reached {
+		added = sb.markBad(host)
+	}
+	return
+}
+
+/**
+ * @desc Resets the failures of host and removes it from the blacklist
+ */
+func (sb *storageBlacklist) succeeded(host string) (removed bool) {
+	sb.failures_mutex.Lock()
+	delete(sb.failures, host)
+	sb.failures_mutex.Unlock()
+	return sb.markAlive(host)
+}
+
+/**
+ * @desc Returns true if err indicates a broken storage node rather than a missing file or an aborted request
+ */
+func isStorageFailure(err error) bool {
+	var storage_err *StorageError
+	switch {
+	case err == nil, errors.Is(err, context.Canceled):
+		return false
+	case errors.As(err, &storage_err):
+		return storage_err.StatusCode >= 500
+	}
+	return true
+}
+
+/**
+ * @desc Records the outcome of a request to the storage node of path
+ */
+func (m *MogileFsClient) observeStorage(path string, err error) {
+	host := StorageHost(path)
+	if m.dead_storage == nil || len(host) == 0 {
+		return
+	}
+	if err == nil {
+		if m.dead_storage.succeeded(host) {
+			m.logger.Debug("mogilefs: storage node removed from blacklist", slog.String("host", host))
+		}
+	} else if isStorageFailure(err) && m.dead_storage.failed(host) {
+		m.logger.Debug("mogilefs: storage node blacklisted", slog.String("host", host), slog.Any("error", err))
+	}
+}
+
+/**
+ * @desc Returns true if the storage node of path is blacklisted
+ */
+func (m *MogileFsClient) storageIsBad(path string) bool {
+	return m.dead_storage != nil && m.dead_storage.isBad(StorageHost(path))
+}
+
+/**
+ * @desc Moves the destinations on blacklisted storage nodes to the end, keeping the order otherwise
+ */
+func (m *MogileFsClient) sortDestinations(dests []CreateDestination) {
+	if m.dead_storage != nil {
+		sort.SliceStable(dests, func(i, j int) bool {
+			return !m.storageIsBad(dests[i].Path) && m.storageIsBad(dests[j].Path)
+		})
+	}
+}
+
+// Feeds the outcome of storage requests to the storage blacklist
+type storageBlacklistHooks struct {
+	m *MogileFsClient
+}
+
+func (h storageBlacklistHooks) BeforeRequest(ctx context.Context, info *RequestInfo) context.Context {
+	return ctx
+}
+
+func (h storageBlacklistHooks) AfterRequest(ctx context.Context, info *RequestInfo, duration time.Duration, err error) {
+	if info.Kind == RequestStorage && info.Command != "DELETE" {
+		h.m.observeStorage(info.Path, err)
+	}
+}
@@ -0,0 +1,48 @@
+/*
+
+Copyright 2015 Adrian Ulrich
+Copyright 2015 Fixxpunkt AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package mogilefs
+
+import (
+	"net/http"
+)
+
+// Sets a function to be called with the response of every GET and PUT request sent to a storage node.
+//
+// The hook is called as soon as the response headers were received: the request can be found in
+// resp.Request. The hook must not read or close resp.Body of GET requests, as the body is returned
+// to the caller of Fetch. resp.Trailer is only complete for PUT requests.
+// The hook is only called by the default StorageTransport. Pass nil to remove the hook.
+func (m *MogileFsClient) SetStorageResponseHook(hook func(resp *http.Response)) {
+	m.mutex.Lock()
+	m.storage_hook = hook
+	m.mutex.Unlock()
+}
+
+/**
+ * @desc Passes the response of a storage node to the user supplied hook (if any)
+ * @param resp *http.Response the response to pass on
+ */
+func (m *MogileFsClient) storageResponse(resp *http.Response) {
+	m.mutex.Lock()
+	hook := m.storage_hook
+	m.mutex.Unlock()
+
+	if hook != nil {
+		hook(resp)
+	}
+}
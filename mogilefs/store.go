@@ -0,0 +1,87 @@
+/*
+
+Copyright 2015 Adrian Ulrich
+Copyright 2015 Fixxpunkt AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package mogilefs
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Uploads the contents of the local file at path as key.
+//
+// The size of the file is sent as Content-Length, so the upload does not use chunked transfer encoding.
+func (m *MogileFsClient) StoreFile(key string, class string, path string) (err error) {
+	fh, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer fh.Close()
+
+	fi, err := fh.Stat()
+	if err == nil {
+		_, err = m.CreateWithOpts(key, class, fh, &CreateOpts{Size: fi.Size()})
+	}
+	return
+}
+
+// Uploads data as key
+func (m *MogileFsClient) StoreBytes(key string, class string, data []byte) (err error) {
+	_, err = m.CreateWithOpts(key, class, bytes.NewReader(data), &CreateOpts{Size: int64(len(data))})
+	return
+}
+
+// Returns the contents of key
+func (m *MogileFsClient) FetchBytes(key string) (data []byte, err error) {
+	r, err := m.Fetch(key)
+	if err == nil {
+		data, err = io.ReadAll(r)
+		r.Close()
+	}
+	return
+}
+
+// Writes the contents of key to the local file at path.
+//
+// The data is written to a temporary file next to path first: path is only replaced once
+// the download completed.
+func (m *MogileFsClient) FetchToFile(key string, path string) (err error) {
+	r, err := m.Fetch(key)
+	if err != nil {
+		return
+	}
+	defer r.Close()
+
+	fh, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return
+	}
+
+	_, err = io.Copy(fh, r)
+	if cerr := fh.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(fh.Name(), path)
+	}
+	if err != nil {
+		os.Remove(fh.Name())
+	}
+	return
+}
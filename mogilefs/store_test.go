@@ -0,0 +1,55 @@
+/*
+
+Copyright 2015 Adrian Ulrich
+Copyright 2015 Fixxpunkt AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package mogilefs
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Returns a client of a tracker answering get_paths with the reply named name of trackerReplies
+func newRecordedPathsClient(t *testing.T, name string) *MogileFsClient {
+	t.Helper()
+	for _, tc := range trackerReplies {
+		if tc.name == name {
+			reply := strings.TrimSuffix(tc.reply, "\r\n")
+			return New("test", []string{newCannedTracker(t, map[string]string{cmd_getpaths: reply})})
+		}
+	}
+	t.Fatalf("no reply named %q", name)
+	return nil
+}
+
+func TestFetchWithoutPaths(t *testing.T) {
+	m := newRecordedPathsClient(t, "get_paths of a key without copies")
+
+	if r, err := m.Fetch("k"); r != nil || !errors.Is(err, ErrNoPaths) {
+		t.Errorf("Fetch = %v, %v, want ErrNoPaths", r, err)
+	}
+	if data, err := m.FetchBytes("k"); data != nil || !errors.Is(err, ErrNoPaths) {
+		t.Errorf("FetchBytes = %q, %v, want ErrNoPaths", data, err)
+	}
+	if err := m.FetchToFile("k", filepath.Join(t.TempDir(), "k")); !errors.Is(err, ErrNoPaths) {
+		t.Errorf("FetchToFile = %v, want ErrNoPaths", err)
+	}
+	if _, _, err := m.FetchWithInfo("k"); !errors.Is(err, ErrNoPaths) {
+		t.Errorf("FetchWithInfo = %v, want ErrNoPaths", err)
+	}
+}
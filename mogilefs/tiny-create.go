@@ -0,0 +1,63 @@
+/*
+
+Copyright 2015 Adrian Ulrich
+Copyright 2015 Fixxpunkt AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package mogilefs
+
+import (
+	"bytes"
+	"io"
+)
+
+// Reads uploads of at most size bytes into memory before talking to the tracker (default: 0, disabled).
+//
+// Meant for clusters storing lots of small blobs: a tiny upload is sent with a Content-Length
+// (and its Content-MD5, if the class uses MD5) in a single request, create_close follows right
+// after it, and a failing destination can be retried without rewinding the caller's reader.
+// A slow reader does not keep the destination handed out by the tracker waiting either.
+// Uploads turning out to be larger are streamed as usual.
+func WithTinyObjects(size int64) Option {
+	return func(m *MogileFsClient) {
+		m.tiny_threshold = size
+	}
+}
+
+/**
+ * @desc Reads r into memory if it holds at most m.tiny_threshold bytes
+ * @param size int64 the size of r if known, 0 otherwise
+ * @return rv io.Reader a seekable in-memory copy of a tiny r, a reader returning all of r otherwise
+ */
+func (m *MogileFsClient) bufferTiny(r io.Reader, size int64) (rv io.Reader, err error) {
+	rv = r
+	if m.tiny_threshold <= 0 || size > m.tiny_threshold {
+		return
+	}
+	if _, ok := r.(io.Seeker); ok {
+		// the size of seekable readers is known anyway and they can be rewound
+		return
+	}
+
+	var buf bytes.Buffer
+	n, err := io.CopyN(&buf, r, m.tiny_threshold+1)
+	switch {
+	case err == io.EOF:
+		rv, err = bytes.NewReader(buf.Bytes()), nil
+	case err == nil && n > m.tiny_threshold:
+		// not tiny after all: return what we read so far followed by the rest
+		rv = io.MultiReader(&buf, r)
+	}
+	return
+}
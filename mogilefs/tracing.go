@@ -0,0 +1,110 @@
+/*
+
+Copyright 2015 Adrian Ulrich
+Copyright 2015 Fixxpunkt AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package mogilefs
+
+import (
+	"context"
+	"strconv"
+	"time"
+)
+
+// Creates spans, see WithTracer().
+//
+// The interface is a subset of the OpenTelemetry tracing API, so adapting an OpenTelemetry
+// tracer only takes a few lines:
+//
+//	type otelTracer struct{ t trace.Tracer }
+//
+//	func (o otelTracer) Start(ctx context.Context, name string) (context.Context, mogilefs.Span) {
+//		ctx, span := o.t.Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient))
+//		return ctx, otelSpan{span}
+//	}
+//
+//	type otelSpan struct{ s trace.Span }
+//
+//	func (o otelSpan) SetAttribute(k, v string) { o.s.SetAttributes(attribute.String(k, v)) }
+//	func (o otelSpan) RecordError(err error)    { o.s.RecordError(err); o.s.SetStatus(codes.Error, err.Error()) }
+//	func (o otelSpan) End()                     { o.s.End() }
+//
+//	mc := mogilefs.New(domain, trackers, mogilefs.WithTracer(otelTracer{otel.Tracer("mogilefs")}))
+type Tracer interface {
+	// Starts a span as child of the span in ctx (if any)
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// A span created by a Tracer
+type Span interface {
+	SetAttribute(key string, value string)
+	RecordError(err error)
+	End()
+}
+
+// Creates a span for each tracker command and each transfer from or to a storage node.
+//
+// Tracker spans are named 'mogilefs <command>' and carry the attributes mogilefs.command,
+// mogilefs.domain, mogilefs.key, mogilefs.devid (if part of the command) and
+// mogilefs.tracker. Storage spans are named 'mogilefs storage <method>' and carry
+// http.method, http.url, mogilefs.devid and mogilefs.storage_host.
+func WithTracer(t Tracer) Option {
+	return func(m *MogileFsClient) {
+		m.hooks = append(m.hooks, tracingHooks{t: t})
+	}
+}
+
+type spanContextKey struct{}
+
+// Passes all requests to a Tracer
+type tracingHooks struct {
+	t Tracer
+}
+
+func (h tracingHooks) BeforeRequest(ctx context.Context, info *RequestInfo) context.Context {
+	var span Span
+	if info.Kind == RequestTracker {
+		ctx, span = h.t.Start(ctx, "mogilefs "+info.Command)
+		span.SetAttribute("mogilefs.command", info.Command)
+		for _, name := range []string{"domain", "key", "devid"} {
+			if value := info.Args.Get(name); len(value) > 0 {
+				span.SetAttribute("mogilefs."+name, value)
+			}
+		}
+	} else {
+		ctx, span = h.t.Start(ctx, "mogilefs storage "+info.Command)
+		span.SetAttribute("http.method", info.Command)
+		span.SetAttribute("http.url", info.Path)
+		span.SetAttribute("mogilefs.storage_host", StorageHost(info.Path))
+		if devid := pathDevid(info.Path); devid > 0 {
+			span.SetAttribute("mogilefs.devid", strconv.Itoa(devid))
+		}
+	}
+	return context.WithValue(ctx, spanContextKey{}, span)
+}
+
+func (h tracingHooks) AfterRequest(ctx context.Context, info *RequestInfo, duration time.Duration, err error) {
+	span, ok := ctx.Value(spanContextKey{}).(Span)
+	if !ok {
+		return
+	}
+	if len(info.Tracker) > 0 {
+		span.SetAttribute("mogilefs.tracker", info.Tracker)
+	}
+	if err != nil {
+		span.RecordError(err)
+	}
+	span.End()
+}
@@ -18,39 +18,189 @@ limitations under the License.
 package mogilefs
 
 import (
+	"log/slog"
+	"sort"
+	"sync"
 	"time"
 )
 
-const (
-	blacklist_duration = time.Duration(60) * time.Second
-)
+// A list of misbehaving hosts which should be avoided for a while
+type blacklist struct {
+	mutex sync.Mutex
+	// How long a misbehaving host is avoided
+	duration time.Duration
+	// Maps a host to the time it may be used again
+	dead map[string]time.Time
+	// Maximum number of hosts to remember, 0 for no limit
+	max_entries int
+	// Upper limit of the growing duration of repeat offenders, no growth if <= duration
+	max_duration time.Duration
+	// Number of times each host was blacklisted since it last worked
+	strikes map[string]int
+	// Let a single probe through once the blacklisting of a host ended, instead of restoring it right away
+	half_open bool
+	// Maps hosts being probed to the time the probe was let through
+	probing map[string]time.Time
+}
+
+// State of a blacklisted tracker or storage node, returned by BlacklistStatus() and StorageBlacklistStatus()
+type BlacklistEntry struct {
+	// The tracker or storage node
+	Host string
+	// When the tracker will be tried again
+	Until time.Time
+	// Number of times the tracker was blacklisted since it last worked
+	Strikes int
+	// True if the blacklisting ended and a single request is probing the tracker
+	Probing bool
+}
+
+// Makes trackers which fail again after their blacklisting ended stay blacklisted longer (default: 10 minutes).
+//
+// Once the blacklisting of a tracker ended, a single request is sent to it as a probe while
+// all other requests keep avoiding it. The tracker is restored if the probe succeeds. If the
+// probe fails, the tracker is blacklisted again and the blacklist duration (see
+// WithBlacklistDuration) doubles with each failure up to maxDuration. Pass 0 to disable growth.
+func WithBlacklistGrowth(maxDuration time.Duration) Option {
+	return func(m *MogileFsClient) {
+		m.dead_trackers.max_duration = maxDuration
+	}
+}
+
+// Returns the trackers currently blacklisted
+func (m *MogileFsClient) BlacklistStatus() (entries []BlacklistEntry) {
+	return m.dead_trackers.status()
+}
+
+func newBlacklist(duration time.Duration) *blacklist {
+	return &blacklist{duration: duration, dead: make(map[string]time.Time), strikes: make(map[string]int), probing: make(map[string]time.Time)}
+}
 
 /**
- * Checks if given tracker is known to be misbehaving
- * @param tracker string host string of the tracker to check
- * @param isdown bool true if the tracker should be avoided
+ * Checks if given host is known to be misbehaving
+ * @param host string host string of the host to check
+ * @param isdown bool true if the host should be avoided
  */
-func (m *MogileFsClient) trackerIsBad(tracker string) (isdown bool) {
+func (b *blacklist) isBad(host string) (isdown bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
 
-	if m.dead_trackers[tracker].IsZero() == false {
-		// tracker is blacklisted, check if the blacklist is still active
-		if m.dead_trackers[tracker].Before(time.Now()) == true {
-			m.markTrackerAsAlive(tracker)
-		} else {
+	if b.dead[host].IsZero() == false {
+		// host is blacklisted, check if the blacklist is still active
+		now := time.Now()
+		if b.dead[host].After(now) == true {
+			isdown = true
+		} else if b.half_open == false {
+			delete(b.dead, host)
+		} else if started, ok := b.probing[host]; ok && now.Sub(started) < b.duration {
+			// another request is probing the host: keep avoiding it until the probe finished
 			isdown = true
+		} else {
+			// let this request through as probe: the host stays on the blacklist until it answers
+			b.probing[host] = now
+		}
+	}
+	return
+}
+
+/**
+ * Adds a host to the blacklist
+ * @param host string host string of the host to blacklist
+ * @return added bool false if the host was blacklisted already
+ */
+func (b *blacklist) markBad(host string) (added bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.max_entries > 0 && len(b.dead) >= b.max_entries {
+		b.prune()
+		if len(b.dead) >= b.max_entries {
+			return
+		}
+	}
+	if b.dead[host].IsZero() == true || b.dead[host].Before(time.Now()) == true {
+		// -> not known to be bad: add it to blacklist
+		duration := b.duration
+		if b.max_duration > b.duration {
+			b.strikes[host]++
+			for i := 1; i < b.strikes[host] && duration < b.max_duration; i++ {
+				duration *= 2
+			}
+			if duration > b.max_duration {
+				duration = b.max_duration
+			}
 		}
+		b.dead[host] = time.Now().Add(duration)
+		delete(b.probing, host)
+		added = true
 	}
 	return
 }
 
+/**
+ * Returns all hosts which are currently blacklisted
+ */
+func (b *blacklist) status() (entries []BlacklistEntry) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	now := time.Now()
+	for host, until := range b.dead {
+		_, probing := b.probing[host]
+		if until.After(now) || probing {
+			entries = append(entries, BlacklistEntry{Host: host, Until: until, Strikes: b.strikes[host], Probing: probing})
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Host < entries[j].Host
+	})
+	return
+}
+
+/**
+ * Removes all expired hosts, must be called with the mutex held
+ */
+func (b *blacklist) prune() {
+	now := time.Now()
+	for host, until := range b.dead {
+		if _, probing := b.probing[host]; until.Before(now) && !probing {
+			delete(b.dead, host)
+		}
+	}
+}
+
+/**
+ * Forcefully removes a host from the blacklist
+ * @param host string host string of the host to remove
+ * @return removed bool true if the host was blacklisted
+ */
+func (b *blacklist) markAlive(host string) (removed bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	_, removed = b.dead[host]
+	delete(b.dead, host)
+	delete(b.strikes, host)
+	delete(b.probing, host)
+	return
+}
+
+/**
+ * Checks if given tracker is known to be misbehaving
+ * @param tracker string host string of the tracker to check
+ * @param isdown bool true if the tracker should be avoided
+ */
+func (m *MogileFsClient) trackerIsBad(tracker string) (isdown bool) {
+	return m.dead_trackers.isBad(tracker)
+}
+
 /**
  * Adds a tracker to the blacklist
  * @param tracker string host string of the tracker to blacklist
  */
 func (m *MogileFsClient) markTrackerAsBad(tracker string) {
-	if m.trackerIsBad(tracker) == false {
-		// -> not known to be bad: add it to blacklist
-		m.dead_trackers[tracker] = time.Now().Add(blacklist_duration)
+	if m.dead_trackers.markBad(tracker) {
+		m.logger.Debug("mogilefs: blacklisted tracker", slog.String("tracker", tracker))
 	}
 }
 
@@ -59,7 +209,7 @@ func (m *MogileFsClient) markTrackerAsBad(tracker string) {
  * @param tracker string host string of the tracker to check
  */
 func (m *MogileFsClient) markTrackerAsAlive(tracker string) {
-	if m.dead_trackers[tracker].IsZero() == false {
-		delete(m.dead_trackers, tracker)
+	if m.dead_trackers.markAlive(tracker) {
+		m.logger.Debug("mogilefs: removed tracker from blacklist", slog.String("tracker", tracker))
 	}
 }
@@ -0,0 +1,139 @@
+/*
+
+Copyright 2015 Adrian Ulrich
+Copyright 2015 Fixxpunkt AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package mogilefs
+
+import (
+	"math/rand"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Decides in which order the trackers of a client are tried, see WithTrackerSelector()
+type TrackerSelector interface {
+	// Returns the trackers in the order they should be tried. The returned slice must not be trackers itself
+	Order(trackers []string) []string
+	// Reports the outcome of a command sent to tracker: its duration and nil or the error blamed on the tracker
+	Observe(tracker string, latency time.Duration, err error)
+}
+
+// Sets the strategy used to pick a tracker (default: InOrder()).
+//
+// Blacklisted trackers are skipped regardless of the strategy.
+func WithTrackerSelector(selector TrackerSelector) Option {
+	return func(m *MogileFsClient) {
+		m.selector = selector
+	}
+}
+
+// Returns a TrackerSelector which always tries the trackers in the configured order
+func InOrder() TrackerSelector {
+	return inOrderSelector{}
+}
+
+// Returns a TrackerSelector which starts each command on the next tracker
+func RoundRobin() TrackerSelector {
+	return &roundRobinSelector{}
+}
+
+// Returns a TrackerSelector which tries the trackers in random order
+func Random() TrackerSelector {
+	return randomSelector{}
+}
+
+// Returns a TrackerSelector which prefers the trackers answering the fastest.
+//
+// The latency of each tracker is tracked as moving average, failures count as penalty
+// latency. Trackers without any measurements are tried first.
+func LatencyAware() TrackerSelector {
+	return &latencySelector{latency: make(map[string]time.Duration)}
+}
+
+type inOrderSelector struct{}
+
+func (inOrderSelector) Order(trackers []string) []string {
+	return append([]string(nil), trackers...)
+}
+
+func (inOrderSelector) Observe(string, time.Duration, error) {}
+
+type roundRobinSelector struct {
+	next uint64
+}
+
+func (s *roundRobinSelector) Order(trackers []string) []string {
+	order := make([]string, 0, len(trackers))
+	if len(trackers) > 0 {
+		start := int(atomic.AddUint64(&s.next, 1) % uint64(len(trackers)))
+		order = append(order, trackers[start:]...)
+		order = append(order, trackers[:start]...)
+	}
+	return order
+}
+
+func (s *roundRobinSelector) Observe(string, time.Duration, error) {}
+
+type randomSelector struct{}
+
+func (randomSelector) Order(trackers []string) []string {
+	order := make([]string, len(trackers))
+	for i, j := range rand.Perm(len(trackers)) {
+		order[i] = trackers[j]
+	}
+	return order
+}
+
+func (randomSelector) Observe(string, time.Duration, error) {}
+
+const (
+	// Latency added for a failed command
+	latency_penalty = time.Duration(5) * time.Second
+	// Weight of a new measurement in the moving average
+	latency_weight = 0.3
+)
+
+type latencySelector struct {
+	mutex   sync.Mutex
+	latency map[string]time.Duration
+}
+
+func (s *latencySelector) Order(trackers []string) []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	order := append([]string(nil), trackers...)
+	sort.SliceStable(order, func(i, j int) bool {
+		return s.latency[order[i]] < s.latency[order[j]]
+	})
+	return order
+}
+
+func (s *latencySelector) Observe(tracker string, latency time.Duration, err error) {
+	if err != nil {
+		latency += latency_penalty
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if current, found := s.latency[tracker]; found {
+		latency = time.Duration(latency_weight*float64(latency) + (1-latency_weight)*float64(current))
+	}
+	s.latency[tracker] = latency
+}
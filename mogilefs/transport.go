@@ -0,0 +1,266 @@
+/*
+
+Copyright 2015 Adrian Ulrich
+Copyright 2015 Fixxpunkt AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package mogilefs
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Moves data from and to storage nodes.
+//
+// The default transport uses net/http, see WithStorageTransport() to replace it.
+type StorageTransport interface {
+	// Uploads the contents of r to path, a destination returned by the tracker
+	Put(ctx context.Context, path string, r io.Reader, opts *StoragePutOpts) error
+	// Returns the contents of path. size is the total size of the file, -1 if unknown
+	Get(ctx context.Context, path string, opts *StorageGetOpts) (body io.ReadCloser, size int64, err error)
+}
+
+// Implemented by transports which can check a path without transferring its contents
+type StorageHeader interface {
+	// Returns the size of path (-1 if unknown) or an error if it can not be read
+	Head(ctx context.Context, path string) (size int64, err error)
+}
+
+// Implemented by transports which can remove files from storage nodes, used to clean up aborted uploads
+type StorageDeleter interface {
+	// Removes path, a destination returned by the tracker
+	Delete(ctx context.Context, path string) error
+}
+
+// Optional argument to StorageTransport.Put
+type StoragePutOpts struct {
+	// Additional headers of the upload (eg. Content-MD5) - may be nil
+	Header http.Header
+	// Trailers of the upload - may be nil. The values are only complete once r returned io.EOF
+	Trailer http.Header
+	// Number of bytes of r, 0 if unknown
+	ContentLength int64
+}
+
+// Optional argument to StorageTransport.Get
+type StorageGetOpts struct {
+	// Offset of the first byte to return
+	Offset int64
+	// Number of bytes to return, <= 0 returns everything after Offset
+	Length int64
+	// If not nil, receives the headers of the reply of the storage node. Transports may leave it empty
+	Header http.Header
+}
+
+// Replaces the default (net/http based) storage transport
+func WithStorageTransport(transport StorageTransport) Option {
+	return func(m *MogileFsClient) {
+		m.transport = transport
+	}
+}
+
+/**
+ * @desc Returns the default http.Client used for storage nodes, see WithHTTPClient()
+ */
+func newHTTPClient() *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			Proxy:                 http.ProxyFromEnvironment,
+			DialContext:           (&net.Dialer{Timeout: time.Duration(5) * time.Second, KeepAlive: time.Duration(30) * time.Second}).DialContext,
+			MaxIdleConns:          128,
+			MaxIdleConnsPerHost:   16,
+			IdleConnTimeout:       time.Duration(90) * time.Second,
+			ResponseHeaderTimeout: time.Duration(30) * time.Second,
+			ExpectContinueTimeout: time.Duration(1) * time.Second,
+		},
+	}
+}
+
+// Returns the http.Client used to talk to the storage nodes, see WithHTTPClient()
+func (m *MogileFsClient) HTTPClient() *http.Client {
+	return m.http_client
+}
+
+// The default StorageTransport, using the http.Client of a MogileFsClient
+type httpTransport struct {
+	m *MogileFsClient
+}
+
+/**
+ * @desc Uploads r to path, see StorageTransport.Put
+ */
+func (t *httpTransport) put(ctx context.Context, path string, r io.Reader, opts *StoragePutOpts) (err error) {
+	if opts == nil {
+		opts = &StoragePutOpts{}
+	}
+	putRq, err := http.NewRequestWithContext(ctx, "PUT", path, r)
+	if err != nil {
+		return
+	}
+	for k, v := range opts.Header {
+		putRq.Header[k] = v
+	}
+	putRq.Trailer = opts.Trailer
+	if opts.ContentLength > 0 {
+		putRq.ContentLength = opts.ContentLength
+	}
+
+	putRes, err := t.m.http_client.Do(putRq)
+	if err == nil {
+		io.Copy(io.Discard, putRes.Body)
+		putRes.Body.Close()
+		t.m.storageResponse(putRes)
+		// WebDAV servers may answer 201 Created or 204 No Content
+		if !isSuccess(putRes.StatusCode) {
+			err = &StorageError{Path: path, StatusCode: putRes.StatusCode, RetryAfter: parseRetryAfter(putRes.Header.Get("Retry-After"))}
+		}
+	}
+	return
+}
+
+/**
+ * @desc Returns the contents of path, see StorageTransport.Get
+ */
+func (t *httpTransport) get(ctx context.Context, path string, opts *StorageGetOpts) (body io.ReadCloser, size int64, err error) {
+	if opts == nil {
+		opts = &StorageGetOpts{}
+	}
+	size = -1
+	getRq, err := http.NewRequestWithContext(ctx, "GET", path, nil)
+	if err == nil && opts.Length > 0 {
+		getRq.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", opts.Offset, opts.Offset+opts.Length-1))
+	} else if err == nil && opts.Offset > 0 {
+		getRq.Header.Set("Range", fmt.Sprintf("bytes=%d-", opts.Offset))
+	}
+
+	if err == nil {
+		getRes, getErr := t.m.http_client.Do(getRq)
+		err = getErr
+		if err == nil {
+			t.m.storageResponse(getRes)
+			if opts.Header != nil && isSuccess(getRes.StatusCode) {
+				for k, v := range getRes.Header {
+					opts.Header[k] = v
+				}
+			}
+			switch {
+			case getRes.StatusCode == 206:
+				body = getRes.Body
+				size = contentRangeSize(getRes.Header.Get("Content-Range"))
+			case isSuccess(getRes.StatusCode):
+				// the storage node ignored our range: skip what we do not want
+				size = getRes.ContentLength
+				if _, err = io.CopyN(io.Discard, getRes.Body, opts.Offset); err == nil {
+					body = getRes.Body
+					if opts.Length > 0 {
+						body = &limitedReadCloser{Reader: io.LimitReader(getRes.Body, opts.Length), Closer: getRes.Body}
+					}
+				} else {
+					getRes.Body.Close()
+				}
+			case getRes.StatusCode == 416 && contentRangeSize(getRes.Header.Get("Content-Range")) >= 0:
+				// the range starts after the end of the file (eg. any range of an empty file)
+				getRes.Body.Close()
+				body = io.NopCloser(strings.NewReader(""))
+				size = contentRangeSize(getRes.Header.Get("Content-Range"))
+			default:
+				getRes.Body.Close()
+				err = &StorageError{Path: path, StatusCode: getRes.StatusCode}
+			}
+		}
+	}
+	return
+}
+
+func (t *httpTransport) Head(ctx context.Context, path string) (size int64, err error) {
+	size = -1
+	headRq, err := http.NewRequestWithContext(ctx, "HEAD", path, nil)
+	if err == nil {
+		headRes, headErr := t.m.http_client.Do(headRq)
+		err = headErr
+		if err == nil {
+			headRes.Body.Close()
+			t.m.storageResponse(headRes)
+			if isSuccess(headRes.StatusCode) {
+				size = headRes.ContentLength
+			} else {
+				err = &StorageError{Path: path, StatusCode: headRes.StatusCode}
+			}
+		}
+	}
+	return
+}
+
+func (t *httpTransport) Delete(ctx context.Context, path string) (err error) {
+	deleteRq, err := http.NewRequestWithContext(ctx, "DELETE", path, nil)
+	if err == nil {
+		deleteRes, deleteErr := t.m.http_client.Do(deleteRq)
+		err = deleteErr
+		if err == nil {
+			deleteRes.Body.Close()
+			// the file may not exist if the upload was aborted early
+			if !isSuccess(deleteRes.StatusCode) && deleteRes.StatusCode != http.StatusNotFound {
+				err = &StorageError{Path: path, StatusCode: deleteRes.StatusCode}
+			}
+		}
+	}
+	return
+}
+
+/**
+ * @desc Checks that path can be read, using Head() if the transport supports it and fetching its first byte otherwise
+ * @return size int64 the size of path, -1 if unknown
+ */
+func (m *MogileFsClient) headPath(ctx context.Context, path string) (size int64, err error) {
+	if header, ok := m.transport.(StorageHeader); ok {
+		return header.Head(ctx, path)
+	}
+	body, size, err := m.transport.Get(ctx, path, &StorageGetOpts{Length: 1})
+	if err == nil {
+		body.Close()
+	}
+	return
+}
+
+/**
+ * @desc Returns true if code is a 2xx HTTP status code
+ */
+func isSuccess(code int) bool {
+	return code >= 200 && code <= 299
+}
+
+/**
+ * @desc Returns the total size of a Content-Range header ('bytes 0-99/1234'), -1 if unknown
+ */
+func contentRangeSize(contentRange string) (size int64) {
+	size = -1
+	if i := strings.LastIndex(contentRange, "/"); i >= 0 {
+		if n, err := strconv.ParseInt(contentRange[i+1:], 10, 64); err == nil {
+			size = n
+		}
+	}
+	return
+}
+
+type limitedReadCloser struct {
+	io.Reader
+	io.Closer
+}
@@ -0,0 +1,68 @@
+/*
+
+Copyright 2015 Adrian Ulrich
+Copyright 2015 Fixxpunkt AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package mogilefs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTransportStatusCodes(t *testing.T) {
+	for _, tc := range []struct {
+		status int
+		ok     bool
+	}{
+		{200, true},
+		{201, true},
+		{204, true},
+		{404, false},
+		{500, false},
+	} {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			io.Copy(io.Discard, r.Body)
+			w.WriteHeader(tc.status)
+		}))
+		transport := &httpTransport{m: New("test", nil)}
+		ctx := context.Background()
+
+		checkErr := func(method string, err error) {
+			var serr *StorageError
+			switch {
+			case tc.ok && err != nil:
+				t.Errorf("%s answered with %d: %v", method, tc.status, err)
+			case !tc.ok && (!errors.As(err, &serr) || serr.StatusCode != tc.status):
+				t.Errorf("%s answered with %d: err = %v, want a StorageError", method, tc.status, err)
+			}
+		}
+
+		checkErr("PUT", transport.Put(ctx, srv.URL+"/put", strings.NewReader("data"), &StoragePutOpts{ContentLength: 4}))
+		body, _, err := transport.Get(ctx, srv.URL+"/get", nil)
+		if err == nil {
+			body.Close()
+		}
+		checkErr("GET", err)
+		_, err = transport.Head(ctx, srv.URL+"/head")
+		checkErr("HEAD", err)
+		srv.Close()
+	}
+}
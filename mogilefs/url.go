@@ -0,0 +1,158 @@
+/*
+
+Copyright 2015 Adrian Ulrich
+Copyright 2015 Fixxpunkt AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package mogilefs
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The settings of a client encoded in a URL, returned by ParseURL()
+type URLConfig struct {
+	// The trackers ('host:port')
+	Trackers []string
+	// The domain of the client
+	Domain string
+	// Options for New(), built from the query parameters
+	Options []Option
+}
+
+// Parses a URL describing a client, eg. 'mogilefs://tracker1,tracker2:7002/domain?class=thumbs&read_timeout=10s'.
+//
+// Trackers without a port use 7001. The following (optional) query parameters are supported:
+//
+//	class          default class of uploads, see WithDefaultClass
+//	dial_timeout   see WithDialTimeout, eg. '2s'
+//	read_timeout   see WithTrackerTimeouts, eg. '30s'
+//	write_timeout  see WithTrackerTimeouts, eg. '5s'
+//	blacklist      see WithBlacklistDuration, eg. '1m'
+//	retries        see WithRetries
+//	pathcount      see WithPathcountDefault
+//	noverify       see WithNoVerifyDefault, 'true' or 'false'
+//	client_id      see WithClientId
+//
+// Unknown parameters are rejected, so typos do not go unnoticed.
+func ParseURL(rawurl string) (cfg URLConfig, err error) {
+	rest, found := strings.CutPrefix(rawurl, "mogilefs://")
+	if !found {
+		err = errors.New("internal:URL must start with mogilefs://")
+		return
+	}
+	rest, query, _ := strings.Cut(rest, "?")
+	hosts, domain, _ := strings.Cut(rest, "/")
+
+	if cfg.Domain, err = url.PathUnescape(strings.TrimSuffix(domain, "/")); err != nil {
+		return
+	}
+	if len(cfg.Domain) == 0 {
+		err = errors.New("internal:URL has no domain")
+		return
+	}
+
+	for _, host := range strings.Split(hosts, ",") {
+		if len(host) == 0 {
+			continue
+		}
+		if _, _, serr := net.SplitHostPort(host); serr != nil {
+			host = net.JoinHostPort(strings.Trim(host, "[]"), "7001")
+		}
+		cfg.Trackers = append(cfg.Trackers, host)
+	}
+	if len(cfg.Trackers) == 0 {
+		err = errors.New("internal:URL has no trackers")
+		return
+	}
+
+	params, err := url.ParseQuery(query)
+	if err != nil {
+		return
+	}
+	read_timeout, write_timeout := time.Duration(-1), time.Duration(-1)
+	for name := range params {
+		value := params.Get(name)
+		var d time.Duration
+		var n int
+		var b bool
+		switch name {
+		case "class":
+			cfg.Options = append(cfg.Options, WithDefaultClass(value))
+		case "dial_timeout", "read_timeout", "write_timeout", "blacklist":
+			if d, err = time.ParseDuration(value); err != nil {
+				break
+			}
+			switch name {
+			case "dial_timeout":
+				cfg.Options = append(cfg.Options, WithDialTimeout(d))
+			case "read_timeout":
+				read_timeout = d
+			case "write_timeout":
+				write_timeout = d
+			case "blacklist":
+				cfg.Options = append(cfg.Options, WithBlacklistDuration(d))
+			}
+		case "retries":
+			if n, err = strconv.Atoi(value); err == nil {
+				cfg.Options = append(cfg.Options, WithRetries(n))
+			}
+		case "pathcount":
+			if n, err = strconv.Atoi(value); err == nil {
+				cfg.Options = append(cfg.Options, WithPathcountDefault(n))
+			}
+		case "noverify":
+			if b, err = strconv.ParseBool(value); err == nil {
+				cfg.Options = append(cfg.Options, WithNoVerifyDefault(b))
+			}
+		case "client_id":
+			cfg.Options = append(cfg.Options, WithClientId(value))
+		default:
+			err = fmt.Errorf("internal:unknown URL parameter %q", name)
+			return
+		}
+		if err != nil {
+			err = fmt.Errorf("internal:invalid URL parameter %q: %w", name, err)
+			return
+		}
+	}
+	if read_timeout >= 0 || write_timeout >= 0 {
+		cfg.Options = append(cfg.Options, func(m *MogileFsClient) {
+			if read_timeout >= 0 {
+				m.read_timeout = read_timeout
+			}
+			if write_timeout >= 0 {
+				m.write_timeout = write_timeout
+			}
+		})
+	}
+	return
+}
+
+// Returns a new client configured by a URL, see ParseURL().
+//
+// opts are applied after the options of the URL.
+func NewFromURL(rawurl string, opts ...Option) (m *MogileFsClient, err error) {
+	cfg, err := ParseURL(rawurl)
+	if err == nil {
+		m = New(cfg.Domain, cfg.Trackers, append(cfg.Options, opts...)...)
+	}
+	return
+}
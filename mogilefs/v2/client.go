@@ -0,0 +1,217 @@
+/*
+
+Copyright 2015 Adrian Ulrich
+Copyright 2015 Fixxpunkt AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+/*
+Package mogilefs (v2) is the stable API of the mogilefs client.
+
+It cleans up the names of the original package and takes a context.Context as first
+argument of every call talking to the cluster. Options and results are typed
+everywhere: there are no url.Values in the API apart from Do().
+
+The v1 package (github.com/adrian-bl/golang-mogilefs-client/mogilefs) keeps working
+unchanged, and both share the same implementation: a v1 client may be wrapped with
+Wrap() and a v2 client exposes its v1 client with V1(), so code can migrate one call
+at a time.
+
+	v1                          v2
+	mc.GetPaths / LookupPaths*  c.Paths(ctx, key, opts)
+	mc.Fetch / FetchWithOpts    c.Get(ctx, key, opts)
+	mc.FetchWithInfo            c.GetWithInfo(ctx, key)
+	mc.FetchRange               c.GetRange(ctx, key, offset, length)
+	mc.Create* / CreateContext  c.Put(ctx, key, class, r, opts)
+	mc.Delete / DeleteContext   c.Delete(ctx, key)
+	mc.Rename / RenameContext   c.Rename(ctx, from, to)
+	mc.UpdateClass*             c.SetClass(ctx, key, class)
+	mc.FileInfo*                c.Info(ctx, key)
+	mc.ListKeys*                c.List(ctx, prefix, after, limit)
+	mc.DoRequest*               c.Do(ctx, command, args)
+	mc.LastTracketr             c.LastTracker()
+
+Example:
+
+	c := mogilefs.New("example.com", []string{"tracker1:7001", "tracker2:7001"})
+	r, err := c.Get(ctx, "example-key", nil)
+*/
+package mogilefs
+
+import (
+	"context"
+	"io"
+	"net/url"
+
+	v1 "github.com/adrian-bl/golang-mogilefs-client/mogilefs"
+)
+
+// Configures a client, see the With* functions of the v1 package
+type Option = v1.Option
+
+// Optional argument to Paths
+type PathsOpts = v1.GetPathsOpts
+
+// The result of Paths
+type PathsResult = v1.PathsResult
+
+// Optional argument to Get
+type GetOpts = v1.FetchOpts
+
+// Optional argument to Put
+type PutOpts = v1.CreateOpts
+
+// The result of Put
+type PutResult = v1.CreateResult
+
+// The metadata of a key, returned by Info
+type FileInfo = v1.FileInfo
+
+// Metadata of a download, returned by GetWithInfo
+type FetchInfo = v1.FetchInfo
+
+// The result of List
+type ListResult struct {
+	// The listed keys, sorted by name. Empty if there are no more keys
+	Keys []string
+	// Pass as 'after' to List to fetch the next batch of keys
+	Next string
+}
+
+// A mogilefs client
+type Client struct {
+	m *v1.MogileFsClient
+}
+
+// Returns a new client for domain, using the specified trackers
+func New(domain string, trackers []string, opts ...Option) *Client {
+	return Wrap(v1.New(domain, trackers, opts...))
+}
+
+// Returns a new client configured by a URL, see the v1 NewFromURL()
+func NewFromURL(rawurl string, opts ...Option) (c *Client, err error) {
+	m, err := v1.NewFromURL(rawurl, opts...)
+	if err == nil {
+		c = Wrap(m)
+	}
+	return
+}
+
+// Returns a v2 client sharing all state (connections, caches, blacklists) with m
+func Wrap(m *v1.MogileFsClient) *Client {
+	return &Client{m: m}
+}
+
+// Returns the v1 client of c, for calls not (yet) covered by v2
+func (c *Client) V1() *v1.MogileFsClient {
+	return c.m
+}
+
+// Returns the last tracker used by the client (may return an empty string)
+func (c *Client) LastTracker() string {
+	return c.m.LastTracker()
+}
+
+// Returns the paths of key
+func (c *Client) Paths(ctx context.Context, key string, opts *PathsOpts) (PathsResult, error) {
+	return c.m.LookupPathsContext(ctx, key, opts)
+}
+
+// Returns a reader with the contents of key, see GetOpts.
+//
+// The reader is closed once ctx is done, making pending reads fail with ctx.Err().
+func (c *Client) Get(ctx context.Context, key string, opts *GetOpts) (r io.ReadCloser, err error) {
+	if err = ctx.Err(); err == nil {
+		r, err = c.m.FetchWithOpts(key, opts)
+	}
+	if err == nil {
+		r = bindReader(ctx, r)
+	}
+	return
+}
+
+// Returns a reader with the contents of key and metadata of the download (size, Last-Modified, Content-Type and path).
+//
+// The reader is bound to ctx, see Get().
+func (c *Client) GetWithInfo(ctx context.Context, key string) (r io.ReadCloser, info FetchInfo, err error) {
+	if err = ctx.Err(); err == nil {
+		r, info, err = c.m.FetchWithInfo(key)
+	}
+	if err == nil {
+		r = bindReader(ctx, r)
+	}
+	return
+}
+
+// Returns a reader with length bytes of key starting at offset, and the total size of key (-1 if unknown).
+//
+// Pass a length <= 0 to read everything after offset. The reader is bound to ctx, see Get().
+func (c *Client) GetRange(ctx context.Context, key string, offset int64, length int64) (r io.ReadCloser, size int64, err error) {
+	if err = ctx.Err(); err == nil {
+		r, size, err = c.m.FetchRange(key, offset, length)
+	}
+	if err == nil {
+		r = bindReader(ctx, r)
+	}
+	return
+}
+
+// Uploads the contents of r as key, see the v1 CreateContext().
+//
+// Set class to an empty string to use the default class.
+func (c *Client) Put(ctx context.Context, key string, class string, r io.Reader, opts *PutOpts) (result PutResult, err error) {
+	return c.m.CreateContext(ctx, key, class, r, opts)
+}
+
+// Deletes key
+func (c *Client) Delete(ctx context.Context, key string) error {
+	return c.m.DeleteContext(ctx, key)
+}
+
+// Renames the key from to to
+func (c *Client) Rename(ctx context.Context, from string, to string) error {
+	return c.m.RenameContext(ctx, from, to)
+}
+
+// Moves key to class
+func (c *Client) SetClass(ctx context.Context, key string, class string) error {
+	return c.m.UpdateClassContext(ctx, key, class)
+}
+
+// Returns the metadata of key as known by the trackers
+func (c *Client) Info(ctx context.Context, key string) (FileInfo, error) {
+	return c.m.FileInfoContext(ctx, key)
+}
+
+// Returns up to limit keys starting with prefix and sorted by name, following after.
+//
+// Pass an empty string as after to start at the beginning.
+func (c *Client) List(ctx context.Context, prefix string, after string, limit int) (result ListResult, err error) {
+	result.Keys, result.Next, err = c.m.ListKeysContext(ctx, prefix, after, limit)
+	return
+}
+
+// Sends a raw command to a tracker
+func (c *Client) Do(ctx context.Context, command string, args url.Values) (url.Values, error) {
+	return c.m.DoRequestContext(ctx, command, args)
+}
+
+// Checks that a tracker can be reached
+func (c *Client) Ping(ctx context.Context) error {
+	return c.m.Ping(ctx)
+}
+
+// Shuts down the client, see the v1 Close()
+func (c *Client) Close(ctx context.Context) error {
+	return c.m.Close(ctx)
+}
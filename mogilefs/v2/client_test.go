@@ -0,0 +1,70 @@
+/*
+
+Copyright 2015 Adrian Ulrich
+Copyright 2015 Fixxpunkt AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package mogilefs_test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/adrian-bl/golang-mogilefs-client/mogilefs/v2"
+)
+
+func TestContextBoundsTrackerRequests(t *testing.T) {
+	// a wedged tracker: accepts connections but never answers
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+	c := mogilefs.New("test", []string{listener.Addr().String()})
+
+	for name, call := range map[string]func(ctx context.Context) error{
+		"Paths": func(ctx context.Context) error {
+			_, err := c.Paths(ctx, "k", nil)
+			return err
+		},
+		"Info": func(ctx context.Context) error {
+			_, err := c.Info(ctx, "k")
+			return err
+		},
+		"List": func(ctx context.Context) error {
+			_, err := c.List(ctx, "", "", 10)
+			return err
+		},
+	} {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		started := time.Now()
+		err := call(ctx)
+		cancel()
+		// the read timeout of the client is 30 seconds
+		if err == nil || time.Since(started) > 5*time.Second {
+			t.Errorf("%s: err = %v after %s, want to give up at the deadline of ctx", name, err, time.Since(started))
+		}
+	}
+}
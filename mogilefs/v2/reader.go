@@ -0,0 +1,54 @@
+/*
+
+Copyright 2015 Adrian Ulrich
+Copyright 2015 Fixxpunkt AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package mogilefs
+
+import (
+	"context"
+	"io"
+)
+
+// boundReader closes a reader once its context is done
+type boundReader struct {
+	io.ReadCloser
+	ctx  context.Context
+	stop func() bool
+}
+
+// bindReader returns r, closed once ctx is done
+func bindReader(ctx context.Context, r io.ReadCloser) io.ReadCloser {
+	stop := context.AfterFunc(ctx, func() {
+		r.Close()
+	})
+	return &boundReader{ReadCloser: r, ctx: ctx, stop: stop}
+}
+
+func (br *boundReader) Read(buffer []byte) (nr int, err error) {
+	nr, err = br.ReadCloser.Read(buffer)
+	if err != nil && err != io.EOF && br.ctx.Err() != nil {
+		err = br.ctx.Err()
+	}
+	return
+}
+
+func (br *boundReader) Close() error {
+	if !br.stop() {
+		// already closed as ctx is done
+		return nil
+	}
+	return br.ReadCloser.Close()
+}
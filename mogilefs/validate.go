@@ -0,0 +1,95 @@
+/*
+
+Copyright 2015 Adrian Ulrich
+Copyright 2015 Fixxpunkt AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package mogilefs
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+/*
+Behavior on empty or nil arguments
+
+By default, the client is lenient:
+	- empty keys and prefixes are sent to the tracker as-is (which usually refuses them)
+	- keys are not checked for their length or content (see key-encoding.go)
+	- a nil reader passed to Create uploads an empty file
+	- a Pathcount below 2 (including negative values) requests 2 paths
+	- a client without trackers returns an error on each request
+
+A client created with WithStrictMode() returns an error for all of these
+cases before talking to any tracker.
+*/
+
+/**
+ * @desc Returns an error if key is empty, too long or contains bytes which may not round-trip and the client is in strict mode
+ */
+func (m *MogileFsClient) checkKey(key string) (err error) {
+	if !m.strict {
+		return
+	}
+	switch {
+	case len(key) == 0:
+		err = errors.New("internal:empty key")
+	case len(m.encodeKey(key)) > MaxKeyLength:
+		err = errors.New("internal:key too long")
+	case m.key_encoding == KeyEncodingNone && !utf8.ValidString(key):
+		err = errors.New("internal:key is not valid UTF-8")
+	case m.key_encoding == KeyEncodingNone && strings.IndexFunc(key, unicode.IsControl) >= 0:
+		err = errors.New("internal:key contains control characters")
+	}
+	return
+}
+
+/**
+ * @desc Returns an error if prefix is empty and the client is in strict mode
+ */
+func (m *MogileFsClient) checkPrefix(prefix string) (err error) {
+	if m.strict && len(prefix) == 0 {
+		err = errors.New("internal:empty prefix")
+	}
+	return
+}
+
+/**
+ * @desc Returns an error if pathcount is negative and the client is in strict mode
+ */
+func (m *MogileFsClient) checkPathcount(pathcount int) (err error) {
+	if m.strict && pathcount < 0 {
+		err = errors.New("internal:negative pathcount")
+	}
+	return
+}
+
+/**
+ * @desc Returns the reader to upload: an error in strict mode or an empty reader if r is nil
+ */
+func (m *MogileFsClient) checkReader(r io.Reader) (rv io.Reader, err error) {
+	rv = r
+	if r == nil {
+		if m.strict {
+			err = errors.New("internal:nil reader")
+		} else {
+			rv = strings.NewReader("")
+		}
+	}
+	return
+}
@@ -0,0 +1,95 @@
+/*
+
+Copyright 2015 Adrian Ulrich
+Copyright 2015 Fixxpunkt AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package mogilefs
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// Writes the raw protocol lines exchanged with the trackers
+type wireDebug struct {
+	mutex sync.Mutex
+	// where to write the lines, nil to use the logger of the client
+	w io.Writer
+	// names of arguments and reply values whose values are replaced
+	redact map[string]bool
+}
+
+// Writes each command line sent to a tracker and each raw reply to w.
+//
+// Lines look like '>> tracker:7001 get_paths domain=...' and '<< tracker:7001 OK paths=...'.
+// The values of arguments and reply fields named in redact are replaced by 'REDACTED';
+// numbered fields match their base name, eg. 'path' also redacts 'path1' and 'path_2'.
+// If w is nil, the lines are logged at debug level, see WithLogger().
+func WithWireDebug(w io.Writer, redact ...string) Option {
+	return func(m *MogileFsClient) {
+		m.wire_debug = &wireDebug{w: w, redact: make(map[string]bool)}
+		for _, name := range redact {
+			m.wire_debug.redact[name] = true
+		}
+	}
+}
+
+/**
+ * @desc Writes a line exchanged with a tracker, does nothing if wire debugging is disabled
+ * @param host string the tracker
+ * @param direction string '>>' for lines sent and '<<' for lines received
+ * @param line string the raw line
+ */
+func (m *MogileFsClient) debugWire(host string, direction string, line string) {
+	d := m.wire_debug
+	if d == nil {
+		return
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if len(d.redact) > 0 {
+		line = d.redactLine(line)
+	}
+	if d.w == nil {
+		m.logger.Debug(fmt.Sprintf("mogilefs: %s %s %s", direction, host, line))
+		return
+	}
+	d.mutex.Lock()
+	fmt.Fprintf(d.w, "%s %s %s\n", direction, host, line)
+	d.mutex.Unlock()
+}
+
+/**
+ * @desc Redacts the url-encoded part of a protocol line ('<verb> <args>'), keeping the order of the values
+ */
+func (d *wireDebug) redactLine(line string) string {
+	verb, query, found := strings.Cut(line, " ")
+	if !found {
+		return line
+	}
+	pairs := strings.Split(query, "&")
+	for i, pair := range pairs {
+		name, _, _ := strings.Cut(pair, "=")
+		if unescaped, err := url.QueryUnescape(name); err == nil {
+			name = unescaped
+		}
+		if d.redact[name] || d.redact[strings.TrimRight(name, "_0123456789")] {
+			pairs[i] = url.QueryEscape(name) + "=REDACTED"
+		}
+	}
+	return verb + " " + strings.Join(pairs, "&")
+}
@@ -0,0 +1,128 @@
+/*
+
+Copyright 2015 Adrian Ulrich
+Copyright 2015 Fixxpunkt AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package mogilefs
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// Streams data written to it into a new key, returned by NewWriter()
+type Writer struct {
+	m     *MogileFsClient
+	key   string
+	class string
+	// feeds the upload, nil until the first write
+	pw *io.PipeWriter
+	// aborts the upload
+	cancel context.CancelFunc
+	// receives the result of the upload
+	done   chan error
+	closed bool
+}
+
+// Returns an io.WriteCloser creating key with the data written to it.
+//
+// The upload starts with the first Write (create_open) and streams the data to the
+// storage node. Close finishes the upload (create_close) and returns its error: key
+// only changes if Close succeeded. Use CloseWithError to abort an upload instead, eg.
+// if producing the data failed. Closing a Writer without writing creates an empty key.
+//
+// This allows using io.Copy, gzip.Writer, csv.Writer, ... on top of MogileFS:
+//
+//	w := mc.NewWriter("report.csv.gz", "")
+//	zw := gzip.NewWriter(w)
+//	err := writeReport(zw)
+//	if err == nil {
+//		err = zw.Close()
+//	}
+//	if err != nil {
+//		w.CloseWithError(err)
+//	} else {
+//		err = w.Close()
+//	}
+//
+// A Writer must not be used by multiple goroutines at once.
+func (m *MogileFsClient) NewWriter(key string, class string) *Writer {
+	return &Writer{m: m, key: key, class: class}
+}
+
+func (w *Writer) Write(p []byte) (n int, err error) {
+	if w.closed {
+		return 0, errors.New("internal:write to closed writer")
+	}
+	w.start()
+	return w.pw.Write(p)
+}
+
+// Finishes the upload, returns nil if key was created
+func (w *Writer) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	w.start()
+	w.pw.Close()
+	err := <-w.done
+	w.cancel()
+	return err
+}
+
+// Aborts the upload: key is not changed and the data uploaded so far is removed.
+//
+// cause is returned to a pending Write, if any. Returns nil once the upload is aborted.
+func (w *Writer) CloseWithError(cause error) error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	if w.pw == nil {
+		// nothing was uploaded yet
+		return nil
+	}
+	w.cancel()
+	w.pw.CloseWithError(cause)
+	if err := <-w.done; err != nil && !errors.Is(err, context.Canceled) && !errors.Is(err, cause) {
+		return err
+	}
+	return nil
+}
+
+/**
+ * @desc Starts the upload if it was not started yet
+ */
+func (w *Writer) start() {
+	if w.pw != nil {
+		return
+	}
+	pr, pw := io.Pipe()
+	ctx, cancel := context.WithCancel(context.Background())
+	w.pw, w.cancel, w.done = pw, cancel, make(chan error, 1)
+
+	go func() {
+		_, err := w.m.CreateContext(ctx, w.key, w.class, pr, nil)
+		// unblock pending writes if the upload failed early
+		if err != nil {
+			pr.CloseWithError(err)
+		} else {
+			pr.Close()
+		}
+		w.done <- err
+	}()
+}
@@ -0,0 +1,51 @@
+/*
+
+Copyright 2015 Adrian Ulrich
+Copyright 2015 Fixxpunkt AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package mogilefs
+
+import (
+	"archive/zip"
+)
+
+// A zip archive stored in MogileFS, returned by OpenZip()
+type ZipReader struct {
+	*zip.Reader
+	f *File
+}
+
+// Opens key as zip archive without downloading it.
+//
+// The central directory and each member are read using Range requests (see Open), so
+// single members can be read out of large archives. The caller must Close() the archive
+// once done with all of its members.
+func (m *MogileFsClient) OpenZip(key string) (z *ZipReader, err error) {
+	f, err := m.Open(key)
+	if err != nil {
+		return
+	}
+	zr, err := zip.NewReader(f, f.Size())
+	if err != nil {
+		f.Close()
+		return
+	}
+	return &ZipReader{Reader: zr, f: f}, nil
+}
+
+// Closes the archive
+func (z *ZipReader) Close() error {
+	return z.f.Close()
+}